@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,8 +19,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	appConfig "github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
 	"github.com/rapidbuildapp/rapidbuild/internal/api"
 	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
 	"github.com/rapidbuildapp/rapidbuild/internal/middleware"
 	"github.com/rapidbuildapp/rapidbuild/internal/services"
 	"github.com/rapidbuildapp/rapidbuild/internal/worker"
@@ -88,14 +92,33 @@ func main() {
 	geminiService := services.NewGeminiService(cfg.GeminiAPIKey)
 	runwareService := services.NewRunwareService(cfg.RunwareAPIKey)
 
-	// Initialize Vercel service first (needed by versionService)
+	// Initialize the deployer first (needed by versionService)
 	vercelService := services.NewVercelService(cfg)
+	buildExecutor, err := executor.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create build executor: %v", err)
+	}
+	log.Printf("Build commands run with sandbox: %s", buildExecutor.Name())
+	deployer, err := services.NewDeployer(cfg, vercelService, buildExecutor)
+	if err != nil {
+		log.Fatalf("Failed to create deployer: %v", err)
+	}
+	log.Printf("Using %s deployer", deployer.Name())
 
 	// Initialize app services
-	appService := services.NewAppService(pgClient, mongoClient, geminiService, runwareService, s3Client, cfg)
-	versionService := services.NewVersionService(pgClient, vercelService)
+	usageService := services.NewUsageService(pgClient)
+	starterService := services.NewStarterService(cfg, s3Client)
+	appManager := appmanager.NewMongoManager(mongoClient)
+	appService := services.NewAppService(pgClient, appManager, geminiService, runwareService, usageService, starterService, s3Client, cfg)
+	versionService := services.NewVersionService(pgClient, deployer)
 	commentService := services.NewCommentService(pgClient)
 	uploadService := services.NewUploadService(pgClient, s3Client, cfg)
+	promptService := services.NewPromptTemplateService(pgClient, cfg)
+	jobService := services.NewJobService(pgClient)
+	buildStepService := services.NewBuildStepService(pgClient)
+	buildPolicyService := services.NewBuildPolicyService(pgClient)
+	buildLogService := services.NewBuildLogService(s3Client, cfg)
+	workerService := services.NewWorkerService(pgClient)
 
 	// Initialize Redis client (Upstash)
 	var redisClient *redis.Client
@@ -117,13 +140,28 @@ func main() {
 		log.Println("Warning: Redis URL not configured, SSE will not work")
 	}
 
-	// Initialize worker
-	builder := worker.NewBuilder(cfg, appService, versionService, vercelService, s3Client, redisClient)
+	// Initialize worker; with EMBEDDED_WORKER=false builds run only in cmd/worker
+	dependencyCache, err := worker.NewDependencyCache(cfg, s3Client)
+	if err != nil {
+		log.Fatalf("Failed to create dependency cache: %v", err)
+	}
+	builder, err := worker.NewBuilder(cfg, appService, appManager, versionService, deployer, buildExecutor, buildStepService, buildLogService, dependencyCache, buildPolicyService, uploadService, promptService, starterService, usageService, jobService, workerService, s3Client, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to create builder: %v", err)
+	}
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	if cfg.EmbeddedWorker {
+		go builder.Run(workerCtx)
+	} else {
+		log.Println("Embedded worker disabled, builds are processed by cmd/worker")
+	}
 
 	// Initialize API handlers
 	authHandler := api.NewAuthHandler(authService, oauthService, cfg)
-	appHandler := api.NewAppHandler(appService, versionService, commentService, builder)
+	appHandler := api.NewAppHandler(appService, versionService, commentService, jobService, workerService, buildStepService, buildLogService, buildPolicyService, promptService, builder)
 	uploadHandler := api.NewUploadHandler(uploadService)
+	usageHandler := api.NewUsageHandler(appService, usageService)
+	starterHandler := api.NewStarterHandler(starterService)
 	previewHandler := api.NewPreviewHandler(appService, versionService, mongoClient)
 
 	// Setup router
@@ -135,6 +173,16 @@ func main() {
 	// Public routes (no auth required)
 	r.HandleFunc("/health", healthCheck).Methods("GET")
 
+	// Serve locally deployed apps under the path of LOCAL_DEPLOY_BASE_URL
+	if localDeployer, ok := deployer.(*services.LocalDeployer); ok {
+		baseURL, err := url.Parse(localDeployer.BaseURL)
+		if err != nil || strings.Trim(baseURL.Path, "/") == "" {
+			log.Fatalf("LOCAL_DEPLOY_BASE_URL must be a URL with a path such as /deployments: %q", localDeployer.BaseURL)
+		}
+		prefix := strings.TrimRight(baseURL.Path, "/")
+		r.PathPrefix(prefix+"/").Handler(http.StripPrefix(prefix, localDeployer)).Methods("GET", "HEAD")
+	}
+
 	// Auth routes (public)
 	authRoutes := r.PathPrefix("/api/v1/auth").Subrouter()
 	authRoutes.HandleFunc("/signup", authHandler.Signup).Methods("POST", "OPTIONS")
@@ -162,13 +210,33 @@ func main() {
 	api.HandleFunc("/apps/{id}", appHandler.GetApp).Methods("GET", "OPTIONS")
 	api.HandleFunc("/apps/{id}", appHandler.DeleteApp).Methods("DELETE", "OPTIONS")
 	api.HandleFunc("/apps/{id}/preview-token", previewHandler.GeneratePreviewToken).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{id}/build-policy", appHandler.GetBuildPolicy).Methods("GET", "OPTIONS")
+	api.HandleFunc("/apps/{id}/build-policy", appHandler.UpdateBuildPolicy).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/apps/{id}/prompt-settings", appHandler.GetPromptSettings).Methods("GET", "OPTIONS")
+	api.HandleFunc("/apps/{id}/prompt-settings", appHandler.UpdatePromptSettings).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/apps/{id}/agent-session", appHandler.ResetAgentSession).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/prompt-templates", appHandler.ListPromptTemplates).Methods("GET", "OPTIONS")
+	api.HandleFunc("/starters", starterHandler.ListStarters).Methods("GET", "OPTIONS")
+
+	// Usage routes
+	api.HandleFunc("/apps/{id}/usage", usageHandler.GetAppUsage).Methods("GET", "OPTIONS")
+	api.HandleFunc("/usage", usageHandler.GetUserUsage).Methods("GET", "OPTIONS")
 
 	// Version routes
 	api.HandleFunc("/apps/{appId}/versions", appHandler.ListVersions).Methods("GET", "OPTIONS")
 	api.HandleFunc("/apps/{appId}/versions", appHandler.CreateVersion).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/tree", appHandler.GetVersionTree).Methods("GET", "OPTIONS")
 	api.HandleFunc("/apps/{appId}/versions/{versionId}", appHandler.GetVersion).Methods("GET", "OPTIONS")
 	api.HandleFunc("/apps/{appId}/versions/{versionId}", appHandler.DeleteVersion).Methods("DELETE", "OPTIONS")
 	api.HandleFunc("/apps/{appId}/versions/{versionId}/promote", appHandler.PromoteVersion).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/build", appHandler.GetBuildStatus).Methods("GET", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/cancel", appHandler.CancelBuild).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/retry", appHandler.RetryVersion).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/security", appHandler.GetSecurityFindings).Methods("GET", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/plan", appHandler.GetPlan).Methods("GET", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/plan", appHandler.UpdatePlan).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/plan/approve", appHandler.ApprovePlan).Methods("POST", "OPTIONS")
+	api.HandleFunc("/apps/{appId}/versions/{versionId}/plan/reject", appHandler.RejectPlan).Methods("POST", "OPTIONS")
 
 	// Comment routes
 	api.HandleFunc("/apps/{appId}/comments", appHandler.ListComments).Methods("GET", "OPTIONS")
@@ -180,6 +248,11 @@ func main() {
 	// Upload routes
 	api.HandleFunc("/apps/{appId}/versions/{versionId}/upload", uploadHandler.UploadRequirementFile).Methods("POST", "OPTIONS")
 
+	// Build steps and logs of a version
+	api.HandleFunc("/versions/{versionId}/steps", appHandler.ListBuildSteps).Methods("GET", "OPTIONS")
+	api.HandleFunc("/versions/{versionId}/steps/{stepId}/log", appHandler.GetStepLog).Methods("GET", "OPTIONS")
+	api.HandleFunc("/versions/{versionId}/logs", appHandler.GetBuildLogs).Methods("GET", "OPTIONS")
+
 	// SSE route for build progress
 	api.HandleFunc("/versions/{versionId}/progress", appHandler.SSEHandler).Methods("GET", "OPTIONS")
 
@@ -214,6 +287,9 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	// Stop claiming new builds; unfinished jobs are requeued once their lease expires
+	stopWorker()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -12,7 +12,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	appConfig "github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
 	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
 	"github.com/rapidbuildapp/rapidbuild/internal/services"
 	"github.com/rapidbuildapp/rapidbuild/internal/worker"
 )
@@ -49,16 +52,44 @@ func main() {
 
 	// Create services (minimal for test)
 	vercelService := services.NewVercelService(cfg)
-	versionService := services.NewVersionService(dbClient, vercelService)
+	buildExecutor, err := executor.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create build executor: %v", err)
+	}
+	log.Printf("Build commands run with sandbox: %s", buildExecutor.Name())
+	deployer, err := services.NewDeployer(cfg, vercelService, buildExecutor)
+	if err != nil {
+		log.Fatalf("Failed to create deployer: %v", err)
+	}
+	versionService := services.NewVersionService(dbClient, deployer)
+	jobService := services.NewJobService(dbClient)
+	buildStepService := services.NewBuildStepService(dbClient)
+	buildPolicyService := services.NewBuildPolicyService(dbClient)
+	uploadService := services.NewUploadService(dbClient, s3Client, cfg)
+	promptService := services.NewPromptTemplateService(dbClient, cfg)
+	usageService := services.NewUsageService(dbClient)
+	starterService := services.NewStarterService(cfg, s3Client)
+	buildLogService := services.NewBuildLogService(s3Client, cfg)
+	workerService := services.NewWorkerService(dbClient)
 
 	// appService (nil is ok for test)
 	var appService *services.AppService
 
+	// Schemas are applied in memory instead of MongoDB
+	appManager := appmanager.NewMemoryManager()
+
 	// redisClient (nil is ok for test)
 	var redisClient *redis.Client
 
 	// Create builder
-	builder := worker.NewBuilder(cfg, appService, versionService, vercelService, s3Client, redisClient)
+	dependencyCache, err := worker.NewDependencyCache(cfg, s3Client)
+	if err != nil {
+		log.Fatalf("Failed to create dependency cache: %v", err)
+	}
+	builder, err := worker.NewBuilder(cfg, appService, appManager, versionService, deployer, buildExecutor, buildStepService, buildLogService, dependencyCache, buildPolicyService, uploadService, promptService, starterService, usageService, jobService, workerService, s3Client, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to create builder: %v", err)
+	}
 
 	// Test parameters
 	versionID := "22222222-aaaa-bbbb-cccc-222222222222"
@@ -68,7 +99,7 @@ func main() {
 	fmt.Printf("Starting build for version %s, app %s\n", versionID, appID)
 
 	// Run build
-	err = builder.BuildApp(context.Background(), versionID, appID, requirements, nil, "")
+	err = builder.BuildApp(context.Background(), versionID, appID, models.BuildJobPayload{Requirements: requirements})
 	if err != nil {
 		log.Fatalf("Build failed: %v", err)
 	}
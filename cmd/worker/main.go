@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	appConfig "github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+	"github.com/rapidbuildapp/rapidbuild/internal/worker"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Standalone build worker. Runs only the worker.Builder loop so builds can be
+// scaled out on separate machines from the API replicas.
+func main() {
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	// Load configuration
+	cfg := appConfig.Load()
+
+	// Initialize PostgreSQL client
+	pgClient, err := db.NewPostgresClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pgClient.Close()
+
+	log.Println("Successfully connected to PostgreSQL database")
+
+	// Initialize MongoDB client
+	mongoCtx, mongoCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer mongoCancel()
+
+	mongoClient, err := mongo.Connect(mongoCtx, options.Client().ApplyURI(cfg.MongoURL))
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer func() {
+		if err := mongoClient.Disconnect(context.Background()); err != nil {
+			log.Printf("Error disconnecting MongoDB: %v", err)
+		}
+	}()
+
+	// Initialize AWS S3 client
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.AWSRegion),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.AWSAccessKey,
+			cfg.AWSSecretKey,
+			"",
+		)),
+	)
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	s3Client := s3.NewFromConfig(awsCfg)
+
+	// Initialize Redis client for build progress
+	var redisClient *redis.Client
+	if cfg.RedisURL != "" {
+		opt, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			log.Fatalf("Failed to parse Redis URL: %v", err)
+		}
+		redisClient = redis.NewClient(opt)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		log.Println("Successfully connected to Redis (Upstash)")
+	} else {
+		log.Println("Warning: Redis URL not configured, build progress will not be published")
+	}
+
+	// Initialize services used by the builder
+	geminiService := services.NewGeminiService(cfg.GeminiAPIKey)
+	runwareService := services.NewRunwareService(cfg.RunwareAPIKey)
+	vercelService := services.NewVercelService(cfg)
+	buildExecutor, err := executor.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create build executor: %v", err)
+	}
+	log.Printf("Build commands run with sandbox: %s", buildExecutor.Name())
+	deployer, err := services.NewDeployer(cfg, vercelService, buildExecutor)
+	if err != nil {
+		log.Fatalf("Failed to create deployer: %v", err)
+	}
+	usageService := services.NewUsageService(pgClient)
+	starterService := services.NewStarterService(cfg, s3Client)
+	appManager := appmanager.NewMongoManager(mongoClient)
+	appService := services.NewAppService(pgClient, appManager, geminiService, runwareService, usageService, starterService, s3Client, cfg)
+	versionService := services.NewVersionService(pgClient, deployer)
+	jobService := services.NewJobService(pgClient)
+	buildStepService := services.NewBuildStepService(pgClient)
+	buildPolicyService := services.NewBuildPolicyService(pgClient)
+	uploadService := services.NewUploadService(pgClient, s3Client, cfg)
+	promptService := services.NewPromptTemplateService(pgClient, cfg)
+	buildLogService := services.NewBuildLogService(s3Client, cfg)
+	workerService := services.NewWorkerService(pgClient)
+
+	dependencyCache, err := worker.NewDependencyCache(cfg, s3Client)
+	if err != nil {
+		log.Fatalf("Failed to create dependency cache: %v", err)
+	}
+	builder, err := worker.NewBuilder(cfg, appService, appManager, versionService, deployer, buildExecutor, buildStepService, buildLogService, dependencyCache, buildPolicyService, uploadService, promptService, starterService, usageService, jobService, workerService, s3Client, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to create builder: %v", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		builder.Run(ctx)
+		close(done)
+	}()
+
+	// First signal drains in-flight builds, a second one exits immediately.
+	// Builds abandoned on exit are requeued once their lease expires.
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Printf("Stopping worker %s, draining in-flight builds (signal again to exit now)...", builder.WorkerID)
+	stop()
+
+	select {
+	case <-done:
+		log.Println("Worker exited")
+	case <-quit:
+		log.Println("Worker forced to exit, unfinished builds will be requeued")
+	}
+}
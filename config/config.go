@@ -1,8 +1,10 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -42,10 +44,62 @@ type Config struct {
 	// Vercel
 	VercelToken string
 
+	// Deployment (vercel, local)
+	Deployer           string
+	LocalDeployDir     string // Where the local deployer keeps built output
+	LocalDeployBaseURL string // Public URL the local deployments are served under
+
 	// Workspace
 	WorkspaceDir   string
 	StarterCodeDir string
 
+	// Starter templates in {dir}/{name}/{version}/ and {prefix}{name}/{version}/ in
+	// S3Bucket, in addition to StarterCodeDir, which is DefaultStarter version 1
+	DefaultStarter           string
+	StarterTemplatesDir      string
+	StarterTemplatesS3Prefix string
+
+	// Build worker
+	WorkerID           string // Defaults to hostname-pid
+	EmbeddedWorker     bool   // Run the build worker inside cmd/server
+	WorkerConcurrency  int
+	WorkerPollInterval time.Duration
+	JobLeaseTimeout    time.Duration
+
+	// Code generation (claude, fake); apps.code_generator overrides per app
+	CodeGenerator string
+
+	// Prompt templates ("name" for the latest version or "name@version"); apps.prompt_template overrides per app
+	PromptTemplate     string
+	PromptTemplatesDir string // Templates in {dir}/{name}/{version}/, in addition to the built-in and database ones
+
+	// Post-build verification (test, lint, typecheck, smoke); checks missing from the app's package.json are skipped
+	VerifyChecks []string
+
+	// Pre-deploy security scan. Findings at or above SecurityBlockSeverity
+	// (critical, high, medium, low; none never blocks) fail the build, the others
+	// are kept as warnings. SecurityRuleSeverities overrides rules as "rule:severity" ("rule:off" disables it).
+	SecurityScan           bool
+	SecurityBlockSeverity  string
+	SecurityRuleSeverities []string
+
+	// Dependency cache (off, local, s3); s3 backs the local cache with S3Bucket
+	DependencyCache         string
+	DependencyCacheDir      string
+	DependencyCacheMaxBytes int64 // Local cache size; least recently used entries are evicted
+	DependencyCacheMaxEntry int64 // Larger node_modules archives are not cached
+
+	// Build sandbox (auto, bwrap, uid, none)
+	Sandbox              string
+	SandboxPath          string   // PATH inside the sandbox
+	SandboxEnvAllowlist  []string // Worker environment variables passed to build commands
+	SandboxWritablePaths []string // Writable in addition to the workspace for every command (bwrap)
+	SandboxAgentPaths    []string // Code agent config, writable for the agent only (bwrap)
+	SandboxDeployPaths   []string // Deploy CLI credentials, writable for link, pull and deploy only (bwrap)
+	SandboxHiddenPaths   []string // Host secrets and config masked inside the sandbox (bwrap)
+	SandboxUID           int      // User and group build commands run as (uid)
+	SandboxGID           int
+
 	// Frontend URL (for email links)
 	FrontendURL string
 
@@ -63,6 +117,16 @@ func Load() *Config {
 
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
 
+	workerConcurrency, _ := strconv.Atoi(getEnv("WORKER_CONCURRENCY", "2"))
+	workerPollInterval := getEnvDuration("WORKER_POLL_INTERVAL", 2*time.Second)
+	jobLeaseTimeout := getEnvDuration("JOB_LEASE_TIMEOUT", 2*time.Minute)
+
+	depCacheMaxMB, _ := strconv.ParseInt(getEnv("DEPENDENCY_CACHE_MAX_MB", "10240"), 10, 64)
+	depCacheMaxEntryMB, _ := strconv.ParseInt(getEnv("DEPENDENCY_CACHE_MAX_ENTRY_MB", "1024"), 10, 64)
+
+	sandboxUID, _ := strconv.Atoi(getEnv("SANDBOX_UID", "0"))
+	sandboxGID, _ := strconv.Atoi(getEnv("SANDBOX_GID", "0"))
+
 	return &Config{
 		// Server
 		Port: getEnv("PORT", "8092"),
@@ -99,10 +163,59 @@ func Load() *Config {
 		// Vercel
 		VercelToken: getEnv("VERCEL_TOKEN", ""),
 
+		// Deployment
+		Deployer:           getEnv("DEPLOYER", "vercel"),
+		LocalDeployDir:     getEnv("LOCAL_DEPLOY_DIR", "/tmp/rapidbuild-deployments"),
+		LocalDeployBaseURL: getEnv("LOCAL_DEPLOY_BASE_URL", "http://localhost:8092/deployments"),
+
 		// Workspace
 		WorkspaceDir:   getEnv("WORKSPACE_DIR", "/tmp/rapidbuild-workspaces"),
 		StarterCodeDir: getEnv("STARTER_CODE_DIR", "../../react-app"),
 
+		// Starter templates
+		DefaultStarter:           getEnv("DEFAULT_STARTER", "react"),
+		StarterTemplatesDir:      getEnv("STARTER_TEMPLATES_DIR", ""),
+		StarterTemplatesS3Prefix: getEnv("STARTER_TEMPLATES_S3_PREFIX", ""),
+
+		// Build worker
+		WorkerID:           getEnv("WORKER_ID", ""),
+		EmbeddedWorker:     getEnv("EMBEDDED_WORKER", "true") == "true",
+		WorkerConcurrency:  workerConcurrency,
+		WorkerPollInterval: workerPollInterval,
+		JobLeaseTimeout:    jobLeaseTimeout,
+
+		// Code generation
+		CodeGenerator: getEnv("CODE_GENERATOR", "claude"),
+
+		// Prompt templates
+		PromptTemplate:     getEnv("PROMPT_TEMPLATE", "default"),
+		PromptTemplatesDir: getEnv("PROMPT_TEMPLATES_DIR", ""),
+
+		// Post-build verification
+		VerifyChecks: getEnvList("VERIFY_CHECKS", "test,lint,typecheck,smoke"),
+
+		// Pre-deploy security scan
+		SecurityScan:           getEnv("SECURITY_SCAN", "true") == "true",
+		SecurityBlockSeverity:  getEnv("SECURITY_BLOCK_SEVERITY", "high"),
+		SecurityRuleSeverities: getEnvList("SECURITY_RULE_SEVERITIES", ""),
+
+		// Dependency cache
+		DependencyCache:         getEnv("DEPENDENCY_CACHE", "local"),
+		DependencyCacheDir:      getEnv("DEPENDENCY_CACHE_DIR", "/tmp/rapidbuild-dependency-cache"),
+		DependencyCacheMaxBytes: depCacheMaxMB << 20,
+		DependencyCacheMaxEntry: depCacheMaxEntryMB << 20,
+
+		// Build sandbox
+		Sandbox:              getEnv("SANDBOX", "auto"),
+		SandboxPath:          getEnv("SANDBOX_PATH", "/home/ubuntu/.local/bin:/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/local/bin:/usr/bin:/bin"),
+		SandboxEnvAllowlist:  getEnvList("SANDBOX_ENV_ALLOWLIST", "HOME,USER,LANG,LC_ALL,TZ,TERM"),
+		SandboxWritablePaths: getEnvList("SANDBOX_WRITABLE_PATHS", "/home/ubuntu/.npm"),
+		SandboxAgentPaths:    getEnvList("SANDBOX_AGENT_PATHS", "/home/ubuntu/.claude,/home/ubuntu/.claude.json"),
+		SandboxDeployPaths:   getEnvList("SANDBOX_DEPLOY_PATHS", "/home/ubuntu/.local/share/com.vercel.cli"),
+		SandboxHiddenPaths:   getEnvList("SANDBOX_HIDDEN_PATHS", "/root,/etc/ssl/private,/home/ubuntu/.ssh,/home/ubuntu/.aws,/home/ubuntu/.config,/home/ubuntu/.docker,/home/ubuntu/.netrc,/home/ubuntu/.git-credentials"),
+		SandboxUID:           sandboxUID,
+		SandboxGID:           sandboxGID,
+
 		// Frontend
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5173"),
 
@@ -121,3 +234,29 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList reads a comma-separated list, skipping empty entries
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration reads a positive duration, falling back to defaultValue when
+// the variable is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("[Config] Warning: Invalid %s %q, using %s\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetEnvDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"unset", "", 2 * time.Second},
+		{"valid", "500ms", 500 * time.Millisecond},
+		{"invalid", "soon", 2 * time.Second},
+		{"zero", "0s", 2 * time.Second},
+		{"negative", "-1s", 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION", tt.value)
+			if got := getEnvDuration("TEST_DURATION", 2*time.Second); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
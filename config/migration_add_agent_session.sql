@@ -0,0 +1,10 @@
+-- Migration: Add agent_session to versions
+-- Description: S3 key of the code agent's session (e.g. the Claude session transcript),
+-- stored at apps/{appId}/versions/{versionId}/agent-session.tar.gz next to code.tar.gz.
+-- Builds restore the session of their base version so the agent resumes with the
+-- context of earlier versions. DELETE /apps/{id}/agent-session clears it for all
+-- versions of an app.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS agent_session TEXT;
+
+COMMENT ON COLUMN versions.agent_session IS 'S3 key of the code agent session archive; NULL starts a new session';
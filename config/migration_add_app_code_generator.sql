@@ -0,0 +1,7 @@
+-- Migration: Add code_generator column to apps table
+-- Description: Selects the code generator (claude, fake, ...) used to build an app.
+-- NULL falls back to the CODE_GENERATOR setting of the worker.
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS code_generator TEXT;
+
+COMMENT ON COLUMN apps.code_generator IS 'Code generator used for builds (claude, fake); NULL uses the CODE_GENERATOR setting';
@@ -0,0 +1,6 @@
+-- Migration: Add build cancellation support
+-- Description: Running builds are cancelled by setting cancel_requested; the owning worker
+-- sees the flag on its next heartbeat (or immediately via Redis) and kills the build.
+-- Queued builds move straight to the 'cancelled' status.
+
+ALTER TABLE build_jobs ADD COLUMN IF NOT EXISTS cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+-- Migration: Add failure to versions
+-- Description: Classification of a failed build as {stage, category, retryable,
+-- user_actionable, exit_code}, so clients can tell a user's broken app apart from a
+-- platform or provider outage. NULL for versions that did not fail.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS failure JSONB;
+
+COMMENT ON COLUMN versions.failure IS 'Failure classification of a failed build (stage, category, retryable, user_actionable, exit_code)';
@@ -0,0 +1,26 @@
+-- Migration: Add build_jobs table
+-- Description: Durable build queue consumed by worker.Builder. Jobs are claimed with
+-- SELECT ... FOR UPDATE SKIP LOCKED and kept alive with heartbeats so that builds
+-- interrupted by a deploy or crash are picked up again instead of being lost.
+
+CREATE TABLE IF NOT EXISTS build_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    version_id UUID NOT NULL REFERENCES versions(id) ON DELETE CASCADE,
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'queued',  -- queued, running, completed, failed
+    payload JSONB NOT NULL DEFAULT '{}',    -- requirements, comments, owner email
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    worker_id TEXT,
+    last_error TEXT,
+    heartbeat_at TIMESTAMP WITH TIME ZONE,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Index used by the claim query (oldest queued job first)
+CREATE INDEX IF NOT EXISTS idx_build_jobs_status_created_at ON build_jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_build_jobs_version_id ON build_jobs(version_id);
+CREATE INDEX IF NOT EXISTS idx_build_jobs_app_id ON build_jobs(app_id);
@@ -0,0 +1,11 @@
+-- Migration: Add user plans and per-app build policies
+-- Description: users.plan selects the default build limits (retries, agent, link, build,
+-- verify, deploy and schema timeouts) and the most an app may raise them to. apps.build_policy
+-- holds the app's own overrides as JSON; missing or 0 fields use the plan default.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT 'free';
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS build_policy JSONB;
+
+COMMENT ON COLUMN users.plan IS 'Billing plan (free, pro); sets build policy defaults and limits';
+COMMENT ON COLUMN apps.build_policy IS 'Build policy overrides of the app; NULL or 0 fields use the plan default';
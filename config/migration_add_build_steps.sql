@@ -0,0 +1,18 @@
+-- Migration: Add build_steps table
+-- Description: One row per build stage (workspace setup, link, code generation, each build
+-- and fix attempt, schema setup, deploy, packaging) with timing, status, exit code and a
+-- captured log, so the UI can render the pipeline and slow stages are easy to spot.
+
+CREATE TABLE IF NOT EXISTS build_steps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    version_id UUID NOT NULL REFERENCES versions(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,                       -- workspace_setup, link, code_generation, build, fix, schema_setup, deploy, package
+    attempt INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'running',   -- running, succeeded, failed, cancelled
+    exit_code INTEGER,
+    log TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_build_steps_version_id ON build_steps(version_id, started_at);
@@ -0,0 +1,10 @@
+-- Migration: Add change_plan to versions
+-- Description: Plan-then-approve builds. A version created with plan_first runs a read-only
+-- planning pass of the code agent first; the structured plan (summary, approach, files to
+-- touch, new dependencies) is stored here and the version waits in status
+-- 'awaiting_approval' until the user approves, edits or rejects it. NULL for versions built
+-- without a plan.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS change_plan JSONB;
+
+COMMENT ON COLUMN versions.change_plan IS 'Change plan of a plan-first build and the user''s decision; NULL when built without a plan';
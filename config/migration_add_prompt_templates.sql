@@ -0,0 +1,24 @@
+-- Migration: Add prompt templates and per-app prompt settings
+-- Description: prompt_templates holds text/template prompt templates by name and version,
+-- in addition to the ones built into the binary and PROMPT_TEMPLATES_DIR. Apps pick a
+-- template ("name" for its latest version or "name@version"; NULL uses PROMPT_TEMPLATE)
+-- and carry custom instructions injected into every build. Versions record the template
+-- version their code was generated with.
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL CHECK (version > 0),
+    generate_template TEXT NOT NULL,  -- Code generation prompt
+    fix_template TEXT NOT NULL,       -- Build error fix prompt
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (name, version)
+);
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS prompt_template TEXT;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS custom_instructions TEXT;
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS prompt_template TEXT;
+
+COMMENT ON COLUMN apps.prompt_template IS 'Prompt template of the app''s builds ("name" or "name@version"); NULL uses the default';
+COMMENT ON COLUMN apps.custom_instructions IS 'Instructions injected into every code generation and fix prompt of the app';
+COMMENT ON COLUMN versions.prompt_template IS 'Prompt template version the build used, e.g. default@1';
@@ -0,0 +1,9 @@
+-- Migration: Add security_findings to versions
+-- Description: Findings of the pre-deploy security scan of the generated code and built
+-- output (hardcoded secrets, dangerous code, credentials in client bundles, files that must
+-- not be shipped), as a JSON array. Findings at or above SECURITY_BLOCK_SEVERITY blocked the
+-- deploy and have "blocking": true. NULL when the version was not scanned.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS security_findings JSONB;
+
+COMMENT ON COLUMN versions.security_findings IS 'Pre-deploy security scan findings; NULL when not scanned';
@@ -0,0 +1,12 @@
+-- Migration: Add starter templates to apps and versions
+-- Description: New apps are generated from a starter picked from the starter registry
+-- (STARTER_TEMPLATES_DIR, STARTER_TEMPLATES_S3_PREFIX and the built-in STARTER_CODE_DIR):
+-- chosen when the app is created, or inferred from the category extracted from its
+-- description. Versions record the starter revision their app was born from and the hash
+-- of its files.
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS starter_template TEXT;
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS starter JSONB;
+
+COMMENT ON COLUMN apps.starter_template IS 'Starter the app is generated from ("name" or "name@version"); NULL until picked';
+COMMENT ON COLUMN versions.starter IS 'Starter revision the app''s code was born from (name, version, hash, source), carried over from the base version';
@@ -0,0 +1,26 @@
+-- Migration: Add usage_events
+-- Description: One row per call to an AI provider: code generation and each fix attempt
+-- of a build (Claude), app config extraction (Gemini) and logo generation (Runware), with
+-- tokens, cost and turns. Rows keep counting towards the user's totals after the app or
+-- version is deleted.
+
+CREATE TABLE IF NOT EXISTS usage_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id UUID REFERENCES apps(id) ON DELETE SET NULL,
+    version_id UUID REFERENCES versions(id) ON DELETE SET NULL,  -- NULL for app setup (config, logo)
+    provider TEXT NOT NULL,   -- claude, gemini, runware
+    operation TEXT NOT NULL,  -- generate, fix, app_config, logo
+    model TEXT,
+    attempt INTEGER NOT NULL DEFAULT 0,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    turns INTEGER NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_user_id ON usage_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_events_app_id ON usage_events(app_id);
+CREATE INDEX IF NOT EXISTS idx_usage_events_version_id ON usage_events(version_id);
@@ -0,0 +1,8 @@
+-- Migration: Add verification_results to versions
+-- Description: Results of the post-build checks (npm test, lint, type checking) of the
+-- version's last verification run, as a JSON array of {check, command, status, exit_code,
+-- attempt, duration_ms, output}. Failed checks are sent to the code generator to fix.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS verification_results JSONB;
+
+COMMENT ON COLUMN versions.verification_results IS 'Post-build check results of the last verification run (test, lint, typecheck)';
@@ -0,0 +1,12 @@
+-- Migration: Add base_version_id and retry_of_version_id to versions
+-- Description: base_version_id records the version whose code a build started from
+-- (NULL for starter code), so a retry can start from the same code.
+-- retry_of_version_id links a version created by POST .../versions/{id}/retry to the
+-- failed or cancelled version it rebuilds. Failed builds now also store their generated
+-- code in s3_code_path so they can be retried without generating it again.
+
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS base_version_id UUID REFERENCES versions(id) ON DELETE SET NULL;
+ALTER TABLE versions ADD COLUMN IF NOT EXISTS retry_of_version_id UUID REFERENCES versions(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN versions.base_version_id IS 'Version whose code the build started from; NULL for starter code';
+COMMENT ON COLUMN versions.retry_of_version_id IS 'Failed or cancelled version this version retries';
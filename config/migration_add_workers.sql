@@ -0,0 +1,17 @@
+-- Migration: Add workers table
+-- Description: Registry of build worker processes (cmd/server embedded worker and cmd/worker).
+-- Workers upsert their row on startup and refresh last_seen_at while running, so the API
+-- can show which worker owns a build and whether that worker is still alive.
+
+CREATE TABLE IF NOT EXISTS workers (
+    id TEXT PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    pid INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',  -- running, stopped
+    concurrency INTEGER NOT NULL DEFAULT 1,
+    active_jobs INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_workers_last_seen_at ON workers(last_seen_at);
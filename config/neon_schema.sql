@@ -87,6 +87,79 @@ CREATE TABLE IF NOT EXISTS requirement_files (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Build jobs table (durable build queue)
+CREATE TABLE IF NOT EXISTS build_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    version_id UUID NOT NULL REFERENCES versions(id) ON DELETE CASCADE,
+    app_id UUID NOT NULL REFERENCES apps(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'queued',
+    payload JSONB NOT NULL DEFAULT '{}',
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    worker_id TEXT,
+    last_error TEXT,
+    heartbeat_at TIMESTAMP WITH TIME ZONE,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Build steps table (per-stage timing, status and logs of a build)
+CREATE TABLE IF NOT EXISTS build_steps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    version_id UUID NOT NULL REFERENCES versions(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    attempt INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'running',
+    exit_code INTEGER,
+    log TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Workers table (build worker registry)
+CREATE TABLE IF NOT EXISTS workers (
+    id TEXT PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    pid INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    concurrency INTEGER NOT NULL DEFAULT 1,
+    active_jobs INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Prompt templates table (in addition to the built-in and PROMPT_TEMPLATES_DIR templates)
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL CHECK (version > 0),
+    generate_template TEXT NOT NULL,
+    fix_template TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (name, version)
+);
+
+-- Usage events table (tokens and cost of each call to an AI provider)
+CREATE TABLE IF NOT EXISTS usage_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id UUID REFERENCES apps(id) ON DELETE SET NULL,
+    version_id UUID REFERENCES versions(id) ON DELETE SET NULL,
+    provider TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    model TEXT,
+    attempt INTEGER NOT NULL DEFAULT 0,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    turns INTEGER NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- Indexes for users
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id);
@@ -121,6 +194,22 @@ CREATE INDEX IF NOT EXISTS idx_comments_status ON comments(status);
 CREATE INDEX IF NOT EXISTS idx_requirement_files_app_id ON requirement_files(app_id);
 CREATE INDEX IF NOT EXISTS idx_requirement_files_version_id ON requirement_files(version_id);
 
+-- Indexes for build jobs
+CREATE INDEX IF NOT EXISTS idx_build_jobs_status_created_at ON build_jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_build_jobs_version_id ON build_jobs(version_id);
+CREATE INDEX IF NOT EXISTS idx_build_jobs_app_id ON build_jobs(app_id);
+
+-- Indexes for build_steps
+CREATE INDEX IF NOT EXISTS idx_build_steps_version_id ON build_steps(version_id, started_at);
+
+-- Indexes for workers
+CREATE INDEX IF NOT EXISTS idx_workers_last_seen_at ON workers(last_seen_at);
+
+-- Indexes for usage events
+CREATE INDEX IF NOT EXISTS idx_usage_events_user_id ON usage_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_events_app_id ON usage_events(app_id);
+CREATE INDEX IF NOT EXISTS idx_usage_events_version_id ON usage_events(version_id);
+
 -- Cleanup function for expired tokens (optional - can be run periodically)
 CREATE OR REPLACE FUNCTION cleanup_expired_tokens()
 RETURNS void AS $$
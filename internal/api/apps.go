@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -13,23 +15,41 @@ import (
 )
 
 type AppHandler struct {
-	AppService     *services.AppService
-	VersionService *services.VersionService
-	CommentService *services.CommentService
-	Builder        *worker.Builder
+	AppService         *services.AppService
+	VersionService     *services.VersionService
+	CommentService     *services.CommentService
+	JobService         *services.JobService
+	WorkerService      *services.WorkerService
+	BuildStepService   *services.BuildStepService
+	BuildLogService    *services.BuildLogService
+	BuildPolicyService *services.BuildPolicyService
+	PromptService      *services.PromptTemplateService
+	Builder            *worker.Builder
 }
 
 func NewAppHandler(
 	appService *services.AppService,
 	versionService *services.VersionService,
 	commentService *services.CommentService,
+	jobService *services.JobService,
+	workerService *services.WorkerService,
+	buildStepService *services.BuildStepService,
+	buildLogService *services.BuildLogService,
+	buildPolicyService *services.BuildPolicyService,
+	promptService *services.PromptTemplateService,
 	builder *worker.Builder,
 ) *AppHandler {
 	return &AppHandler{
-		AppService:     appService,
-		VersionService: versionService,
-		CommentService: commentService,
-		Builder:        builder,
+		AppService:         appService,
+		VersionService:     versionService,
+		CommentService:     commentService,
+		JobService:         jobService,
+		WorkerService:      workerService,
+		BuildStepService:   buildStepService,
+		BuildLogService:    buildLogService,
+		BuildPolicyService: buildPolicyService,
+		PromptService:      promptService,
+		Builder:            builder,
 	}
 }
 
@@ -47,6 +67,20 @@ func (h *AppHandler) CreateApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Starter != "" {
+		if _, err := h.AppService.StarterService.GetStarter(r.Context(), req.Starter); err != nil {
+			middleware.RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Get owner email for build process (fast query, ~10ms)
+	ownerEmail, err := h.AppService.GetOwnerEmail(r.Context(), user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, "Failed to get owner email")
+		return
+	}
+
 	// Create app (fast - only PostgreSQL, ~50ms)
 	app, err := h.AppService.CreateApp(r.Context(), user.Sub, req)
 	if err != nil {
@@ -55,23 +89,28 @@ func (h *AppHandler) CreateApp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create initial version with requirements (fast - only PostgreSQL, ~50ms)
-	version, err := h.VersionService.CreateVersion(r.Context(), app.ID, &req.Requirements)
+	version, err := h.VersionService.CreateVersion(r.Context(), app.ID, &req.Requirements, nil)
 	if err != nil {
 		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Get owner email for build process (fast query, ~10ms)
-	ownerEmail, err := h.AppService.GetOwnerEmail(r.Context(), user.Sub)
+	// Enqueue the build; a worker picks it up from the build queue
+	// Build assumes MongoDB will be created by async setup process
+	_, err = h.JobService.EnqueueBuild(r.Context(), version.ID, app.ID, models.BuildJobPayload{
+		Requirements: req.Requirements,
+		OwnerEmail:   ownerEmail,
+		PlanFirst:    req.PlanFirst,
+	})
 	if err != nil {
-		middleware.RespondError(w, http.StatusInternalServerError, "Failed to get owner email")
+		h.failUnqueuedVersion(r.Context(), version.ID, err)
+		if _, appErr := h.AppService.UpdateApp(context.WithoutCancel(r.Context()), app.ID, user.Sub, map[string]interface{}{"status": "error"}); appErr != nil {
+			log.Printf("[App] Warning: Failed to update app status: %v\n", appErr)
+		}
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Start build process immediately in background (non-blocking)
-	// Build assumes MongoDB will be created by async setup process
-	go h.Builder.BuildApp(context.Background(), version.ID, app.ID, req.Requirements, nil, ownerEmail)
-
 	// Return response immediately (~100ms total)
 	middleware.RespondJSON(w, http.StatusCreated, map[string]interface{}{
 		"app":     app,
@@ -134,3 +173,202 @@ func (h *AppHandler) DeleteApp(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ResetAgentSession handles DELETE /apps/{id}/agent-session. The agent
+// forgets earlier versions and the next build starts a new session.
+func (h *AppHandler) ResetAgentSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	if err := h.VersionService.ResetAgentSessions(r.Context(), appID); err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBuildPolicy handles GET /apps/{id}/build-policy
+func (h *AppHandler) GetBuildPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	policy, err := h.BuildPolicyService.GetBuildPolicy(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, policy)
+}
+
+// UpdateBuildPolicy handles PUT /apps/{id}/build-policy. The body replaces the
+// app's overrides; omitted or 0 fields use the plan default.
+func (h *AppHandler) UpdateBuildPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	var overrides models.BuildPolicy
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	current, err := h.BuildPolicyService.GetBuildPolicy(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := services.ValidateBuildPolicy(current.Plan, overrides); err != nil {
+		middleware.RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.BuildPolicyService.UpdateBuildPolicy(r.Context(), appID, overrides); err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	policy, err := h.BuildPolicyService.GetBuildPolicy(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, policy)
+}
+
+// GetPromptSettings handles GET /apps/{id}/prompt-settings
+func (h *AppHandler) GetPromptSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	h.respondPromptSettings(w, r, appID)
+}
+
+// UpdatePromptSettings handles PUT /apps/{id}/prompt-settings. The body
+// replaces the app's prompt template and custom instructions; a null
+// prompt_template uses the default template.
+func (h *AppHandler) UpdatePromptSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	var settings models.AppPromptSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(settings.CustomInstructions) > services.MaxCustomInstructions {
+		middleware.RespondError(w, http.StatusBadRequest, fmt.Sprintf("custom_instructions may be at most %d characters", services.MaxCustomInstructions))
+		return
+	}
+	if settings.PromptTemplate != nil && *settings.PromptTemplate == "" {
+		settings.PromptTemplate = nil
+	}
+	if settings.PromptTemplate != nil {
+		if _, err := h.PromptService.GetTemplate(r.Context(), *settings.PromptTemplate); err != nil {
+			middleware.RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := h.PromptService.UpdatePromptSettings(r.Context(), appID, settings); err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondPromptSettings(w, r, appID)
+}
+
+// respondPromptSettings responds with the app's prompt settings and the template version new builds use
+func (h *AppHandler) respondPromptSettings(w http.ResponseWriter, r *http.Request, appID string) {
+	settings, err := h.PromptService.GetPromptSettings(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if tmpl, err := h.PromptService.GetTemplate(r.Context(), h.PromptService.TemplateRef(settings)); err == nil {
+		settings.Template = tmpl.Ref()
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, settings)
+}
+
+// ListPromptTemplates handles GET /prompt-templates
+func (h *AppHandler) ListPromptTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.PromptService.ListTemplates(r.Context())
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, templates)
+}
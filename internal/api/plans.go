@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rapidbuildapp/rapidbuild/internal/middleware"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// GetPlan handles GET /apps/{appId}/versions/{versionId}/plan
+func (h *AppHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.planVersion(w, r, false)
+	if !ok {
+		return
+	}
+
+	if version.ChangePlan == nil {
+		middleware.RespondError(w, http.StatusNotFound, "Version has no change plan")
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, version.ChangePlan)
+}
+
+// UpdatePlan handles PUT /apps/{appId}/versions/{versionId}/plan, replacing
+// the proposed plan of a version awaiting approval with the user's edit
+func (h *AppHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.planVersion(w, r, true)
+	if !ok {
+		return
+	}
+
+	var plan models.ChangePlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := services.ValidateChangePlan(&plan); err != nil {
+		middleware.RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.Builder.EditPlan(r.Context(), version, plan)
+	if err != nil {
+		middleware.RespondError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, updated)
+}
+
+// ApprovePlan handles POST /apps/{appId}/versions/{versionId}/plan/approve.
+// The body may carry an edited plan to approve instead of the proposed one.
+func (h *AppHandler) ApprovePlan(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.planVersion(w, r, true)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req models.ApprovePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Plan != nil {
+		if err := services.ValidateChangePlan(req.Plan); err != nil {
+			middleware.RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if _, err := h.Builder.ApprovePlan(r.Context(), version, req.Plan); err != nil {
+		middleware.RespondError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), version.ID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusAccepted, version)
+}
+
+// RejectPlan handles POST /apps/{appId}/versions/{versionId}/plan/reject. The
+// version is cancelled; retrying it plans again.
+func (h *AppHandler) RejectPlan(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.planVersion(w, r, true)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req models.RejectPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Builder.RejectPlan(r.Context(), version, req.Feedback); err != nil {
+		middleware.RespondError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), version.ID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, version)
+}
+
+// planVersion loads the version of a plan request after checking that the
+// user owns its app. With awaitingApproval, versions whose plan was already
+// decided are rejected with 409.
+func (h *AppHandler) planVersion(w http.ResponseWriter, r *http.Request, awaitingApproval bool) (*models.Version, bool) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return nil, false
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return nil, false
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil || version.AppID != appID {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return nil, false
+	}
+
+	if awaitingApproval && version.Status != "awaiting_approval" {
+		middleware.RespondError(w, http.StatusConflict, "Version is not awaiting plan approval (status '"+version.Status+"')")
+		return nil, false
+	}
+
+	return version, true
+}
@@ -50,12 +50,14 @@ func (h *AppHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if version is already completed/failed
-	if version.Status == "completed" || version.Status == "failed" {
-		data, _ := json.Marshal(map[string]string{
-			"version_id": versionID,
-			"status":     version.Status,
-			"message":    "Build " + version.Status,
+	// Check if version is already completed/failed/cancelled or waiting for plan approval
+	if isFinalBuildStatus(version.Status) {
+		data, _ := json.Marshal(models.BuildProgress{
+			VersionID: versionID,
+			Status:    version.Status,
+			Message:   "Build " + version.Status,
+			Failure:   version.Failure,
+			Timestamp: time.Now(),
 		})
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
@@ -124,6 +126,16 @@ func (h *AppHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			// Subprocess output is forwarded as a typed "log" event
+			var envelope struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal([]byte(msg.Payload), &envelope); err == nil && envelope.Type == models.BuildEventLog {
+				fmt.Fprintf(w, "event: log\ndata: %s\n\n", msg.Payload)
+				flusher.Flush()
+				continue
+			}
+
 			// Parse progress message
 			var progress models.BuildProgress
 			if err := json.Unmarshal([]byte(msg.Payload), &progress); err != nil {
@@ -136,11 +148,17 @@ func (h *AppHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
 
-			// Close connection when build is complete or failed
-			if progress.Status == "completed" || progress.Status == "failed" {
+			// Close connection when build is complete, failed, cancelled or waiting for plan approval
+			if isFinalBuildStatus(progress.Status) {
 				log.Printf("[SSE] Build %s for version %s\n", progress.Status, versionID)
 				return
 			}
 		}
 	}
 }
+
+// isFinalBuildStatus reports whether no further progress events follow this
+// status. Approving a plan starts a new stream of events.
+func isFinalBuildStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled" || status == "awaiting_approval"
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/middleware"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+type StarterHandler struct {
+	StarterService *services.StarterService
+}
+
+func NewStarterHandler(starterService *services.StarterService) *StarterHandler {
+	return &StarterHandler{
+		StarterService: starterService,
+	}
+}
+
+// ListStarters handles GET /starters, listing every starter revision apps can be created from
+func (h *StarterHandler) ListStarters(w http.ResponseWriter, r *http.Request) {
+	starters, err := h.StarterService.ListStarters(r.Context())
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, starters)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rapidbuildapp/rapidbuild/internal/middleware"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+type UsageHandler struct {
+	AppService   *services.AppService
+	UsageService *services.UsageService
+}
+
+func NewUsageHandler(appService *services.AppService, usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{
+		AppService:   appService,
+		UsageService: usageService,
+	}
+}
+
+// GetAppUsage handles GET /apps/{id}/usage
+func (h *UsageHandler) GetAppUsage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["id"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	usage, err := h.UsageService.GetAppUsage(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, usage)
+}
+
+// GetUserUsage handles GET /usage, the usage of all apps of the current user
+func (h *UsageHandler) GetUserUsage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	usage, err := h.UsageService.GetUserUsage(r.Context(), user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, usage)
+}
@@ -3,11 +3,16 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/rapidbuildapp/rapidbuild/internal/middleware"
 	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
 )
 
 // ListVersions handles GET /apps/{appId}/versions
@@ -37,6 +42,33 @@ func (h *AppHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
 	middleware.RespondJSON(w, http.StatusOK, versions)
 }
 
+// GetVersionTree handles GET /apps/{appId}/versions/tree
+func (h *AppHandler) GetVersionTree(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	tree, err := h.VersionService.GetVersionTree(r.Context(), appID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, tree)
+}
+
 // GetVersion handles GET /apps/{appId}/versions/{versionId}
 func (h *AppHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
@@ -65,6 +97,47 @@ func (h *AppHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
 	middleware.RespondJSON(w, http.StatusOK, version)
 }
 
+// GetSecurityFindings handles GET /apps/{appId}/versions/{versionId}/security,
+// the findings of the version's pre-deploy security scan
+func (h *AppHandler) GetSecurityFindings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil || version.AppID != appID {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	report := models.SecurityReport{
+		VersionID:  version.ID,
+		Scanned:    version.SecurityFindings != nil,
+		BySeverity: map[string]int{},
+		Findings:   []models.SecurityFinding{},
+	}
+	for _, finding := range version.SecurityFindings {
+		report.BySeverity[finding.Severity]++
+		report.Blocked = report.Blocked || finding.Blocking
+		report.Findings = append(report.Findings, finding)
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, report)
+}
+
 // CreateVersion handles POST /apps/{appId}/versions
 func (h *AppHandler) CreateVersion(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
@@ -89,8 +162,23 @@ func (h *AppHandler) CreateVersion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Branch from a completed version of this app instead of the latest one
+	payload := models.BuildJobPayload{}
+	if req.BaseVersionID != nil {
+		base, err := h.VersionService.GetVersion(r.Context(), *req.BaseVersionID)
+		if err != nil || base.AppID != appID {
+			middleware.RespondError(w, http.StatusBadRequest, "Base version not found")
+			return
+		}
+		if base.Status != "completed" || base.S3CodePath == nil || *base.S3CodePath == "" {
+			middleware.RespondError(w, http.StatusBadRequest, fmt.Sprintf("Base version %d has no completed build to branch from", base.VersionNumber))
+			return
+		}
+		payload.BaseVersionID = base.ID
+	}
+
 	// Create version
-	version, err := h.VersionService.CreateVersion(r.Context(), appID, nil)
+	version, err := h.VersionService.CreateVersion(r.Context(), appID, nil, req.BaseVersionID)
 	if err != nil {
 		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -110,14 +198,355 @@ func (h *AppHandler) CreateVersion(w http.ResponseWriter, r *http.Request) {
 		comments, _ = h.CommentService.GetVersionComments(r.Context(), version.ID)
 	}
 
-	// Start build process in background
-	// Use context.Background() instead of r.Context() so the build continues even after HTTP response
-	// Pass empty string for ownerEmail since admin user was created during app creation
-	go h.Builder.BuildApp(context.Background(), version.ID, appID, "", comments, "")
+	// Enqueue the build; a worker picks it up from the build queue
+	// Empty ownerEmail since admin user was created during app creation
+	payload.Comments = comments
+	payload.PlanFirst = req.PlanFirst
+	_, err = h.JobService.EnqueueBuild(r.Context(), version.ID, appID, payload)
+	if err != nil {
+		h.failUnqueuedVersion(r.Context(), version.ID, err)
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	middleware.RespondJSON(w, http.StatusCreated, version)
 }
 
+// RetryVersion handles POST /apps/{appId}/versions/{versionId}/retry
+// It creates a new version that rebuilds a failed or cancelled version with the
+// same requirements and comments. Mode "full" (default) generates the code again
+// from the same base version; "build" reuses the generated code and only builds
+// and deploys it.
+func (h *AppHandler) RetryVersion(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	// The body is optional
+	var req models.RetryVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = models.RetryModeFull
+	}
+	if req.Mode != models.RetryModeFull && req.Mode != models.RetryModeBuild {
+		middleware.RespondError(w, http.StatusBadRequest, "mode must be \"full\" or \"build\"")
+		return
+	}
+
+	original, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil || original.AppID != appID {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	if original.Status != "failed" && original.Status != "cancelled" {
+		middleware.RespondError(w, http.StatusConflict, fmt.Sprintf("Cannot retry version with status '%s'", original.Status))
+		return
+	}
+
+	// Reuse the inputs of the original build; versions built before the queue have no job
+	payload := models.BuildJobPayload{}
+	if job, err := h.JobService.GetLatestJobForVersion(r.Context(), original.ID); err == nil {
+		payload = job.Payload
+	} else {
+		if original.Requirements != nil {
+			payload.Requirements = *original.Requirements
+		}
+		payload.Comments, _ = h.CommentService.GetVersionComments(r.Context(), original.ID)
+	}
+
+	switch req.Mode {
+	case models.RetryModeBuild:
+		// The code generated for the original is stored when its build fails
+		if original.S3CodePath == nil || *original.S3CodePath == "" {
+			middleware.RespondError(w, http.StatusConflict, "Version has no generated code to rebuild, retry with mode \"full\"")
+			return
+		}
+		payload.BaseVersionID = original.ID
+		payload.SkipCodeGeneration = true
+	default:
+		// Start from the code the original started from. Without a recorded base
+		// (starter code, or cancelled before the workspace was set up) the build
+		// starts from the latest completed version like any new version.
+		payload.BaseVersionID = ""
+		if original.BaseVersionID != nil {
+			payload.BaseVersionID = *original.BaseVersionID
+		}
+		payload.SkipCodeGeneration = false
+	}
+
+	var baseVersionID *string
+	if payload.BaseVersionID != "" {
+		baseVersionID = &payload.BaseVersionID
+	}
+	version, err := h.VersionService.CreateRetryVersion(r.Context(), original, baseVersionID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	_, err = h.JobService.EnqueueBuild(r.Context(), version.ID, appID, payload)
+	if err != nil {
+		h.failUnqueuedVersion(r.Context(), version.ID, err)
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusCreated, version)
+}
+
+// failUnqueuedVersion fails a version whose build could not be queued, so it
+// does not stay pending without a job and can be retried
+func (h *AppHandler) failUnqueuedVersion(ctx context.Context, versionID string, err error) {
+	if failErr := h.VersionService.FailUnqueuedVersion(context.WithoutCancel(ctx), versionID, err); failErr != nil {
+		log.Printf("[Version] Warning: Failed to mark unqueued version %s as failed: %v\n", versionID, failErr)
+	}
+}
+
+// GetBuildStatus handles GET /apps/{appId}/versions/{versionId}/build
+func (h *AppHandler) GetBuildStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil || version.AppID != appID {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	job, err := h.JobService.GetLatestJobForVersion(r.Context(), version.ID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "Build not found")
+		return
+	}
+
+	status := models.BuildStatus{Job: job}
+
+	// Builds of the same app run one at a time; report which version this one waits on
+	blocking, err := h.JobService.GetBlockingVersion(r.Context(), job)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if blocking != nil {
+		status.QueuedBehindVersion = blocking
+		status.Message = fmt.Sprintf("Queued behind version %d", *blocking)
+	}
+
+	// Attach the owning worker so the UI can show where the build runs and whether it is alive
+	if job.WorkerID != nil {
+		worker, err := h.WorkerService.GetWorker(r.Context(), *job.WorkerID, h.Builder.Config.JobLeaseTimeout)
+		if err == nil {
+			status.Worker = worker
+		}
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, status)
+}
+
+// CancelBuild handles POST /apps/{appId}/versions/{versionId}/cancel
+func (h *AppHandler) CancelBuild(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	appID := vars["appId"]
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	_, err := h.AppService.GetApp(r.Context(), appID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil || version.AppID != appID {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	job, err := h.Builder.CancelBuild(r.Context(), version.ID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Running builds stop asynchronously; the SSE stream emits the final "cancelled" event
+	status := "cancelling"
+	if job.Status == "cancelled" {
+		status = "cancelled"
+	}
+
+	middleware.RespondJSON(w, http.StatusAccepted, map[string]string{"status": status})
+}
+
+// ListBuildSteps handles GET /versions/{versionId}/steps
+func (h *AppHandler) ListBuildSteps(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	_, err = h.AppService.GetApp(r.Context(), version.AppID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	steps, err := h.BuildStepService.ListSteps(r.Context(), versionID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, steps)
+}
+
+// GetStepLog handles GET /versions/{versionId}/steps/{stepId}/log
+func (h *AppHandler) GetStepLog(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	versionID := vars["versionId"]
+	stepID := vars["stepId"]
+
+	// Verify user owns the app
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	_, err = h.AppService.GetApp(r.Context(), version.AppID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	stepLog, err := h.BuildStepService.GetStepLog(r.Context(), versionID, stepID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "Build step not found")
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"step_id": stepID,
+		"log":     stepLog,
+	})
+}
+
+// GetBuildLogs handles GET /versions/{versionId}/logs?offset=&limit=&tail=
+// offset and limit select a byte range of the full log; tail returns the last
+// tail bytes instead. next_offset in the response continues reading.
+func (h *AppHandler) GetBuildLogs(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		middleware.RespondError(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	versionID := vars["versionId"]
+
+	// Verify user owns the app
+	version, err := h.VersionService.GetVersion(r.Context(), versionID)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+
+	_, err = h.AppService.GetApp(r.Context(), version.AppID, user.Sub)
+	if err != nil {
+		middleware.RespondError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	query := r.URL.Query()
+	offset, err := parseInt64Param(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid offset")
+		return
+	}
+	limit, err := parseInt64Param(query.Get("limit"), services.MaxBuildLogRead)
+	if err != nil || limit <= 0 {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	tail, err := parseInt64Param(query.Get("tail"), 0)
+	if err != nil || tail < 0 {
+		middleware.RespondError(w, http.StatusBadRequest, "Invalid tail")
+		return
+	}
+	if tail > 0 {
+		offset, limit = -tail, tail
+	}
+
+	page, err := h.BuildLogService.ReadLog(r.Context(), version.AppID, versionID, offset, limit)
+	if err != nil {
+		middleware.RespondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondJSON(w, http.StatusOK, page)
+}
+
+// parseInt64Param parses an optional integer query parameter
+func parseInt64Param(value string, defaultValue int64) (int64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
 // PromoteVersion handles POST /apps/{appId}/versions/{versionId}/promote
 func (h *AppHandler) PromoteVersion(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
@@ -0,0 +1,88 @@
+// Package appmanager manages the MongoDB side of generated apps: the app
+// records in system_db.apps, the owner's admin account in system_db.app_users
+// and the collection schemas of each app's own database.
+package appmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Manager creates and updates apps and applies their schemas. Every operation
+// is idempotent, so a failed or repeated call can simply be retried.
+type Manager interface {
+	// CreateApp creates the app and its owner's admin account, or updates the
+	// name and owner of an app that already exists
+	CreateApp(ctx context.Context, appID, name, ownerEmail string) (*App, error)
+	// UpdateApp updates the name and logo of an existing app
+	UpdateApp(ctx context.Context, appID string, update AppUpdate) (*App, error)
+	// ApplySchemas creates the app's collections with their schemas as
+	// validators, or replaces the validators of existing collections
+	ApplySchemas(ctx context.Context, appID string, schemas []Schema) (*SchemaResult, error)
+}
+
+// App is an app record in system_db.apps
+type App struct {
+	ID           string    `bson:"_id"`
+	Name         string    `bson:"name"`
+	DatabaseName string    `bson:"databaseName"`
+	OwnerEmail   string    `bson:"ownerEmail"`
+	Logo         string    `bson:"logo,omitempty"`
+	Collections  []string  `bson:"collections,omitempty"`
+	CreatedAt    time.Time `bson:"createdAt"`
+	UpdatedAt    time.Time `bson:"updatedAt"`
+}
+
+// AppUpdate holds the fields UpdateApp changes; nil fields are left as they are
+type AppUpdate struct {
+	Name *string
+	Logo *string
+}
+
+// SchemaResult lists the collections ApplySchemas created and updated
+type SchemaResult struct {
+	Created []string
+	Updated []string
+}
+
+var (
+	// ErrAppNotFound is returned for apps that have no record in system_db.apps
+	ErrAppNotFound = errors.New("app not found")
+	// ErrInvalidApp is returned for a missing app ID, name or owner email
+	ErrInvalidApp = errors.New("invalid app")
+)
+
+// SchemaError reports a schema file that cannot be applied
+type SchemaError struct {
+	Collection string
+	File       string
+	Err        error
+}
+
+func (e *SchemaError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("invalid schema %s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("invalid schema for collection %s: %v", e.Collection, e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// OpError reports a failed MongoDB operation on an app
+type OpError struct {
+	Op    string
+	AppID string
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("failed to %s for app %s: %v", e.Op, e.AppID, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,119 @@
+package appmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryManager is an in-memory Manager for tests and offline runs. It follows
+// the MongoManager semantics without a database.
+type MemoryManager struct {
+	mu      sync.Mutex
+	apps    map[string]*App
+	owners  map[string]map[string]bool   // App ID -> owner emails with an admin account
+	schemas map[string]map[string]Schema // App ID -> collection -> schema
+}
+
+func NewMemoryManager() *MemoryManager {
+	return &MemoryManager{
+		apps:    make(map[string]*App),
+		owners:  make(map[string]map[string]bool),
+		schemas: make(map[string]map[string]Schema),
+	}
+}
+
+func (m *MemoryManager) CreateApp(ctx context.Context, appID, name, ownerEmail string) (*App, error) {
+	ownerEmail = strings.TrimSpace(ownerEmail)
+	if appID == "" || name == "" || ownerEmail == "" {
+		return nil, fmt.Errorf("%w: app ID, name and owner email are required", ErrInvalidApp)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	app, ok := m.apps[appID]
+	if !ok {
+		app = &App{ID: appID, DatabaseName: DatabaseName(appID), CreatedAt: now}
+		m.apps[appID] = app
+		m.owners[appID] = make(map[string]bool)
+	}
+	app.Name = name
+	app.OwnerEmail = ownerEmail
+	app.UpdatedAt = now
+	m.owners[appID][ownerEmail] = true
+
+	return copyApp(app), nil
+}
+
+func (m *MemoryManager) UpdateApp(ctx context.Context, appID string, update AppUpdate) (*App, error) {
+	if update.Name != nil && *update.Name == "" {
+		return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidApp)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.apps[appID]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	if update.Name != nil {
+		app.Name = *update.Name
+	}
+	if update.Logo != nil {
+		app.Logo = *update.Logo
+	}
+	app.UpdatedAt = time.Now().UTC()
+
+	return copyApp(app), nil
+}
+
+func (m *MemoryManager) ApplySchemas(ctx context.Context, appID string, schemas []Schema) (*SchemaResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.apps[appID]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	if m.schemas[appID] == nil {
+		m.schemas[appID] = make(map[string]Schema)
+	}
+
+	result := &SchemaResult{Created: []string{}, Updated: []string{}}
+	for _, schema := range schemas {
+		if _, exists := m.schemas[appID][schema.Collection]; exists {
+			result.Updated = append(result.Updated, schema.Collection)
+		} else {
+			result.Created = append(result.Created, schema.Collection)
+			app.Collections = append(app.Collections, schema.Collection)
+		}
+		m.schemas[appID][schema.Collection] = schema
+	}
+	return result, nil
+}
+
+func copyApp(app *App) *App {
+	copied := *app
+	copied.Collections = append([]string(nil), app.Collections...)
+	return &copied
+}
+
+// HasOwner reports whether the app has an admin account for ownerEmail
+func (m *MemoryManager) HasOwner(appID, ownerEmail string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owners[appID][ownerEmail]
+}
+
+// Schema returns the schema applied to a collection of the app
+func (m *MemoryManager) Schema(appID, collection string) (Schema, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schema, ok := m.schemas[appID][collection]
+	return schema, ok
+}
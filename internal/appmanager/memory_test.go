@@ -0,0 +1,137 @@
+package appmanager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryManagerCreateApp(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+
+	first, err := m.CreateApp(ctx, "a1b2-c3", "Todo", "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.DatabaseName != "app_a1b2_c3" {
+		t.Errorf("database = %q, want app_a1b2_c3", first.DatabaseName)
+	}
+
+	// Creating again updates the name and keeps the database and creation time
+	second, err := m.CreateApp(ctx, "a1b2-c3", "Todo v2", " second@example.com ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Name != "Todo v2" || second.OwnerEmail != "second@example.com" {
+		t.Errorf("app not updated: %+v", second)
+	}
+	if second.DatabaseName != first.DatabaseName || !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("database or creation time changed: %+v", second)
+	}
+	for _, owner := range []string{"owner@example.com", "second@example.com"} {
+		if !m.HasOwner("a1b2-c3", owner) {
+			t.Errorf("%s has no admin account", owner)
+		}
+	}
+
+	invalid := []struct{ appID, name, owner string }{
+		{"", "Todo", "owner@example.com"},
+		{"app", "", "owner@example.com"},
+		{"app", "Todo", "  "},
+	}
+	for _, tt := range invalid {
+		if _, err := m.CreateApp(ctx, tt.appID, tt.name, tt.owner); !errors.Is(err, ErrInvalidApp) {
+			t.Errorf("CreateApp(%q, %q, %q) = %v, want ErrInvalidApp", tt.appID, tt.name, tt.owner, err)
+		}
+	}
+}
+
+func TestMemoryManagerUpdateApp(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	if _, err := m.CreateApp(ctx, "app", "Todo", "owner@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	name, logo, empty := "Tasks", "https://cdn.example.com/logo.png", ""
+	tests := []struct {
+		name     string
+		appID    string
+		update   AppUpdate
+		wantName string
+		wantLogo string
+		wantErr  error
+	}{
+		{"logo only", "app", AppUpdate{Logo: &logo}, "Todo", logo, nil},
+		{"same logo again", "app", AppUpdate{Logo: &logo}, "Todo", logo, nil},
+		{"name only", "app", AppUpdate{Name: &name}, "Tasks", logo, nil},
+		{"nothing", "app", AppUpdate{}, "Tasks", logo, nil},
+		{"empty name", "app", AppUpdate{Name: &empty}, "", "", ErrInvalidApp},
+		{"unknown app", "missing", AppUpdate{Name: &name}, "", "", ErrAppNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := m.UpdateApp(ctx, tt.appID, tt.update)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if app.Name != tt.wantName || app.Logo != tt.wantLogo {
+				t.Errorf("got %q/%q, want %q/%q", app.Name, app.Logo, tt.wantName, tt.wantLogo)
+			}
+		})
+	}
+}
+
+func TestMemoryManagerApplySchemas(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	if _, err := m.ApplySchemas(ctx, "app", nil); !errors.Is(err, ErrAppNotFound) {
+		t.Fatalf("err = %v, want ErrAppNotFound", err)
+	}
+	app, err := m.CreateApp(ctx, "app", "Todo", "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todos := Schema{Collection: "todos", JSONSchema: map[string]interface{}{"type": "object"}}
+	result, err := m.ApplySchemas(ctx, "app", []Schema{todos})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, &SchemaResult{Created: []string{"todos"}, Updated: []string{}}) {
+		t.Errorf("first apply = %+v", result)
+	}
+
+	// The returned app is a copy
+	app.Collections = append(app.Collections, "mutated")
+
+	updated := Schema{Collection: "todos", JSONSchema: map[string]interface{}{"type": "object", "required": []interface{}{"title"}}}
+	tags := Schema{Collection: "tags", JSONSchema: map[string]interface{}{}}
+	result, err = m.ApplySchemas(ctx, "app", []Schema{updated, tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, &SchemaResult{Created: []string{"tags"}, Updated: []string{"todos"}}) {
+		t.Errorf("second apply = %+v", result)
+	}
+
+	if schema, ok := m.Schema("app", "todos"); !ok || !reflect.DeepEqual(schema, updated) {
+		t.Errorf("todos schema = %+v, want the updated schema", schema)
+	}
+	current, err := m.UpdateApp(ctx, "app", AppUpdate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(current.Collections, []string{"todos", "tags"}) {
+		t.Errorf("collections = %v, want [todos tags]", current.Collections)
+	}
+}
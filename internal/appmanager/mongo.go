@@ -0,0 +1,271 @@
+package appmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// SystemDatabase holds the apps and app_users collections
+	SystemDatabase = "system_db"
+
+	appsCollection     = "apps"
+	appUsersCollection = "app_users"
+
+	// adminRole is the role of the app owner's account
+	adminRole = "admin"
+)
+
+// MongoManager is the Manager backed by MongoDB
+type MongoManager struct {
+	Client   *mongo.Client
+	SystemDB *mongo.Database
+
+	// The unique index that makes owner account upserts idempotent is
+	// created on first use
+	indexMu      sync.Mutex
+	indexesReady bool
+}
+
+func NewMongoManager(client *mongo.Client) *MongoManager {
+	return &MongoManager{
+		Client:   client,
+		SystemDB: client.Database(SystemDatabase),
+	}
+}
+
+// DatabaseName is the database of an app created by CreateApp. Apps created
+// before keep the database recorded in their app record.
+func DatabaseName(appID string) string {
+	return "app_" + strings.ReplaceAll(appID, "-", "_")
+}
+
+// CreateApp upserts the app record and the owner's admin account. The
+// database name and JWT secret are only set when the app is first created.
+func (m *MongoManager) CreateApp(ctx context.Context, appID, name, ownerEmail string) (*App, error) {
+	ownerEmail = strings.TrimSpace(ownerEmail)
+	if appID == "" || name == "" || ownerEmail == "" {
+		return nil, fmt.Errorf("%w: app ID, name and owner email are required", ErrInvalidApp)
+	}
+
+	// Without the index concurrent calls may create the owner account twice;
+	// sequential calls are still idempotent
+	if err := m.ensureIndexes(ctx); err != nil {
+		log.Printf("[AppManager] Warning: Failed to create %s index: %v", appUsersCollection, err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, &OpError{Op: "generate JWT secret", AppID: appID, Err: err}
+	}
+
+	now := time.Now().UTC()
+	var app App
+	err = retryDuplicateKey(func() error {
+		return m.SystemDB.Collection(appsCollection).FindOneAndUpdate(ctx,
+			bson.M{"_id": appID},
+			bson.M{
+				"$set": bson.M{
+					"name":       name,
+					"ownerEmail": ownerEmail,
+					"updatedAt":  now,
+				},
+				"$setOnInsert": bson.M{
+					"databaseName": DatabaseName(appID),
+					"jwt":          bson.M{"secret": secret},
+					"createdAt":    now,
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&app)
+	})
+	if err != nil {
+		return nil, &OpError{Op: "upsert app", AppID: appID, Err: err}
+	}
+
+	err = retryDuplicateKey(func() error {
+		_, err := m.SystemDB.Collection(appUsersCollection).UpdateOne(ctx,
+			bson.M{"appId": appID, "email": ownerEmail},
+			bson.M{
+				"$addToSet": bson.M{"roles": adminRole},
+				"$set":      bson.M{"updatedAt": now},
+				"$setOnInsert": bson.M{
+					"_id":       uuid.New().String(),
+					"createdAt": now,
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, &OpError{Op: "upsert owner account", AppID: appID, Err: err}
+	}
+
+	return &app, nil
+}
+
+// UpdateApp sets the name and logo of an app
+func (m *MongoManager) UpdateApp(ctx context.Context, appID string, update AppUpdate) (*App, error) {
+	set := bson.M{"updatedAt": time.Now().UTC()}
+	if update.Name != nil {
+		if *update.Name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidApp)
+		}
+		set["name"] = *update.Name
+	}
+	if update.Logo != nil {
+		set["logo"] = *update.Logo
+	}
+
+	var app App
+	err := m.SystemDB.Collection(appsCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": appID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&app)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAppNotFound
+	}
+	if err != nil {
+		return nil, &OpError{Op: "update app", AppID: appID, Err: err}
+	}
+	return &app, nil
+}
+
+// ApplySchemas creates or updates the app's collections, validating documents
+// against their schemas. Existing documents are only validated when they are
+// next updated (validationLevel moderate).
+func (m *MongoManager) ApplySchemas(ctx context.Context, appID string, schemas []Schema) (*SchemaResult, error) {
+	var app App
+	err := m.SystemDB.Collection(appsCollection).FindOne(ctx, bson.M{"_id": appID}).Decode(&app)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAppNotFound
+	}
+	if err != nil {
+		return nil, &OpError{Op: "get app", AppID: appID, Err: err}
+	}
+	if app.DatabaseName == "" {
+		return nil, &OpError{Op: "get app", AppID: appID, Err: fmt.Errorf("app has no database")}
+	}
+
+	db := m.Client.Database(app.DatabaseName)
+	existing, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, &OpError{Op: "list collections", AppID: appID, Err: err}
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	result := &SchemaResult{Created: []string{}, Updated: []string{}}
+	collections := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		validator := bson.M{"$jsonSchema": schema.JSONSchema}
+		created := false
+		if !exists[schema.Collection] {
+			err := db.CreateCollection(ctx, schema.Collection, options.CreateCollection().
+				SetValidator(validator).
+				SetValidationLevel("moderate"))
+			// Created concurrently since the collections were listed
+			if err != nil && !isNamespaceExists(err) {
+				return result, m.schemaError(appID, schema, err)
+			}
+			created = err == nil
+		}
+		if !created {
+			err := db.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: schema.Collection},
+				{Key: "validator", Value: validator},
+				{Key: "validationLevel", Value: "moderate"},
+			}).Err()
+			if err != nil {
+				return result, m.schemaError(appID, schema, err)
+			}
+		}
+
+		if created {
+			result.Created = append(result.Created, schema.Collection)
+		} else {
+			result.Updated = append(result.Updated, schema.Collection)
+		}
+		collections = append(collections, schema.Collection)
+	}
+
+	_, err = m.SystemDB.Collection(appsCollection).UpdateOne(ctx,
+		bson.M{"_id": appID},
+		bson.M{
+			"$addToSet": bson.M{"collections": bson.M{"$each": collections}},
+			"$set":      bson.M{"schemasUpdatedAt": time.Now().UTC()},
+		},
+	)
+	if err != nil {
+		return result, &OpError{Op: "record collections", AppID: appID, Err: err}
+	}
+	return result, nil
+}
+
+// schemaError reports a schema MongoDB rejected as a SchemaError and any
+// other failure as an OpError
+func (m *MongoManager) schemaError(appID string, schema Schema, err error) error {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 2 || cmdErr.Code == 9) { // BadValue, FailedToParse
+		return &SchemaError{Collection: schema.Collection, Err: err}
+	}
+	return &OpError{Op: "apply schema of collection " + schema.Collection, AppID: appID, Err: err}
+}
+
+// ensureIndexes creates the unique index on the owner accounts of apps
+func (m *MongoManager) ensureIndexes(ctx context.Context) error {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	if m.indexesReady {
+		return nil
+	}
+
+	_, err := m.SystemDB.Collection(appUsersCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "appId", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	m.indexesReady = true
+	return nil
+}
+
+// retryDuplicateKey runs an upsert again when a concurrent upsert inserted the
+// same document first; the second attempt updates it
+func retryDuplicateKey(upsert func() error) error {
+	err := upsert()
+	if mongo.IsDuplicateKeyError(err) {
+		err = upsert()
+	}
+	return err
+}
+
+func isNamespaceExists(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 48 // NamespaceExists
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,195 @@
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON Schema of one collection, converted to MongoDB's $jsonSchema dialect
+type Schema struct {
+	Collection string
+	JSONSchema map[string]interface{}
+}
+
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]{0,63}$`)
+
+// unsupportedKeywords are JSON Schema keywords MongoDB's $jsonSchema rejects.
+// They only annotate or format values, so they are dropped.
+var unsupportedKeywords = []string{"$schema", "$id", "id", "$comment", "default", "examples", "format", "definitions", "$defs", "readOnly", "writeOnly"}
+
+// bsonTypes maps JSON Schema types to BSON types, for schemas using "integer",
+// which $jsonSchema only supports through bsonType
+var bsonTypes = map[string][]string{
+	"string":  {"string"},
+	"number":  {"double", "int", "long", "decimal"},
+	"integer": {"int", "long"},
+	"boolean": {"bool"},
+	"object":  {"object"},
+	"array":   {"array"},
+	"null":    {"null"},
+}
+
+// LoadSchemas reads the collection schemas in dir: one {collection}.json file
+// per collection, holding a JSON Schema or an object with a $jsonSchema key.
+// Schemas are returned in collection name order.
+func LoadSchemas(dir string) ([]Schema, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	schemas := make([]Schema, 0, len(files))
+	for _, file := range files {
+		collection := strings.TrimSuffix(filepath.Base(file), ".json")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, &SchemaError{Collection: collection, File: file, Err: err}
+		}
+		schema, err := ParseSchema(collection, data)
+		if err != nil {
+			if schemaErr, ok := err.(*SchemaError); ok {
+				schemaErr.File = file
+			}
+			return nil, err
+		}
+		schemas = append(schemas, *schema)
+	}
+	return schemas, nil
+}
+
+// ParseSchema parses the JSON Schema of a collection
+func ParseSchema(collection string, data []byte) (*Schema, error) {
+	if !collectionNamePattern.MatchString(collection) {
+		return nil, &SchemaError{Collection: collection, Err: fmt.Errorf("invalid collection name %q", collection)}
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, &SchemaError{Collection: collection, Err: err}
+	}
+	if wrapped, ok := doc["$jsonSchema"].(map[string]interface{}); ok {
+		doc = wrapped
+	}
+
+	if err := convertSchema(doc); err != nil {
+		return nil, &SchemaError{Collection: collection, Err: err}
+	}
+
+	// Every document has an _id, so a closed schema must allow it
+	if doc["additionalProperties"] == false {
+		properties, _ := doc["properties"].(map[string]interface{})
+		if properties == nil {
+			properties = make(map[string]interface{})
+			doc["properties"] = properties
+		}
+		if _, ok := properties["_id"]; !ok {
+			properties["_id"] = map[string]interface{}{}
+		}
+	}
+	return &Schema{Collection: collection, JSONSchema: doc}, nil
+}
+
+// convertSchema rewrites a JSON Schema in place into MongoDB's $jsonSchema
+// dialect, including its subschemas
+func convertSchema(schema map[string]interface{}) error {
+	if _, ok := schema["$ref"]; ok {
+		return fmt.Errorf("$ref is not supported")
+	}
+	for _, keyword := range unsupportedKeywords {
+		delete(schema, keyword)
+	}
+
+	if err := convertType(schema); err != nil {
+		return err
+	}
+
+	// Keywords holding a map of subschemas
+	for _, keyword := range []string{"properties", "patternProperties", "dependencies"} {
+		if subschemas, ok := schema[keyword].(map[string]interface{}); ok {
+			for _, subschema := range subschemas {
+				if err := convertSubschema(subschema); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Keywords holding a subschema or a list of subschemas
+	for _, keyword := range []string{"items", "additionalItems", "additionalProperties", "not", "allOf", "anyOf", "oneOf"} {
+		if err := convertSubschema(schema[keyword]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertSubschema converts the subschema or list of subschemas in value; any
+// other value (e.g. additionalProperties: false) is left as it is
+func convertSubschema(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return convertSchema(v)
+	case []interface{}:
+		for _, item := range v {
+			if err := convertSubschema(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// convertType replaces a type that includes "integer" with the equivalent bsonType
+func convertType(schema map[string]interface{}) error {
+	var types []string
+	switch t := schema["type"].(type) {
+	case nil:
+		return nil
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid type %v", t)
+			}
+			types = append(types, name)
+		}
+	default:
+		return fmt.Errorf("invalid type %v", t)
+	}
+
+	hasInteger := false
+	for _, name := range types {
+		if _, ok := bsonTypes[name]; !ok {
+			return fmt.Errorf("unknown type %q", name)
+		}
+		hasInteger = hasInteger || name == "integer"
+	}
+	if !hasInteger {
+		return nil
+	}
+
+	if _, ok := schema["bsonType"]; ok {
+		return fmt.Errorf("type and bsonType cannot both be set")
+	}
+	var converted []interface{}
+	seen := make(map[string]bool)
+	for _, name := range types {
+		for _, bsonType := range bsonTypes[name] {
+			if !seen[bsonType] {
+				seen[bsonType] = true
+				converted = append(converted, bsonType)
+			}
+		}
+	}
+	delete(schema, "type")
+	schema["bsonType"] = converted
+	return nil
+}
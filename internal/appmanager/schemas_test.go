@@ -0,0 +1,157 @@
+package appmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		data       string
+		want       map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "plain schema",
+			collection: "todos",
+			data:       `{"type":"object","required":["title"],"properties":{"title":{"type":"string"}}}`,
+			want:       map[string]interface{}{"type": "object", "required": []interface{}{"title"}, "properties": map[string]interface{}{"title": map[string]interface{}{"type": "string"}}},
+		},
+		{
+			name:       "wrapped in $jsonSchema",
+			collection: "todos",
+			data:       `{"$jsonSchema":{"type":"object"}}`,
+			want:       map[string]interface{}{"type": "object"},
+		},
+		{
+			name:       "integer becomes bsonType",
+			collection: "items",
+			data:       `{"properties":{"count":{"type":"integer"}}}`,
+			want:       map[string]interface{}{"properties": map[string]interface{}{"count": map[string]interface{}{"bsonType": []interface{}{"int", "long"}}}},
+		},
+		{
+			name:       "type list with integer",
+			collection: "items",
+			data:       `{"properties":{"count":{"type":["integer","number","null"]}}}`,
+			want:       map[string]interface{}{"properties": map[string]interface{}{"count": map[string]interface{}{"bsonType": []interface{}{"int", "long", "double", "decimal", "null"}}}},
+		},
+		{
+			name:       "number without integer is kept",
+			collection: "items",
+			data:       `{"properties":{"price":{"type":"number"}}}`,
+			want:       map[string]interface{}{"properties": map[string]interface{}{"price": map[string]interface{}{"type": "number"}}},
+		},
+		{
+			name:       "unsupported keywords dropped",
+			collection: "users",
+			data:       `{"$schema":"http://json-schema.org/draft-07/schema#","$id":"users","title":"Users","properties":{"email":{"type":"string","format":"email","default":"","examples":["a@b.c"],"readOnly":true}},"definitions":{"x":{}}}`,
+			want:       map[string]interface{}{"title": "Users", "properties": map[string]interface{}{"email": map[string]interface{}{"type": "string"}}},
+		},
+		{
+			name:       "nested items and combinators",
+			collection: "orders",
+			data:       `{"properties":{"lines":{"type":"array","items":{"type":"object","properties":{"qty":{"type":"integer","format":"int32"}}}}},"anyOf":[{"properties":{"n":{"type":"integer"}}}]}`,
+			want: map[string]interface{}{
+				"properties": map[string]interface{}{"lines": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"qty": map[string]interface{}{"bsonType": []interface{}{"int", "long"}}}}}},
+				"anyOf":      []interface{}{map[string]interface{}{"properties": map[string]interface{}{"n": map[string]interface{}{"bsonType": []interface{}{"int", "long"}}}}},
+			},
+		},
+		{
+			name:       "closed schema allows _id",
+			collection: "notes",
+			data:       `{"additionalProperties":false,"properties":{"text":{"type":"string"}}}`,
+			want:       map[string]interface{}{"additionalProperties": false, "properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}, "_id": map[string]interface{}{}}},
+		},
+		{
+			name:       "closed schema without properties",
+			collection: "notes",
+			data:       `{"additionalProperties":false}`,
+			want:       map[string]interface{}{"additionalProperties": false, "properties": map[string]interface{}{"_id": map[string]interface{}{}}},
+		},
+		{
+			name:       "closed schema keeps its own _id",
+			collection: "notes",
+			data:       `{"additionalProperties":false,"properties":{"_id":{"bsonType":"objectId"}}}`,
+			want:       map[string]interface{}{"additionalProperties": false, "properties": map[string]interface{}{"_id": map[string]interface{}{"bsonType": "objectId"}}},
+		},
+		{name: "invalid collection name", collection: "system.users", data: `{}`, wantErr: true},
+		{name: "collection name starting with a digit", collection: "1todos", data: `{}`, wantErr: true},
+		{name: "invalid json", collection: "todos", data: `{`, wantErr: true},
+		{name: "$ref", collection: "todos", data: `{"properties":{"a":{"$ref":"#/definitions/a"}}}`, wantErr: true},
+		{name: "unknown type", collection: "todos", data: `{"type":"date"}`, wantErr: true},
+		{name: "type and bsonType", collection: "todos", data: `{"type":"integer","bsonType":"int"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseSchema(tt.collection, []byte(tt.data))
+			if tt.wantErr {
+				var schemaErr *SchemaError
+				if !errors.As(err, &schemaErr) {
+					t.Fatalf("expected a SchemaError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if schema.Collection != tt.collection {
+				t.Errorf("collection = %q, want %q", schema.Collection, tt.collection)
+			}
+			if !reflect.DeepEqual(schema.JSONSchema, tt.want) {
+				t.Errorf("schema = %#v\nwant %#v", schema.JSONSchema, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSchemas(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"todos.json":  `{"type":"object"}`,
+		"events.json": `{"$jsonSchema":{"properties":{"at":{"type":"integer"}}}}`,
+		"README.md":   `not a schema`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schemas, err := LoadSchemas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var collections []string
+	for _, schema := range schemas {
+		collections = append(collections, schema.Collection)
+	}
+	if !reflect.DeepEqual(collections, []string{"events", "todos"}) {
+		t.Errorf("collections = %v, want [events todos]", collections)
+	}
+
+	t.Run("empty directory", func(t *testing.T) {
+		schemas, err := LoadSchemas(t.TempDir())
+		if err != nil || len(schemas) != 0 {
+			t.Errorf("got %v, %v", schemas, err)
+		}
+	})
+
+	t.Run("invalid schema names the file", func(t *testing.T) {
+		bad := t.TempDir()
+		path := filepath.Join(bad, "broken.json")
+		if err := os.WriteFile(path, []byte(`{"type":"date"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadSchemas(bad)
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) || schemaErr.File != path || schemaErr.Collection != "broken" {
+			t.Errorf("expected a SchemaError for %s, got %v", path, err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Bubblewrap runs each command in fresh namespaces with the host root mounted
+// read-only, a private /tmp, and only the workspace (plus configured paths such
+// as the npm cache) writable. Hidden paths (the worker's .env, credentials and
+// host config) are masked with empty mounts, and so are the access paths (agent
+// config, deploy CLI credentials) of commands without that access. The network
+// stays shared because installs, the code agent and deploys need it.
+type Bubblewrap struct {
+	Path          string
+	BaseEnv       []string
+	WritablePaths []string
+	HiddenPaths   []string
+	AccessPaths   map[Access][]string
+}
+
+func NewBubblewrap(path string, baseEnv, writablePaths, hiddenPaths []string, accessPaths map[Access][]string) *Bubblewrap {
+	return &Bubblewrap{
+		Path:          path,
+		BaseEnv:       baseEnv,
+		WritablePaths: writablePaths,
+		HiddenPaths:   hiddenPaths,
+		AccessPaths:   accessPaths,
+	}
+}
+
+func (e *Bubblewrap) Name() string {
+	return "bwrap"
+}
+
+func (e *Bubblewrap) Prepare(workspaceDir string) error {
+	return nil
+}
+
+func (e *Bubblewrap) Run(ctx context.Context, cmd Command) error {
+	args, err := e.args(cmd)
+	if err != nil {
+		return err
+	}
+	return start(ctx, e.Path, args, cmd, []string{}).Run()
+}
+
+// args is the bwrap argv that runs cmd
+func (e *Bubblewrap) args(cmd Command) ([]string, error) {
+	env := mergeEnv(e.BaseEnv, cmd.Env)
+	path, err := lookPath(cmd.Name, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access paths are writable for commands with that access and masked for all others
+	hidden := append([]string{}, e.HiddenPaths...)
+	writable := append([]string{}, e.WritablePaths...)
+	for _, access := range []Access{AccessAgent, AccessDeploy} {
+		if access == cmd.Access {
+			writable = append(writable, e.AccessPaths[access]...)
+		} else {
+			hidden = append(hidden, e.AccessPaths[access]...)
+		}
+	}
+	// Parents are masked before paths below them
+	sort.Strings(hidden)
+
+	args := []string{
+		"--die-with-parent",
+		"--new-session",
+		"--unshare-all",
+		"--share-net",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	// Masked before the writable binds, which may re-expose paths below them
+	for _, p := range hidden {
+		info, err := os.Stat(p)
+		switch {
+		case err != nil:
+		case info.IsDir():
+			args = append(args, "--tmpfs", p)
+		default:
+			args = append(args, "--ro-bind", "/dev/null", p)
+		}
+	}
+	for _, dir := range writable {
+		if _, err := os.Stat(dir); err == nil {
+			args = append(args, "--bind", dir, dir)
+		}
+	}
+	if cmd.Dir != "" {
+		args = append(args, "--bind", cmd.Dir, cmd.Dir, "--chdir", cmd.Dir)
+	}
+
+	// bwrap itself gets no environment; the command gets exactly env
+	args = append(args, "--clearenv")
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		args = append(args, "--setenv", key, value)
+	}
+	args = append(args, "--", path)
+	args = append(args, cmd.Args...)
+	return args, nil
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"context"
+)
+
+// Direct runs commands as the worker user with only the scrubbed environment
+type Direct struct {
+	BaseEnv []string
+}
+
+func NewDirect(baseEnv []string) *Direct {
+	return &Direct{BaseEnv: baseEnv}
+}
+
+func (e *Direct) Name() string {
+	return "none"
+}
+
+func (e *Direct) Prepare(workspaceDir string) error {
+	return nil
+}
+
+func (e *Direct) Run(ctx context.Context, cmd Command) error {
+	env := mergeEnv(e.BaseEnv, cmd.Env)
+	path, err := lookPath(cmd.Name, env)
+	if err != nil {
+		return err
+	}
+	return start(ctx, path, cmd.Args, cmd, env).Run()
+}
@@ -0,0 +1,168 @@
+// Package executor runs build subprocesses (code agents, package managers,
+// deploy CLIs) without a shell, with a scrubbed environment and, where
+// available, inside a sandbox that only lets them write to the workspace.
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// Command is one subprocess invocation. Name and Args are passed to the
+// binary as argv; nothing is interpreted by a shell.
+type Command struct {
+	Name   string
+	Args   []string
+	Dir    string   // Working directory, writable inside the sandbox
+	Env    []string // KEY=VALUE entries added to the allowlisted environment for this stage
+	Access Access   // Platform state the command may use besides the workspace
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Access names platform state that only some commands may use. bwrap binds
+// the paths of a command's access writable and masks those of every other access.
+type Access string
+
+const (
+	AccessNone   Access = ""
+	AccessAgent  Access = "agent"  // Code agent config and sessions (SANDBOX_AGENT_PATHS)
+	AccessDeploy Access = "deploy" // Deploy CLI credentials (SANDBOX_DEPLOY_PATHS)
+)
+
+// Executor runs commands. Cancelling ctx kills the command and everything it started.
+type Executor interface {
+	// Name identifies the isolation mode (none, bwrap, uid)
+	Name() string
+	// Prepare makes a freshly set up workspace usable by sandboxed commands
+	Prepare(workspaceDir string) error
+	// Run starts cmd and waits for it to exit
+	Run(ctx context.Context, cmd Command) error
+}
+
+// New returns the executor selected by cfg.Sandbox:
+//   - auto:  bwrap; fails when bubblewrap is not installed, so running
+//     without a sandbox always takes an explicit SANDBOX=none
+//   - bwrap: bubblewrap with a read-only root without host secrets and a
+//     writable workspace
+//   - uid:   runs commands as SANDBOX_UID/SANDBOX_GID (the worker must run as root)
+//   - none:  no isolation beyond the scrubbed environment
+func New(cfg *config.Config) (Executor, error) {
+	base := baseEnvironment(cfg)
+
+	switch cfg.Sandbox {
+	case "auto", "", "bwrap":
+		path, err := exec.LookPath("bwrap")
+		if err != nil {
+			return nil, fmt.Errorf("SANDBOX=%s but bubblewrap is not installed (set SANDBOX=none to run build commands without a sandbox): %w", cfg.Sandbox, err)
+		}
+		return NewBubblewrap(path, base, cfg.SandboxWritablePaths, hiddenPaths(cfg), accessPaths(cfg)), nil
+	case "uid":
+		executor, err := NewUID(base, cfg.SandboxUID, cfg.SandboxGID)
+		if err != nil {
+			return nil, err
+		}
+		return executor, nil
+	case "none":
+		return NewDirect(base), nil
+	default:
+		return nil, fmt.Errorf("unknown sandbox %q", cfg.Sandbox)
+	}
+}
+
+// baseEnvironment is the environment every stage gets: PATH plus the
+// allowlisted variables of the worker's own environment. Secrets such as
+// AWS_SECRET_KEY or DATABASE_URL never reach build commands unless a stage
+// adds them explicitly.
+func baseEnvironment(cfg *config.Config) []string {
+	env := []string{"PATH=" + cfg.SandboxPath}
+	for _, name := range cfg.SandboxEnvAllowlist {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// accessPaths are the paths of each access, writable only for commands with that access
+func accessPaths(cfg *config.Config) map[Access][]string {
+	return map[Access][]string{
+		AccessAgent:  cfg.SandboxAgentPaths,
+		AccessDeploy: cfg.SandboxDeployPaths,
+	}
+}
+
+// hiddenPaths are the paths bwrap masks: SANDBOX_HIDDEN_PATHS plus the
+// worker's working directory, which holds its .env and config, unless the
+// toolchain on SANDBOX_PATH lives below it
+func hiddenPaths(cfg *config.Config) []string {
+	paths := append([]string{}, cfg.SandboxHiddenPaths...)
+	dir, err := os.Getwd()
+	if err != nil || dir == "/" {
+		return paths
+	}
+	for _, binDir := range strings.Split(cfg.SandboxPath, ":") {
+		if binDir == dir || strings.HasPrefix(binDir, dir+"/") {
+			log.Printf("[Executor] Warning: %s is on SANDBOX_PATH, so the worker directory %s is not hidden from build commands", binDir, dir)
+			return paths
+		}
+	}
+	return append(paths, dir)
+}
+
+// mergeEnv overlays extra KEY=VALUE entries on base; later entries win
+func mergeEnv(base, extra []string) []string {
+	env := make([]string, 0, len(base)+len(extra))
+	index := make(map[string]int)
+	for _, entry := range append(append([]string{}, base...), extra...) {
+		key, _, _ := strings.Cut(entry, "=")
+		if i, ok := index[key]; ok {
+			env[i] = entry
+			continue
+		}
+		index[key] = len(env)
+		env = append(env, entry)
+	}
+	return env
+}
+
+// lookPath resolves name against the PATH of env rather than the worker's PATH
+func lookPath(name string, env []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+
+	for _, entry := range env {
+		if path, ok := strings.CutPrefix(entry, "PATH="); ok {
+			for _, dir := range strings.Split(path, ":") {
+				candidate := dir + "/" + name
+				if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+					return candidate, nil
+				}
+			}
+		}
+	}
+	return exec.LookPath(name)
+}
+
+// start builds the exec.Cmd shared by all executors
+func start(ctx context.Context, name string, args []string, cmd Command, env []string) *exec.Cmd {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Dir = cmd.Dir
+	c.Env = env
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	utils.KillProcessGroupOnCancel(c)
+	return c
+}
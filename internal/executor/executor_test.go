@@ -0,0 +1,241 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rapidbuildapp/rapidbuild/config"
+)
+
+func TestNewAutoRequiresBubblewrap(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	for _, sandbox := range []string{"auto", "", "bwrap"} {
+		if _, err := New(&config.Config{Sandbox: sandbox}); err == nil || !strings.Contains(err.Error(), "SANDBOX=none") {
+			t.Errorf("SANDBOX=%q without bwrap: err = %v, want an error", sandbox, err)
+		}
+	}
+
+	executor, err := New(&config.Config{Sandbox: "none"})
+	if err != nil || executor.Name() != "none" {
+		t.Errorf("SANDBOX=none: got %v, %v", executor, err)
+	}
+	if _, err := New(&config.Config{Sandbox: "docker"}); err == nil {
+		t.Error("unknown sandbox accepted")
+	}
+}
+
+func TestBaseEnvironment(t *testing.T) {
+	t.Setenv("LANG", "en_US.UTF-8")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-secret")
+	t.Setenv("AWS_SECRET_KEY", "aws-secret")
+	os.Unsetenv("TZ")
+
+	env := baseEnvironment(&config.Config{SandboxPath: "/usr/bin:/bin", SandboxEnvAllowlist: []string{"LANG", "TZ"}})
+	want := []string{"PATH=/usr/bin:/bin", "LANG=en_US.UTF-8"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %q, want %q", env, want)
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	got := mergeEnv([]string{"PATH=/bin", "HOME=/home/a"}, []string{"HOME=/tmp", "VERCEL_TOKEN=t"})
+	want := []string{"PATH=/bin", "HOME=/tmp", "VERCEL_TOKEN=t"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnv = %q, want %q", got, want)
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := lookPath("tool", []string{"PATH=/nonexistent:" + dir}); err != nil || got != tool {
+		t.Errorf("lookPath(tool) = %q, %v; want %s", got, err, tool)
+	}
+	if got, err := lookPath("/usr/bin/env", nil); err != nil || got != "/usr/bin/env" {
+		t.Errorf("absolute path = %q, %v", got, err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	if _, err := lookPath("data", []string{"PATH=" + dir}); err == nil {
+		t.Error("found a file that is not executable")
+	}
+}
+
+// argIndex returns the index of the flag followed by values in args, or -1
+func argIndex(args []string, flag string, values ...string) int {
+	for i := range args {
+		if args[i] == flag && i+len(values) < len(args) && slices.Equal(args[i+1:i+1+len(values)], values) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestBubblewrapArgs(t *testing.T) {
+	root := t.TempDir()
+	mkdir := func(name string) string {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	touch := func(name string) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ssh, netrc, missing := mkdir("ssh"), touch("netrc"), filepath.Join(root, "missing")
+	npm := mkdir("npm")
+	claude, claudeJSON := mkdir("claude"), touch("claude.json")
+	vercel := mkdir("vercel")
+	workspace := mkdir("workspace")
+
+	t.Setenv("AWS_SECRET_KEY", "aws-secret")
+	e := NewBubblewrap("/usr/bin/bwrap",
+		[]string{"PATH=/usr/bin:/bin", "HOME=/home/ubuntu"},
+		[]string{npm},
+		[]string{ssh, netrc, missing},
+		map[Access][]string{AccessAgent: {claude, claudeJSON}, AccessDeploy: {vercel}})
+
+	tests := []struct {
+		name     string
+		cmd      Command
+		writable []string
+		masked   []string
+		env      []string
+	}{
+		{
+			name:     "build command",
+			cmd:      Command{Name: "/usr/bin/npm", Args: []string{"run", "build"}, Dir: workspace},
+			writable: []string{npm, workspace},
+			masked:   []string{ssh, netrc, claude, claudeJSON, vercel},
+			env:      []string{"PATH=/usr/bin:/bin", "HOME=/home/ubuntu"},
+		},
+		{
+			name:     "agent",
+			cmd:      Command{Name: "/usr/bin/claude", Dir: workspace, Env: []string{"ANTHROPIC_API_KEY=sk"}, Access: AccessAgent},
+			writable: []string{npm, claude, claudeJSON, workspace},
+			masked:   []string{ssh, netrc, vercel},
+			env:      []string{"PATH=/usr/bin:/bin", "HOME=/home/ubuntu", "ANTHROPIC_API_KEY=sk"},
+		},
+		{
+			name:     "deploy",
+			cmd:      Command{Name: "/usr/bin/vercel", Dir: workspace, Env: []string{"VERCEL_TOKEN=t"}, Access: AccessDeploy},
+			writable: []string{npm, vercel, workspace},
+			masked:   []string{ssh, netrc, claude, claudeJSON},
+			env:      []string{"PATH=/usr/bin:/bin", "HOME=/home/ubuntu", "VERCEL_TOKEN=t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := e.args(tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			root := argIndex(args, "--ro-bind", "/", "/")
+			if root < 0 {
+				t.Fatalf("root is not mounted read-only: %q", args)
+			}
+			if argIndex(args, "--bind", "/", "/") >= 0 {
+				t.Error("root is mounted writable")
+			}
+
+			lastMask := 0
+			for _, path := range tt.masked {
+				i := argIndex(args, "--tmpfs", path)
+				if i < 0 {
+					i = argIndex(args, "--ro-bind", "/dev/null", path)
+				}
+				if i < root {
+					t.Errorf("%s is not masked after the root mount", path)
+				}
+				lastMask = max(lastMask, i)
+				if argIndex(args, "--bind", path, path) >= 0 {
+					t.Errorf("%s is masked but also bound writable", path)
+				}
+			}
+			if argIndex(args, "--tmpfs", netrc) >= 0 || argIndex(args, "--ro-bind", "/dev/null", ssh) >= 0 {
+				t.Error("files must be masked with /dev/null and directories with tmpfs")
+			}
+			if slices.Contains(args, missing) {
+				t.Error("missing hidden path is mounted")
+			}
+
+			var bound []string
+			for i := 0; i+2 < len(args); i++ {
+				if args[i] == "--bind" {
+					if args[i+1] != args[i+2] {
+						t.Errorf("%s is bound to %s", args[i+1], args[i+2])
+					}
+					if i < lastMask {
+						t.Errorf("%s is bound before the masks", args[i+1])
+					}
+					bound = append(bound, args[i+1])
+				}
+			}
+			if !reflect.DeepEqual(bound, tt.writable) {
+				t.Errorf("writable = %q, want %q", bound, tt.writable)
+			}
+			if argIndex(args, "--chdir", workspace) < 0 {
+				t.Error("command does not start in its directory")
+			}
+
+			clearenv := slices.Index(args, "--clearenv")
+			separator := slices.Index(args, "--")
+			if clearenv < 0 || separator < clearenv {
+				t.Fatalf("environment is not cleared before the command: %q", args)
+			}
+			var env []string
+			for i := clearenv + 1; i < separator; i += 3 {
+				if args[i] != "--setenv" {
+					t.Fatalf("unexpected argument %q in the environment", args[i])
+				}
+				env = append(env, args[i+1]+"="+args[i+2])
+			}
+			if !reflect.DeepEqual(env, tt.env) {
+				t.Errorf("env = %q, want %q", env, tt.env)
+			}
+
+			command := append([]string{tt.cmd.Name}, tt.cmd.Args...)
+			if !reflect.DeepEqual(args[separator+1:], command) {
+				t.Errorf("command = %q, want %q", args[separator+1:], command)
+			}
+		})
+	}
+}
+
+func TestHiddenPathsIncludeWorkerDirectory(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := hiddenPaths(&config.Config{SandboxPath: "/usr/bin", SandboxHiddenPaths: []string{"/root"}})
+	if !reflect.DeepEqual(paths, []string{"/root", cwd}) {
+		t.Errorf("hidden = %q, want /root and %s", paths, cwd)
+	}
+
+	// The toolchain must stay reachable
+	paths = hiddenPaths(&config.Config{SandboxPath: "/usr/bin:" + filepath.Join(cwd, "node_modules", ".bin"), SandboxHiddenPaths: []string{"/root"}})
+	if !reflect.DeepEqual(paths, []string{"/root"}) {
+		t.Errorf("hidden = %q, want only /root", paths)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package executor
+
+import "fmt"
+
+// NewUID is only supported on unix platforms
+func NewUID(baseEnv []string, uid, gid int) (Executor, error) {
+	return nil, fmt.Errorf("SANDBOX=uid is not supported on this platform")
+}
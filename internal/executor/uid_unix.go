@@ -0,0 +1,56 @@
+//go:build unix
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// UID runs commands as a dedicated unprivileged user, so generated code cannot
+// read the worker's files or signal its processes. The worker must run as root.
+type UID struct {
+	BaseEnv []string
+	UID     uint32
+	GID     uint32
+}
+
+func NewUID(baseEnv []string, uid, gid int) (*UID, error) {
+	if uid <= 0 || gid <= 0 {
+		return nil, fmt.Errorf("SANDBOX=uid requires a non-root SANDBOX_UID and SANDBOX_GID")
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("SANDBOX=uid requires the worker to run as root")
+	}
+	return &UID{BaseEnv: baseEnv, UID: uint32(uid), GID: uint32(gid)}, nil
+}
+
+func (e *UID) Name() string {
+	return "uid"
+}
+
+// Prepare hands the workspace to the sandbox user
+func (e *UID) Prepare(workspaceDir string) error {
+	return filepath.WalkDir(workspaceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(e.UID), int(e.GID))
+	})
+}
+
+func (e *UID) Run(ctx context.Context, cmd Command) error {
+	env := mergeEnv(e.BaseEnv, cmd.Env)
+	path, err := lookPath(cmd.Name, env)
+	if err != nil {
+		return err
+	}
+
+	c := start(ctx, path, cmd.Args, cmd, env)
+	c.SysProcAttr.Credential = &syscall.Credential{Uid: e.UID, Gid: e.GID}
+	return c.Run()
+}
@@ -13,6 +13,7 @@ type User struct {
 	AvatarURL     *string   `json:"avatar_url,omitempty" db:"avatar_url"`
 	EmailVerified bool      `json:"email_verified" db:"email_verified"`
 	GoogleID      *string   `json:"google_id,omitempty" db:"google_id"`
+	Plan          string    `json:"plan" db:"plan"` // free, pro; sets build policy defaults and limits
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -31,6 +32,8 @@ type App struct {
 	ProdVersion      *int      `json:"prod_version" db:"prod_version"`
 	ProductionURL    *string   `json:"production_url,omitempty" db:"production_url"`
 	VercelProjectID  *string   `json:"vercel_project_id,omitempty" db:"vercel_project_id"`
+	CodeGenerator    *string   `json:"code_generator,omitempty" db:"code_generator"` // Overrides CODE_GENERATOR for this app
+	StarterTemplate  *string   `json:"starter_template,omitempty" db:"starter_template"` // Starter the app is generated from; null until picked
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -40,15 +43,164 @@ type Version struct {
 	ID             string     `json:"id" db:"id"`
 	AppID          string     `json:"app_id" db:"app_id"`
 	VersionNumber  int        `json:"version_number" db:"version_number"`
-	Status         string     `json:"status" db:"status"` // pending, building, completed, failed, promoted
+	Status         string     `json:"status" db:"status"` // pending, building, awaiting_approval, completed, failed, cancelled, promoted
 	Requirements   *string    `json:"requirements,omitempty" db:"requirements"` // Initial requirements for version 1
 	S3CodePath     *string    `json:"s3_code_path,omitempty" db:"s3_code_path"`
 	VercelURL      *string    `json:"vercel_url,omitempty" db:"vercel_url"`
 	VercelDeployID *string    `json:"vercel_deploy_id,omitempty" db:"vercel_deploy_id"`
-	BuildLog       *string    `json:"build_log,omitempty" db:"build_log"`
+	BuildLog       *string    `json:"build_log,omitempty" db:"build_log"` // Legacy; builds now append logs to S3 (GET /versions/{id}/logs)
 	ErrorMessage   *string    `json:"error_message,omitempty" db:"error_message"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	CompletedAt    *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+
+	VerificationResults []VerificationResult `json:"verification_results,omitempty" db:"verification_results"` // Checks of the last verification run
+	Failure             *BuildFailure        `json:"failure,omitempty" db:"failure"`                           // Why the build failed; set with status failed
+	BaseVersionID       *string              `json:"base_version_id,omitempty" db:"base_version_id"`           // Version whose code the build started from; null for starter code
+	RetryOfVersionID    *string              `json:"retry_of_version_id,omitempty" db:"retry_of_version_id"`   // Failed or cancelled version this one retries
+	PromptTemplate      *string              `json:"prompt_template,omitempty" db:"prompt_template"`           // Prompt template version the code was generated with, e.g. default@1
+	AgentSession        *string              `json:"agent_session,omitempty" db:"agent_session"`               // S3 key of the code agent's session; versions built on this one resume it
+	SecurityFindings    []SecurityFinding    `json:"security_findings,omitempty" db:"security_findings"`       // Findings of the pre-deploy security scan
+	ChangePlan          *ChangePlan          `json:"change_plan,omitempty" db:"change_plan"`                   // Plan of a plan-first build, reviewed before code generation
+	Starter             *StarterRef          `json:"starter,omitempty" db:"starter"`                           // Starter revision the app's code was born from, carried over from the base version
+}
+
+// StarterTemplate is one revision of a starter app that new apps are generated from
+type StarterTemplate struct {
+	Name           string   `json:"name"`
+	Version        int      `json:"version"`
+	DisplayName    string   `json:"display_name"`
+	Description    string   `json:"description"`
+	Categories     []string `json:"categories"`                // App categories the starter is picked for
+	PromptTemplate string   `json:"prompt_template,omitempty"` // Prompt template of apps generated from the starter
+	Hash           string   `json:"hash,omitempty"`            // sha256 of the starter's files
+	Source         string   `json:"source"`                    // files, s3 or builtin
+}
+
+// StarterRef records the starter revision a version's code started from
+type StarterRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	Source  string `json:"source"`
+}
+
+// Change plan statuses
+const (
+	PlanProposed = "proposed" // Waiting for the user's approval
+	PlanApproved = "approved"
+	PlanRejected = "rejected"
+)
+
+// ChangePlan is what the code agent intends to change for a version, written
+// by a read-only planning pass. The version waits in awaiting_approval until
+// the user approves (optionally after editing) or rejects it.
+type ChangePlan struct {
+	Summary      string              `json:"summary"`
+	Approach     string              `json:"approach"`
+	Files        []PlannedFile       `json:"files"`
+	Dependencies []PlannedDependency `json:"dependencies"`
+	Risks        []string            `json:"risks,omitempty"`
+	Status       string              `json:"status"`             // proposed, approved, rejected
+	Edited       bool                `json:"edited"`             // Changed by the user after the agent wrote it
+	Feedback     string              `json:"feedback,omitempty"` // Why the user rejected the plan
+	CreatedAt    time.Time           `json:"created_at"`
+	DecidedAt    *time.Time          `json:"decided_at,omitempty"`
+}
+
+// PlannedFile is a file the plan creates, modifies or deletes
+type PlannedFile struct {
+	Path        string `json:"path"`
+	Action      string `json:"action"` // create, modify, delete
+	Description string `json:"description"`
+}
+
+// PlannedDependency is an npm package the plan adds
+type PlannedDependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// VersionNode is a version in an app's version tree, with the versions built from it
+type VersionNode struct {
+	Version
+	Children []*VersionNode `json:"children"`
+}
+
+// PromptTemplateInfo describes an available prompt template version
+type PromptTemplateInfo struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Source  string `json:"source"` // database, files or builtin
+}
+
+// AppPromptSettings are the prompt settings of an app, injected into every build
+type AppPromptSettings struct {
+	PromptTemplate     *string `json:"prompt_template"`     // "name" (latest version) or "name@version"; null uses the default
+	CustomInstructions string  `json:"custom_instructions"` // e.g. "Always use Tailwind", brand rules
+	Template           string  `json:"template,omitempty"`  // Template version new builds use
+}
+
+// BuildFailure classifies a failed build so clients can offer the right next action
+type BuildFailure struct {
+	Stage          string `json:"stage"`           // Build step that failed (code_generation, build, verify, deploy, ...) or "worker"
+	Category       string `json:"category"`        // e.g. agent_crash, compile_error, deploy_quota, storage_unavailable, timeout
+	Retryable      bool   `json:"retryable"`       // Running the same build again may succeed
+	UserActionable bool   `json:"user_actionable"` // The user has to change requirements, settings or plan first
+	ExitCode       *int   `json:"exit_code,omitempty"`
+}
+
+// BuildPolicy limits how long and how often a build may run. Timeouts are in
+// minutes; stored overrides use 0 for "plan default".
+type BuildPolicy struct {
+	MaxAttempts          int `json:"max_attempts"`          // Build attempts; each failure but the last goes to the fix loop
+	AgentTimeoutMinutes  int `json:"agent_timeout_minutes"` // Per code generation or fix run
+	LinkTimeoutMinutes   int `json:"link_timeout_minutes"`
+	BuildTimeoutMinutes  int `json:"build_timeout_minutes"`
+	VerifyTimeoutMinutes int `json:"verify_timeout_minutes"` // Per check
+	DeployTimeoutMinutes int `json:"deploy_timeout_minutes"`
+	SchemaTimeoutMinutes int `json:"schema_timeout_minutes"`
+}
+
+// AppBuildPolicy is the build policy of an app as returned by the API
+type AppBuildPolicy struct {
+	Plan      string      `json:"plan"`
+	Policy    BuildPolicy `json:"policy"`    // Effective policy builds run with
+	Overrides BuildPolicy `json:"overrides"` // Set on the app; 0 uses the plan default
+	Defaults  BuildPolicy `json:"defaults"`  // Plan defaults
+	Limits    BuildPolicy `json:"limits"`    // Highest values the plan allows
+}
+
+// VerificationResult is the outcome of one post-build check (test, lint, typecheck)
+type VerificationResult struct {
+	Check      string `json:"check"`
+	Command    string `json:"command,omitempty"`
+	Status     string `json:"status"` // passed, failed, skipped
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Attempt    int    `json:"attempt"`
+	DurationMs int64  `json:"duration_ms"`
+	Output     string `json:"output,omitempty"` // Tail of the check's output
+}
+
+// SecurityFinding is an issue the pre-deploy security scan found in the generated code
+type SecurityFinding struct {
+	Rule     string `json:"rule"`
+	Category string `json:"category"` // secret, dangerous_code, client_credential, bad_file
+	Severity string `json:"severity"` // critical, high, medium, low
+	File     string `json:"file"`     // Path relative to the workspace
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+	Snippet  string `json:"snippet,omitempty"` // Matched code with secrets redacted
+	Blocking bool   `json:"blocking"`          // At or above the blocking severity; blocked the deploy
+}
+
+// SecurityReport is the result of a version's security scan as returned by the API
+type SecurityReport struct {
+	VersionID  string            `json:"version_id"`
+	Scanned    bool              `json:"scanned"`
+	Blocked    bool              `json:"blocked"`
+	BySeverity map[string]int    `json:"by_severity"`
+	Findings   []SecurityFinding `json:"findings"`
 }
 
 // Comment represents a user comment on an app
@@ -81,12 +233,38 @@ type CreateAppRequest struct {
 	Name         string   `json:"name"`
 	Description  string   `json:"description"`
 	Requirements string   `json:"requirements"`
-	Files        []string `json:"files"` // S3 paths of uploaded files
+	Files        []string `json:"files"`      // S3 paths of uploaded files
+	PlanFirst    bool     `json:"plan_first"` // Plan the changes and wait for approval before generating code
+	Starter      string   `json:"starter"`    // Starter template ("name" or "name@version"); inferred from the app's category when empty
 }
 
 // CreateVersionRequest represents request to create a new version
 type CreateVersionRequest struct {
-	Comments []string `json:"comments"` // Comment IDs to include in this version
+	Comments      []string `json:"comments"`                  // Comment IDs to include in this version
+	BaseVersionID *string  `json:"base_version_id,omitempty"` // Completed version to build on; defaults to the latest
+	PlanFirst     bool     `json:"plan_first"`                // Plan the changes and wait for approval before generating code
+}
+
+// ApprovePlanRequest approves a version's change plan. Plan replaces the
+// proposed plan when set.
+type ApprovePlanRequest struct {
+	Plan *ChangePlan `json:"plan,omitempty"`
+}
+
+// RejectPlanRequest rejects a version's change plan
+type RejectPlanRequest struct {
+	Feedback string `json:"feedback"`
+}
+
+// Retry modes of a failed version
+const (
+	RetryModeFull  = "full"  // Run code generation again from the original base version
+	RetryModeBuild = "build" // Reuse the generated code and only build, verify and deploy
+)
+
+// RetryVersionRequest represents request to retry a failed or cancelled version
+type RetryVersionRequest struct {
+	Mode string `json:"mode"` // full (default) or build
 }
 
 // AddCommentRequest represents request to add a comment
@@ -98,8 +276,170 @@ type AddCommentRequest struct {
 
 // BuildProgress represents real-time build progress
 type BuildProgress struct {
+	VersionID string        `json:"version_id"`
+	Status    string        `json:"status"`
+	Message   string        `json:"message"`
+	Failure   *BuildFailure `json:"failure,omitempty"` // Set on the final "failed" event
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// BuildEventLog is the type of BuildLogEvent messages on the build progress channel.
+// Progress messages have no type and are sent as unnamed SSE events.
+const BuildEventLog = "log"
+
+// BuildLogEvent carries a batch of subprocess output lines of one build stage.
+// It is sent to SSE clients as "event: log".
+type BuildLogEvent struct {
+	Type      string    `json:"type"`
 	VersionID string    `json:"version_id"`
-	Status    string    `json:"status"`
-	Message   string    `json:"message"`
+	Stage     string    `json:"stage"`
+	Lines     []string  `json:"lines"`
+	Dropped   int       `json:"dropped,omitempty"` // Lines skipped by rate limiting before this batch
 	Timestamp time.Time `json:"timestamp"`
 }
+
+// BuildJob represents a queued or running build in the durable build queue
+type BuildJob struct {
+	ID              string          `json:"id" db:"id"`
+	VersionID       string          `json:"version_id" db:"version_id"`
+	AppID           string          `json:"app_id" db:"app_id"`
+	Status          string          `json:"status" db:"status"` // queued, running, completed, failed, cancelled
+	Payload         BuildJobPayload `json:"-" db:"payload"` // Worker input (requirements, owner email); never sent to clients
+	CancelRequested bool            `json:"cancel_requested" db:"cancel_requested"`
+	Attempts        int             `json:"attempts" db:"attempts"`
+	MaxAttempts     int             `json:"max_attempts" db:"max_attempts"`
+	WorkerID        *string         `json:"worker_id,omitempty" db:"worker_id"`
+	LastError       *string         `json:"last_error,omitempty" db:"last_error"`
+	HeartbeatAt     *time.Time      `json:"heartbeat_at,omitempty" db:"heartbeat_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+}
+
+// BuildJobPayload holds the inputs BuildApp needs to run a job
+type BuildJobPayload struct {
+	Requirements string    `json:"requirements"`
+	Comments     []Comment `json:"comments,omitempty"`
+	OwnerEmail   string    `json:"owner_email"`
+
+	// Retries pin the code the build starts from: BaseVersionID restores that
+	// version's code (of a failed version too) instead of the latest completed one
+	BaseVersionID      string `json:"base_version_id,omitempty"`
+	SkipCodeGeneration bool   `json:"skip_code_generation,omitempty"` // Build the restored code as is
+
+	// Plan-first builds run a read-only planning pass and stop in
+	// awaiting_approval; approving the plan enqueues the build with ApprovedPlan
+	PlanFirst    bool        `json:"plan_first,omitempty"`
+	ApprovedPlan *ChangePlan `json:"approved_plan,omitempty"`
+}
+
+// Worker represents a build worker process registered in the workers table
+type Worker struct {
+	ID          string    `json:"id" db:"id"`
+	Hostname    string    `json:"hostname" db:"hostname"`
+	PID         int       `json:"pid" db:"pid"`
+	Status      string    `json:"status" db:"status"` // running, stopped
+	Concurrency int       `json:"concurrency" db:"concurrency"`
+	ActiveJobs  int       `json:"active_jobs" db:"active_jobs"`
+	Alive       bool      `json:"alive" db:"-"` // running and seen within the lease timeout
+	StartedAt   time.Time `json:"started_at" db:"started_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+// BuildStatus describes the queue state of a version's build and the worker that owns it
+type BuildStatus struct {
+	Job                 *BuildJob `json:"job"`
+	Worker              *Worker   `json:"worker,omitempty"`
+	QueuedBehindVersion *int      `json:"queued_behind_version,omitempty"` // Set while waiting on another build of the same app
+	Message             string    `json:"message,omitempty"`
+}
+
+// BuildStep records one stage of a build (workspace setup, link, code generation,
+// each build and fix attempt, schema setup, deploy, packaging)
+type BuildStep struct {
+	ID         string     `json:"id" db:"id"`
+	VersionID  string     `json:"version_id" db:"version_id"`
+	Name       string     `json:"name" db:"name"`
+	Attempt    int        `json:"attempt" db:"attempt"`
+	Status     string     `json:"status" db:"status"` // running, succeeded, failed, cancelled
+	ExitCode   *int       `json:"exit_code,omitempty" db:"exit_code"`
+	Log        *string    `json:"log,omitempty" db:"log"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	DurationMs *int64     `json:"duration_ms,omitempty" db:"-"`
+}
+
+// BuildLogPage is a byte range of a version's build log. The log is the
+// concatenation of all chunks written by every stage and attempt.
+type BuildLogPage struct {
+	VersionID  string `json:"version_id"`
+	Offset     int64  `json:"offset"`      // Byte offset of Content in the full log
+	NextOffset int64  `json:"next_offset"` // Pass as ?offset= to continue reading
+	Size       int64  `json:"size"`        // Current size of the full log
+	Content    string `json:"content"`
+}
+
+// UsageEvent records what one call to an AI provider consumed: a code
+// generation or fix run, app config extraction or logo generation
+type UsageEvent struct {
+	ID           string    `json:"id" db:"id"`
+	UserID       string    `json:"user_id" db:"user_id"`
+	AppID        string    `json:"app_id" db:"app_id"`
+	VersionID    *string   `json:"version_id,omitempty" db:"version_id"` // Null for app setup (config, logo)
+	Provider     string    `json:"provider" db:"provider"`               // claude, gemini, runware
+	Operation    string    `json:"operation" db:"operation"`             // generate, fix, plan, app_config, logo
+	Model        *string   `json:"model,omitempty" db:"model"`
+	Attempt      int       `json:"attempt" db:"attempt"` // Attempt of the build step (fix runs count build attempts)
+	InputTokens  int64     `json:"input_tokens" db:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens" db:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd" db:"cost_usd"`
+	Turns        int       `json:"turns" db:"turns"`
+	DurationMs   int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// UsageTotals sums usage events
+type UsageTotals struct {
+	Events       int     `json:"events"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+	Turns        int     `json:"turns"`
+}
+
+// OperationUsage is the usage of one provider operation
+type OperationUsage struct {
+	Provider  string `json:"provider"`
+	Operation string `json:"operation"`
+	UsageTotals
+}
+
+// VersionUsage is the usage of one version's build
+type VersionUsage struct {
+	VersionID     string `json:"version_id"`
+	VersionNumber int    `json:"version_number"`
+	UsageTotals
+}
+
+// AppUsageTotals is the usage of one app
+type AppUsageTotals struct {
+	AppID string `json:"app_id"`
+	Name  string `json:"name"`
+	UsageTotals
+}
+
+// AppUsage is the usage of an app as returned by the API
+type AppUsage struct {
+	AppID       string           `json:"app_id"`
+	Total       UsageTotals      `json:"total"`
+	ByOperation []OperationUsage `json:"by_operation"`
+	ByVersion   []VersionUsage   `json:"by_version"`
+}
+
+// UserUsage is the usage of all apps of a user as returned by the API
+type UserUsage struct {
+	UserID      string           `json:"user_id"`
+	Total       UsageTotals      `json:"total"`
+	ByOperation []OperationUsage `json:"by_operation"`
+	ByApp       []AppUsageTotals `json:"by_app"`
+}
@@ -3,44 +3,49 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"os/exec"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
 	"github.com/rapidbuildapp/rapidbuild/internal/db"
 	"github.com/rapidbuildapp/rapidbuild/internal/models"
 	"github.com/rapidbuildapp/rapidbuild/internal/utils"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AppService struct {
 	DB             *db.PostgresClient
-	MongoClient    *mongo.Client
+	AppManager     appmanager.Manager
 	GeminiService  *GeminiService
 	RunwareService *RunwareService
+	UsageService   *UsageService
+	StarterService *StarterService
 	S3Client       *s3.Client
 	Config         *config.Config
 }
 
 func NewAppService(
 	dbClient *db.PostgresClient,
-	mongoClient *mongo.Client,
+	appManager appmanager.Manager,
 	geminiService *GeminiService,
 	runwareService *RunwareService,
+	usageService *UsageService,
+	starterService *StarterService,
 	s3Client *s3.Client,
 	cfg *config.Config,
 ) *AppService {
 	return &AppService{
 		DB:             dbClient,
-		MongoClient:    mongoClient,
+		AppManager:     appManager,
 		GeminiService:  geminiService,
 		RunwareService: runwareService,
+		UsageService:   usageService,
+		StarterService: starterService,
 		S3Client:       s3Client,
 		Config:         cfg,
 	}
@@ -70,19 +75,29 @@ func (s *AppService) CreateApp(ctx context.Context, userID string, req models.Cr
 		UpdatedAt:     time.Now(),
 	}
 
+	// A starter picked by the user also brings its prompt template; otherwise
+	// the starter is inferred from the extracted category below
+	var promptTemplate *string
+	if req.Starter != "" {
+		app.StarterTemplate = &req.Starter
+		if starter, err := s.StarterService.GetStarter(ctx, req.Starter); err == nil && starter.PromptTemplate != "" {
+			promptTemplate = &starter.PromptTemplate
+		}
+	}
+
 	query := `
-		INSERT INTO apps (id, user_id, name, display_name, description, category, color_scheme, status, production_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, user_id, name, display_name, description, category, color_scheme, logo, status, prod_version, production_url, created_at, updated_at
+		INSERT INTO apps (id, user_id, name, display_name, description, category, color_scheme, status, production_url, starter_template, prompt_template, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, user_id, name, display_name, description, category, color_scheme, logo, status, prod_version, production_url, starter_template, created_at, updated_at
 	`
 
 	err := s.DB.QueryRow(ctx, query,
 		app.ID, app.UserID, app.Name, app.DisplayName, app.Description,
-		app.Category, app.ColorScheme, app.Status, app.ProductionURL, app.CreatedAt, app.UpdatedAt,
+		app.Category, app.ColorScheme, app.Status, app.ProductionURL, app.StarterTemplate, promptTemplate, app.CreatedAt, app.UpdatedAt,
 	).Scan(
 		&app.ID, &app.UserID, &app.Name, &app.DisplayName, &app.Description,
 		&app.Category, &app.ColorScheme, &app.Logo, &app.Status,
-		&app.ProdVersion, &app.ProductionURL, &app.CreatedAt, &app.UpdatedAt,
+		&app.ProdVersion, &app.ProductionURL, &app.StarterTemplate, &app.CreatedAt, &app.UpdatedAt,
 	)
 
 	if err != nil {
@@ -102,7 +117,8 @@ func (s *AppService) extractConfigAndSetupApp(appID, userID, description string)
 	log.Printf("[AI Setup] Starting async config extraction for app %s", appID)
 
 	// 1. Use Gemini to extract app configuration from description
-	appConfig, err := s.GeminiService.ExtractAppConfig(description)
+	appConfig, usage, err := s.GeminiService.ExtractAppConfig(description)
+	s.recordUsage(ctx, appID, usage)
 	if err != nil {
 		log.Printf("[AI Setup] Warning: Failed to extract config with Gemini, using defaults: %v", err)
 		// Fallback to defaults if Gemini fails
@@ -138,31 +154,29 @@ func (s *AppService) extractConfigAndSetupApp(appID, userID, description string)
 
 	log.Printf("[AI Setup] Updated PostgreSQL for app %s with AI-generated name '%s'", appID, appConfig.AppName)
 
-	// 3. Get owner email for MongoDB app creation
-	ownerEmail, err := s.GetOwnerEmail(ctx, userID)
-	if err != nil {
-		log.Printf("[AI Setup] Warning: Failed to get owner email: %v", err)
-		ownerEmail = "unknown@example.com"
+	// Pick the starter from the category unless the user chose one
+	if s.StarterService != nil {
+		starter := s.StarterService.InferStarter(ctx, appConfig.Category)
+		if picked, err := s.SetStarterTemplate(ctx, appID, starter); err != nil {
+			log.Printf("[AI Setup] Warning: Failed to set starter template: %v", err)
+		} else if picked {
+			log.Printf("[AI Setup] Picked starter '%s' for category '%s'", starter, appConfig.Category)
+		}
 	}
 
-	// 4. Create app in MongoDB with final AI-generated name (not temporary)
-	cmd := exec.CommandContext(ctx, "app-manager", "create", appID, "--name", appConfig.AppName, "--owner-email", ownerEmail)
-	cmd.Env = append(os.Environ(),
-		"PATH=/home/ubuntu/.local/share/pnpm:/usr/local/bin:/usr/bin:/bin",
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err = cmd.Run()
+	// 3. Create the app and its owner's admin account in MongoDB with the final
+	// AI-generated name (not temporary). Creation is idempotent and the build
+	// repeats it before applying schemas, so a failure here is not fatal.
+	ownerEmail, err := s.GetOwnerEmail(ctx, userID)
 	if err != nil {
-		log.Printf("[AI Setup] Warning: Failed to create MongoDB app: %v (stderr: %s)", err, stderr.String())
+		log.Printf("[AI Setup] Warning: Failed to get owner email, leaving MongoDB app creation to the build: %v", err)
+	} else if _, err := s.AppManager.CreateApp(ctx, appID, appConfig.AppName, ownerEmail); err != nil {
+		log.Printf("[AI Setup] Warning: Failed to create MongoDB app: %v", err)
 	} else {
 		log.Printf("[AI Setup] Created MongoDB app with AI-generated name '%s'", appConfig.AppName)
 	}
 
-	// 5. Launch async logo generation (non-blocking)
+	// 4. Launch async logo generation (non-blocking)
 	go s.generateAndUploadLogo(appID, appConfig.AppName, appConfig.Category, appConfig.ColorScheme)
 
 	log.Printf("[AI Setup] Completed async setup for app %s", appID)
@@ -172,7 +186,7 @@ func (s *AppService) extractConfigAndSetupApp(appID, userID, description string)
 func (s *AppService) GetApp(ctx context.Context, appID, userID string) (*models.App, error) {
 	app := &models.App{}
 	query := `
-		SELECT id, user_id, name, display_name, description, logo, category, color_scheme, status, prod_version, production_url, created_at, updated_at
+		SELECT id, user_id, name, display_name, description, logo, category, color_scheme, status, prod_version, production_url, starter_template, created_at, updated_at
 		FROM apps
 		WHERE id = $1 AND user_id = $2
 	`
@@ -180,7 +194,31 @@ func (s *AppService) GetApp(ctx context.Context, appID, userID string) (*models.
 	err := s.DB.QueryRow(ctx, query, appID, userID).Scan(
 		&app.ID, &app.UserID, &app.Name, &app.DisplayName, &app.Description,
 		&app.Logo, &app.Category, &app.ColorScheme, &app.Status,
-		&app.ProdVersion, &app.ProductionURL, &app.CreatedAt, &app.UpdatedAt,
+		&app.ProdVersion, &app.ProductionURL, &app.StarterTemplate, &app.CreatedAt, &app.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("app not found: %w", err)
+	}
+
+	return app, nil
+}
+
+// GetAppByID retrieves an app with its build settings, without an ownership check.
+// Used by the build worker, which acts on behalf of the app owner.
+func (s *AppService) GetAppByID(ctx context.Context, appID string) (*models.App, error) {
+	app := &models.App{}
+	query := `
+		SELECT id, user_id, name, display_name, description, logo, category, color_scheme, status, prod_version, production_url, vercel_project_id, code_generator, starter_template, created_at, updated_at
+		FROM apps
+		WHERE id = $1
+	`
+
+	err := s.DB.QueryRow(ctx, query, appID).Scan(
+		&app.ID, &app.UserID, &app.Name, &app.DisplayName, &app.Description,
+		&app.Logo, &app.Category, &app.ColorScheme, &app.Status,
+		&app.ProdVersion, &app.ProductionURL, &app.VercelProjectID, &app.CodeGenerator,
+		&app.StarterTemplate, &app.CreatedAt, &app.UpdatedAt,
 	)
 
 	if err != nil {
@@ -190,6 +228,27 @@ func (s *AppService) GetApp(ctx context.Context, appID, userID string) (*models.
 	return app, nil
 }
 
+// SetStarterTemplate picks the starter of an app that has none yet, along with
+// the starter's prompt template when the app has no prompt template. Returns
+// false when the app already had a starter.
+func (s *AppService) SetStarterTemplate(ctx context.Context, appID, starterRef string) (bool, error) {
+	var promptTemplate *string
+	if starter, err := s.StarterService.GetStarter(ctx, starterRef); err == nil && starter.PromptTemplate != "" {
+		promptTemplate = &starter.PromptTemplate
+	}
+
+	query := `
+		UPDATE apps
+		SET starter_template = $1, prompt_template = COALESCE(prompt_template, $2), updated_at = NOW()
+		WHERE id = $3 AND starter_template IS NULL
+	`
+	rowsAffected, err := s.DB.Exec(ctx, query, starterRef, promptTemplate, appID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set starter template: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
 // ListApps retrieves all apps for a user
 func (s *AppService) ListApps(ctx context.Context, userID string) ([]models.App, error) {
 	query := `
@@ -347,7 +406,8 @@ func (s *AppService) generateAndUploadLogo(appID, appName, category, colorScheme
 	log.Printf("[Logo] Starting async logo generation for app %s (%s)", appID, appName)
 
 	// 1. Generate logo using Runware
-	imageURL, err := s.RunwareService.GenerateLogo(appName, category, colorScheme)
+	imageURL, usage, err := s.RunwareService.GenerateLogo(appName, category, colorScheme)
+	s.recordUsage(ctx, appID, usage)
 	if err != nil {
 		log.Printf("[Logo] Failed to generate logo for app %s: %v", appID, err)
 		return
@@ -388,22 +448,29 @@ func (s *AppService) generateAndUploadLogo(appID, appName, category, colorScheme
 	}
 	log.Printf("[Logo] Updated PostgreSQL with logo for app %s", appID)
 
-	// 5. Update MongoDB (both name and logo) using app-manager CLI
-	cmd := exec.CommandContext(ctx, "app-manager", "update", appID, "--name", appName, "--logo", httpsURL)
-	cmd.Env = append(os.Environ(),
-		"PATH=/home/ubuntu/.local/share/pnpm:/usr/local/bin:/usr/bin:/bin",
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err = cmd.Run()
+	// 5. Update MongoDB (both name and logo)
+	_, err = s.AppManager.UpdateApp(ctx, appID, appmanager.AppUpdate{Name: &appName, Logo: &httpsURL})
+	if errors.Is(err, appmanager.ErrAppNotFound) {
+		log.Printf("[Logo] MongoDB app %s does not exist yet; the build copies the logo when it creates it", appID)
+		return
+	}
 	if err != nil {
-		log.Printf("[Logo] Failed to update MongoDB via app-manager for app %s: %v (stderr: %s)", appID, err, stderr.String())
+		log.Printf("[Logo] Failed to update MongoDB for app %s: %v", appID, err)
 		return
 	}
-	log.Printf("[Logo] Updated MongoDB with name '%s' and logo for app %s via app-manager", appName, appID)
+	log.Printf("[Logo] Updated MongoDB with name '%s' and logo for app %s", appName, appID)
 
 	log.Printf("[Logo] Successfully completed logo generation for app %s", appID)
 }
+
+// recordUsage stores the usage of an AI call made for an app. Failing to record
+// it does not fail the app setup.
+func (s *AppService) recordUsage(ctx context.Context, appID string, usage *models.UsageEvent) {
+	if usage == nil || s.UsageService == nil {
+		return
+	}
+	usage.AppID = appID
+	if err := s.UsageService.RecordUsage(ctx, *usage); err != nil {
+		log.Printf("[Usage] Warning: Failed to record %s usage for app %s: %v", usage.Operation, appID, err)
+	}
+}
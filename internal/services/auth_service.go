@@ -60,6 +60,7 @@ func (s *AuthService) Signup(ctx context.Context, email, password, fullName stri
 		PasswordHash:  &hashedPasswordStr,
 		FullName:      fullName,
 		EmailVerified: false,
+		Plan:          DefaultPlan,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -101,13 +102,13 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (string
 	// Get user
 	user := &models.User{}
 	query := `
-		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, created_at, updated_at
+		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, plan, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 	err := s.DB.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.AvatarURL,
-		&user.EmailVerified, &user.GoogleID, &user.CreatedAt, &user.UpdatedAt,
+		&user.EmailVerified, &user.GoogleID, &user.Plan, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return "", "", nil, errors.New("invalid email or password")
@@ -319,13 +320,13 @@ func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshToken strin
 func (s *AuthService) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	user := &models.User{}
 	query := `
-		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, created_at, updated_at
+		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, plan, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
 	err := s.DB.QueryRow(ctx, query, userID).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.AvatarURL,
-		&user.EmailVerified, &user.GoogleID, &user.CreatedAt, &user.UpdatedAt,
+		&user.EmailVerified, &user.GoogleID, &user.Plan, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, errors.New("user not found")
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// MaxBuildLogRead bounds how many bytes one ReadLog call returns
+const MaxBuildLogRead = 1024 * 1024
+
+// BuildLogService stores build logs as append-only chunks in S3 under
+// apps/{appId}/versions/{versionId}/logs/. Chunk keys sort in write order, so
+// the full log is the concatenation of all chunks and no attempt overwrites another.
+type BuildLogService struct {
+	S3Client *s3.Client
+	Config   *config.Config
+}
+
+func NewBuildLogService(s3Client *s3.Client, cfg *config.Config) *BuildLogService {
+	return &BuildLogService{
+		S3Client: s3Client,
+		Config:   cfg,
+	}
+}
+
+type buildLogChunk struct {
+	key  string
+	size int64
+}
+
+func buildLogPrefix(appID, versionID string) string {
+	return fmt.Sprintf("apps/%s/versions/%s/logs/", appID, versionID)
+}
+
+// AppendChunk writes the next chunk of a version's log. name describes the
+// chunk's stage (e.g. build-2) and only makes keys easier to browse.
+func (s *BuildLogService) AppendChunk(ctx context.Context, appID, versionID, name string, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s%020d-%s.log", buildLogPrefix(appID, versionID), time.Now().UnixNano(), name)
+	_, err := s.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Config.S3Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("text/plain; charset=utf-8"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload build log chunk: %w", err)
+	}
+
+	return nil
+}
+
+// ReadLog returns up to limit bytes of the log starting at offset. A negative
+// offset reads from the end (tail), e.g. -4096 returns the last 4KB.
+func (s *BuildLogService) ReadLog(ctx context.Context, appID, versionID string, offset, limit int64) (*models.BuildLogPage, error) {
+	if limit <= 0 || limit > MaxBuildLogRead {
+		limit = MaxBuildLogRead
+	}
+
+	chunks, err := s.listChunks(ctx, appID, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	for _, chunk := range chunks {
+		size += chunk.size
+	}
+
+	if offset < 0 {
+		offset = max(size+offset, 0)
+	}
+	offset = min(offset, size)
+	end := min(offset+limit, size)
+
+	var content strings.Builder
+	var chunkStart int64
+	for _, chunk := range chunks {
+		chunkEnd := chunkStart + chunk.size
+		if chunkEnd > offset && chunkStart < end {
+			from := max(offset, chunkStart) - chunkStart
+			to := min(end, chunkEnd) - chunkStart
+			if err := s.readRange(ctx, chunk.key, from, to, &content); err != nil {
+				return nil, err
+			}
+		}
+		chunkStart = chunkEnd
+	}
+
+	return &models.BuildLogPage{
+		VersionID:  versionID,
+		Offset:     offset,
+		NextOffset: end,
+		Size:       size,
+		Content:    content.String(),
+	}, nil
+}
+
+// listChunks returns the log chunks of a version in write order
+func (s *BuildLogService) listChunks(ctx context.Context, appID, versionID string) ([]buildLogChunk, error) {
+	var chunks []buildLogChunk
+
+	paginator := s3.NewListObjectsV2Paginator(s.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Config.S3Bucket),
+		Prefix: aws.String(buildLogPrefix(appID, versionID)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list build log chunks: %w", err)
+		}
+		for _, object := range page.Contents {
+			chunks = append(chunks, buildLogChunk{
+				key:  aws.ToString(object.Key),
+				size: aws.ToInt64(object.Size),
+			})
+		}
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].key < chunks[j].key })
+	return chunks, nil
+}
+
+// readRange appends bytes [from, to) of an object to w
+func (s *BuildLogService) readRange(ctx context.Context, key string, from, to int64, w io.Writer) error {
+	if from >= to {
+		return nil
+	}
+
+	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.S3Bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", from, to-1)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read build log chunk: %w", err)
+	}
+	defer result.Body.Close()
+
+	if _, err := io.Copy(w, result.Body); err != nil {
+		return fmt.Errorf("failed to read build log chunk: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// DefaultPlan is used for users without a plan or with an unknown one
+const DefaultPlan = "free"
+
+// planBuildPolicies holds the default policy of each plan and the most an app
+// on that plan may raise each limit to. Every existing user is on the free
+// plan, so its defaults match the limits builds ran under before plans.
+var planBuildPolicies = map[string]struct {
+	Defaults models.BuildPolicy
+	Limits   models.BuildPolicy
+}{
+	"free": {
+		Defaults: models.BuildPolicy{MaxAttempts: 3, AgentTimeoutMinutes: 360, LinkTimeoutMinutes: 2, BuildTimeoutMinutes: 10, VerifyTimeoutMinutes: 5, DeployTimeoutMinutes: 10, SchemaTimeoutMinutes: 2},
+		Limits:   models.BuildPolicy{MaxAttempts: 3, AgentTimeoutMinutes: 360, LinkTimeoutMinutes: 5, BuildTimeoutMinutes: 15, VerifyTimeoutMinutes: 10, DeployTimeoutMinutes: 15, SchemaTimeoutMinutes: 5},
+	},
+	"pro": {
+		Defaults: models.BuildPolicy{MaxAttempts: 3, AgentTimeoutMinutes: 360, LinkTimeoutMinutes: 2, BuildTimeoutMinutes: 10, VerifyTimeoutMinutes: 5, DeployTimeoutMinutes: 10, SchemaTimeoutMinutes: 2},
+		Limits:   models.BuildPolicy{MaxAttempts: 5, AgentTimeoutMinutes: 720, LinkTimeoutMinutes: 10, BuildTimeoutMinutes: 30, VerifyTimeoutMinutes: 30, DeployTimeoutMinutes: 30, SchemaTimeoutMinutes: 10},
+	},
+}
+
+// BuildPolicyService resolves the limits a build runs under: the app's own
+// overrides (apps.build_policy) on top of the defaults of the owner's plan
+type BuildPolicyService struct {
+	DB *db.PostgresClient
+}
+
+func NewBuildPolicyService(dbClient *db.PostgresClient) *BuildPolicyService {
+	return &BuildPolicyService{
+		DB: dbClient,
+	}
+}
+
+// PlanBuildPolicy returns the defaults and limits of a plan
+func PlanBuildPolicy(plan string) (defaults, limits models.BuildPolicy) {
+	p, ok := planBuildPolicies[plan]
+	if !ok {
+		p = planBuildPolicies[DefaultPlan]
+	}
+	return p.Defaults, p.Limits
+}
+
+// GetBuildPolicy returns the effective policy of an app with its plan, overrides and limits
+func (s *BuildPolicyService) GetBuildPolicy(ctx context.Context, appID string) (*models.AppBuildPolicy, error) {
+	var plan *string
+	var overrides *models.BuildPolicy
+	query := `
+		SELECT u.plan, a.build_policy
+		FROM apps a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.id = $1
+	`
+	err := s.DB.QueryRow(ctx, query, appID).Scan(&plan, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build policy: %w", err)
+	}
+
+	result := &models.AppBuildPolicy{Plan: DefaultPlan}
+	if plan != nil {
+		if _, ok := planBuildPolicies[*plan]; ok {
+			result.Plan = *plan
+		}
+	}
+	if overrides != nil {
+		result.Overrides = *overrides
+	}
+	result.Defaults, result.Limits = PlanBuildPolicy(result.Plan)
+	result.Policy = mergeBuildPolicy(result.Defaults, result.Overrides, result.Limits)
+
+	return result, nil
+}
+
+// UpdateBuildPolicy stores an app's overrides. Zero fields fall back to the plan default.
+func (s *BuildPolicyService) UpdateBuildPolicy(ctx context.Context, appID string, overrides models.BuildPolicy) error {
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return fmt.Errorf("failed to encode build policy: %w", err)
+	}
+
+	query := `UPDATE apps SET build_policy = $1, updated_at = NOW() WHERE id = $2`
+	rowsAffected, err := s.DB.Exec(ctx, query, data, appID)
+	if err != nil {
+		return fmt.Errorf("failed to update build policy: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("app not found")
+	}
+
+	return nil
+}
+
+// ValidateBuildPolicy checks overrides against the limits of a plan
+func ValidateBuildPolicy(plan string, overrides models.BuildPolicy) error {
+	_, limits := PlanBuildPolicy(plan)
+
+	var problems []string
+	check := func(name string, value, limit int) {
+		if value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", name))
+		} else if value > limit {
+			problems = append(problems, fmt.Sprintf("%s may be at most %d on the %s plan", name, limit, plan))
+		}
+	}
+	check("max_attempts", overrides.MaxAttempts, limits.MaxAttempts)
+	check("agent_timeout_minutes", overrides.AgentTimeoutMinutes, limits.AgentTimeoutMinutes)
+	check("link_timeout_minutes", overrides.LinkTimeoutMinutes, limits.LinkTimeoutMinutes)
+	check("build_timeout_minutes", overrides.BuildTimeoutMinutes, limits.BuildTimeoutMinutes)
+	check("verify_timeout_minutes", overrides.VerifyTimeoutMinutes, limits.VerifyTimeoutMinutes)
+	check("deploy_timeout_minutes", overrides.DeployTimeoutMinutes, limits.DeployTimeoutMinutes)
+	check("schema_timeout_minutes", overrides.SchemaTimeoutMinutes, limits.SchemaTimeoutMinutes)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid build policy: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// mergeBuildPolicy applies overrides to defaults, capped at limits (the plan
+// may have been downgraded since the overrides were stored)
+func mergeBuildPolicy(defaults, overrides, limits models.BuildPolicy) models.BuildPolicy {
+	pick := func(def, override, limit int) int {
+		if override <= 0 {
+			return def
+		}
+		return min(override, limit)
+	}
+	return models.BuildPolicy{
+		MaxAttempts:          pick(defaults.MaxAttempts, overrides.MaxAttempts, limits.MaxAttempts),
+		AgentTimeoutMinutes:  pick(defaults.AgentTimeoutMinutes, overrides.AgentTimeoutMinutes, limits.AgentTimeoutMinutes),
+		LinkTimeoutMinutes:   pick(defaults.LinkTimeoutMinutes, overrides.LinkTimeoutMinutes, limits.LinkTimeoutMinutes),
+		BuildTimeoutMinutes:  pick(defaults.BuildTimeoutMinutes, overrides.BuildTimeoutMinutes, limits.BuildTimeoutMinutes),
+		VerifyTimeoutMinutes: pick(defaults.VerifyTimeoutMinutes, overrides.VerifyTimeoutMinutes, limits.VerifyTimeoutMinutes),
+		DeployTimeoutMinutes: pick(defaults.DeployTimeoutMinutes, overrides.DeployTimeoutMinutes, limits.DeployTimeoutMinutes),
+		SchemaTimeoutMinutes: pick(defaults.SchemaTimeoutMinutes, overrides.SchemaTimeoutMinutes, limits.SchemaTimeoutMinutes),
+	}
+}
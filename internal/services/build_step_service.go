@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+type BuildStepService struct {
+	DB *db.PostgresClient
+}
+
+func NewBuildStepService(dbClient *db.PostgresClient) *BuildStepService {
+	return &BuildStepService{DB: dbClient}
+}
+
+// StartStep records the start of a build stage
+func (s *BuildStepService) StartStep(ctx context.Context, versionID, name string, attempt int) (*models.BuildStep, error) {
+	step := &models.BuildStep{}
+	query := `
+		INSERT INTO build_steps (version_id, name, attempt, status, started_at)
+		VALUES ($1, $2, $3, 'running', $4)
+		RETURNING id, version_id, name, attempt, status, exit_code, log, started_at, finished_at
+	`
+
+	err := s.DB.QueryRow(ctx, query, versionID, name, attempt, time.Now()).Scan(
+		&step.ID, &step.VersionID, &step.Name, &step.Attempt, &step.Status,
+		&step.ExitCode, &step.Log, &step.StartedAt, &step.FinishedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start build step: %w", err)
+	}
+
+	return step, nil
+}
+
+// FinishStep records the outcome of a build stage
+func (s *BuildStepService) FinishStep(ctx context.Context, stepID, status string, exitCode *int, log string) error {
+	query := `UPDATE build_steps SET status = $1, exit_code = $2, log = $3, finished_at = $4 WHERE id = $5`
+
+	if _, err := s.DB.Exec(ctx, query, status, exitCode, log, time.Now(), stepID); err != nil {
+		return fmt.Errorf("failed to finish build step: %w", err)
+	}
+
+	return nil
+}
+
+// AbortRunningSteps closes steps left running by a build that died with its worker
+func (s *BuildStepService) AbortRunningSteps(ctx context.Context, versionID, status string) error {
+	query := `UPDATE build_steps SET status = $1, finished_at = $2 WHERE version_id = $3 AND status = 'running'`
+
+	if _, err := s.DB.Exec(ctx, query, status, time.Now(), versionID); err != nil {
+		return fmt.Errorf("failed to abort build steps: %w", err)
+	}
+
+	return nil
+}
+
+// ListSteps returns the steps of a version in the order they ran, without
+// their logs (see GetStepLog)
+func (s *BuildStepService) ListSteps(ctx context.Context, versionID string) ([]models.BuildStep, error) {
+	query := `
+		SELECT id, version_id, name, attempt, status, exit_code, started_at, finished_at
+		FROM build_steps
+		WHERE version_id = $1
+		ORDER BY started_at ASC
+	`
+
+	rows, err := s.DB.Query(ctx, query, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build steps: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []models.BuildStep{}
+	for rows.Next() {
+		var step models.BuildStep
+		err := rows.Scan(
+			&step.ID, &step.VersionID, &step.Name, &step.Attempt, &step.Status,
+			&step.ExitCode, &step.StartedAt, &step.FinishedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan build step: %w", err)
+		}
+
+		if step.FinishedAt != nil {
+			durationMs := step.FinishedAt.Sub(step.StartedAt).Milliseconds()
+			step.DurationMs = &durationMs
+		}
+		steps = append(steps, step)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating build steps: %w", err)
+	}
+
+	return steps, nil
+}
+
+// GetStepLog returns the log stored for one step of a version
+func (s *BuildStepService) GetStepLog(ctx context.Context, versionID, stepID string) (string, error) {
+	query := `SELECT COALESCE(log, '') FROM build_steps WHERE id = $1 AND version_id = $2`
+
+	var log string
+	err := s.DB.QueryRow(ctx, query, stepID, versionID).Scan(&log)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("build step not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get build step log: %w", err)
+	}
+
+	return log, nil
+}
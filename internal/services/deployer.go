@@ -0,0 +1,64 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+)
+
+// Deployer builds a generated workspace and publishes it to a hosting provider.
+// A project groups all deployments of one app; its ID is stored in
+// apps.vercel_project_id and each deployment ID in versions.vercel_deploy_id.
+// Commands started by Link, Build and Deploy copy their stdout and stderr to
+// output (which may be nil) so callers can capture or stream them. They run
+// until ctx is done; callers bound them with the app's build policy.
+type Deployer interface {
+	// Name identifies the deployer (vercel, local)
+	Name() string
+	// Link creates or attaches the hosting project for a fresh workspace and returns its ID
+	Link(ctx context.Context, workspaceDir, appID string, output io.Writer) (string, error)
+	// ProjectID reads the project ID recorded in an already linked workspace
+	ProjectID(workspaceDir string) (string, error)
+	// Build produces the deployable output inside the workspace
+	Build(ctx context.Context, workspaceDir string, output io.Writer) error
+	// Deploy publishes the built output as a preview deployment
+	Deploy(ctx context.Context, workspaceDir, appID, versionID string, output io.Writer) (*Deployment, error)
+	// Promote points the production domain at a deployment
+	Promote(ctx context.Context, projectID, deploymentID, domain string) error
+	// AddDomain attaches a custom domain to the project
+	AddDomain(ctx context.Context, projectID, domain string) error
+	// Status reports the current state of a deployment
+	Status(ctx context.Context, deploymentID string) (*Deployment, error)
+}
+
+// Deployment is a single published build
+type Deployment struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	State string `json:"state"` // READY, BUILDING, ERROR, NOT_FOUND
+}
+
+// NewDeployer returns the deployer selected by cfg.Deployer
+// and runs its commands through exec
+func NewDeployer(cfg *config.Config, vercelService *VercelService, exec executor.Executor) (Deployer, error) {
+	switch cfg.Deployer {
+	case "", "vercel":
+		return NewVercelDeployer(vercelService, exec), nil
+	case "local":
+		return NewLocalDeployer(cfg.LocalDeployDir, cfg.LocalDeployBaseURL, exec), nil
+	default:
+		return nil, fmt.Errorf("unknown deployer %q", cfg.Deployer)
+	}
+}
+
+// commandOutput tees a command stream into buf and the caller's output writer
+func commandOutput(buf *bytes.Buffer, output io.Writer) io.Writer {
+	if output == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, output)
+}
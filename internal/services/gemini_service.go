@@ -7,6 +7,17 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// geminiModel extracts app configs. Gemini does not report cost, so it is
+// estimated from the model's price per million tokens.
+const (
+	geminiModel                 = "gemini-2.5-flash"
+	geminiInputPricePerMillion  = 0.30
+	geminiOutputPricePerMillion = 2.50
 )
 
 type GeminiService struct {
@@ -43,6 +54,11 @@ type geminiResponse struct {
 			} `json:"parts"`
 		} `json:"content"`
 	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int64 `json:"promptTokenCount"`
+		CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int64 `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
 }
 
 func NewGeminiService(apiKey string) *GeminiService {
@@ -51,8 +67,9 @@ func NewGeminiService(apiKey string) *GeminiService {
 	}
 }
 
-// ExtractAppConfig uses Gemini Flash to extract app configuration from description
-func (s *GeminiService) ExtractAppConfig(description string) (*AppConfig, error) {
+// ExtractAppConfig uses Gemini Flash to extract app configuration from description.
+// The usage is returned whenever Gemini answered, also if the answer was not usable.
+func (s *GeminiService) ExtractAppConfig(description string) (*AppConfig, *models.UsageEvent, error) {
 	prompt := fmt.Sprintf(`Analyze this app description and extract configuration as JSON:
 
 Description: "%s"
@@ -95,31 +112,33 @@ Rules:
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Call Gemini Flash API
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent?key=%s", s.APIKey)
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", geminiModel, s.APIKey)
 
+	start := time.Now()
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to call Gemini API: %w", err)
+		return nil, nil, fmt.Errorf("failed to call Gemini API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, nil, fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// Parse response
 	var geminiResp geminiResponse
 	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
-		return nil, fmt.Errorf("failed to decode Gemini response: %w", err)
+		return nil, nil, fmt.Errorf("failed to decode Gemini response: %w", err)
 	}
+	usage := geminiUsage(geminiResp, time.Since(start))
 
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("empty response from Gemini")
+		return nil, usage, fmt.Errorf("empty response from Gemini")
 	}
 
 	// Extract JSON from response
@@ -135,7 +154,7 @@ Rules:
 	// Parse extracted config
 	var config AppConfig
 	if err := json.Unmarshal([]byte(responseText), &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config JSON: %w (response: %s)", err, responseText)
+		return nil, usage, fmt.Errorf("failed to parse config JSON: %w (response: %s)", err, responseText)
 	}
 
 	// Validate config
@@ -155,5 +174,22 @@ Rules:
 		config.Keywords = []string{"app"}
 	}
 
-	return &config, nil
+	return &config, usage, nil
+}
+
+// geminiUsage returns the tokens of a Gemini response with their estimated
+// cost. Thinking tokens are billed as output.
+func geminiUsage(resp geminiResponse, duration time.Duration) *models.UsageEvent {
+	model := geminiModel
+	meta := resp.UsageMetadata
+	usage := &models.UsageEvent{
+		Provider:     "gemini",
+		Operation:    UsageAppConfig,
+		Model:        &model,
+		InputTokens:  meta.PromptTokenCount,
+		OutputTokens: meta.CandidatesTokenCount + meta.ThoughtsTokenCount,
+		DurationMs:   duration.Milliseconds(),
+	}
+	usage.CostUSD = (float64(usage.InputTokens)*geminiInputPricePerMillion + float64(usage.OutputTokens)*geminiOutputPricePerMillion) / 1e6
+	return usage
 }
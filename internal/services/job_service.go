@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+const buildJobColumns = `id, version_id, app_id, status, payload, cancel_requested, attempts, max_attempts, worker_id, last_error, heartbeat_at, started_at, finished_at, created_at`
+
+// ErrLeaseLost is returned by Heartbeat when the job is no longer running on
+// the worker, e.g. because its lease expired and it was requeued
+var ErrLeaseLost = errors.New("build job lease lost")
+
+type JobService struct {
+	DB *db.PostgresClient
+}
+
+func NewJobService(dbClient *db.PostgresClient) *JobService {
+	return &JobService{DB: dbClient}
+}
+
+// EnqueueBuild adds a build job for a version to the queue
+func (s *JobService) EnqueueBuild(ctx context.Context, versionID, appID string, payload models.BuildJobPayload) (*models.BuildJob, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	query := `
+		INSERT INTO build_jobs (id, version_id, app_id, status, payload, created_at, updated_at)
+		VALUES ($1, $2, $3, 'queued', $4, $5, $5)
+		RETURNING ` + buildJobColumns
+
+	job, err := scanBuildJob(s.DB.QueryRow(ctx, query, uuid.New().String(), versionID, appID, string(payloadJSON), time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue build job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ClaimJob atomically claims the oldest queued job for the given worker.
+// Builds for the same app are serialized: a job is only claimable when no other
+// job of its app is running and no older job of its app is still queued. A
+// per-app advisory lock makes that check safe across concurrent workers.
+// Returns nil without an error when no job is claimable.
+func (s *JobService) ClaimJob(ctx context.Context, workerID string) (*models.BuildJob, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin claim transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	candidatesQuery := `
+		SELECT j.id, j.app_id FROM build_jobs j
+		WHERE j.status = 'queued'
+		  AND NOT EXISTS (
+			SELECT 1 FROM build_jobs o
+			WHERE o.app_id = j.app_id
+			  AND (o.status = 'running' OR (o.status = 'queued' AND o.created_at < j.created_at))
+		  )
+		ORDER BY j.created_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 10
+	`
+
+	rows, err := tx.Query(ctx, candidatesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find claimable jobs: %w", err)
+	}
+
+	type candidate struct{ jobID, appID string }
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.jobID, &c.appID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan claimable job: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating claimable jobs: %w", err)
+	}
+
+	for _, c := range candidates {
+		// Another worker is claiming a job for this app right now
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, c.appID).Scan(&locked); err != nil {
+			return nil, fmt.Errorf("failed to lock app %s: %w", c.appID, err)
+		}
+		if !locked {
+			continue
+		}
+
+		// Re-check under the lock in case a job for this app started since the candidates were read
+		var running bool
+		runningQuery := `SELECT EXISTS (SELECT 1 FROM build_jobs WHERE app_id = $1 AND status = 'running')`
+		if err := tx.QueryRow(ctx, runningQuery, c.appID).Scan(&running); err != nil {
+			return nil, fmt.Errorf("failed to check running jobs for app %s: %w", c.appID, err)
+		}
+		if running {
+			continue
+		}
+
+		now := time.Now()
+		claimQuery := `
+			UPDATE build_jobs
+			SET status = 'running', worker_id = $1, attempts = attempts + 1,
+			    heartbeat_at = $2, started_at = $2, updated_at = $2
+			WHERE id = $3
+			RETURNING ` + buildJobColumns
+
+		job, err := scanBuildJob(tx.QueryRow(ctx, claimQuery, workerID, now, c.jobID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim build job: %w", err)
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit job claim: %w", err)
+		}
+
+		return job, nil
+	}
+
+	return nil, nil
+}
+
+// Heartbeat extends the lease on a running job held by the given worker and
+// reports whether cancellation of the job has been requested
+func (s *JobService) Heartbeat(ctx context.Context, jobID, workerID string) (bool, error) {
+	query := `
+		UPDATE build_jobs
+		SET heartbeat_at = $1, updated_at = $1
+		WHERE id = $2 AND worker_id = $3 AND status = 'running'
+		RETURNING cancel_requested
+	`
+
+	var cancelRequested bool
+	err := s.DB.QueryRow(ctx, query, time.Now(), jobID, workerID).Scan(&cancelRequested)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("%w: build job %s is no longer held by worker %s", ErrLeaseLost, jobID, workerID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to heartbeat build job: %w", err)
+	}
+
+	return cancelRequested, nil
+}
+
+// RequestCancel cancels the active build job of a version. Queued jobs are
+// cancelled immediately; running jobs are flagged for their worker to stop.
+func (s *JobService) RequestCancel(ctx context.Context, versionID string) (*models.BuildJob, error) {
+	now := time.Now()
+	query := `
+		UPDATE build_jobs
+		SET cancel_requested = TRUE,
+		    status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+		    finished_at = CASE WHEN status = 'queued' THEN $1 ELSE finished_at END,
+		    updated_at = $1
+		WHERE version_id = $2 AND status IN ('queued', 'running')
+		RETURNING ` + buildJobColumns
+
+	job, err := scanBuildJob(s.DB.QueryRow(ctx, query, now, versionID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("no active build for version")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel build job: %w", err)
+	}
+
+	return job, nil
+}
+
+// CompleteJob marks a job as completed
+func (s *JobService) CompleteJob(ctx context.Context, jobID string) error {
+	return s.finishJob(ctx, jobID, "completed", nil)
+}
+
+// CancelJob marks a job as cancelled
+func (s *JobService) CancelJob(ctx context.Context, jobID string) error {
+	return s.finishJob(ctx, jobID, "cancelled", nil)
+}
+
+// FailJob marks a job as failed with the given error
+func (s *JobService) FailJob(ctx context.Context, jobID, errMsg string) error {
+	return s.finishJob(ctx, jobID, "failed", &errMsg)
+}
+
+func (s *JobService) finishJob(ctx context.Context, jobID, status string, errMsg *string) error {
+	now := time.Now()
+	query := `
+		UPDATE build_jobs
+		SET status = $1, last_error = COALESCE($2, last_error), finished_at = $3, updated_at = $3
+		WHERE id = $4
+	`
+
+	if _, err := s.DB.Exec(ctx, query, status, errMsg, now, jobID); err != nil {
+		return fmt.Errorf("failed to mark build job %s: %w", status, err)
+	}
+
+	return nil
+}
+
+// RequeueOrphanedJobs puts running jobs whose lease expired back in the queue.
+// Jobs that already used all their attempts, or whose cancellation was
+// requested, are finished instead and returned so the caller can update their
+// versions.
+func (s *JobService) RequeueOrphanedJobs(ctx context.Context, leaseTimeout time.Duration) ([]models.BuildJob, error) {
+	now := time.Now()
+	staleBefore := now.Add(-leaseTimeout)
+
+	requeueQuery := `
+		UPDATE build_jobs
+		SET status = 'queued', worker_id = NULL, last_error = 'worker lease expired', updated_at = $1
+		WHERE status = 'running' AND heartbeat_at < $2 AND attempts < max_attempts AND NOT cancel_requested
+	`
+	if _, err := s.DB.Exec(ctx, requeueQuery, now, staleBefore); err != nil {
+		return nil, fmt.Errorf("failed to requeue orphaned jobs: %w", err)
+	}
+
+	failQuery := `
+		UPDATE build_jobs
+		SET status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'failed' END,
+		    last_error = 'worker lease expired', finished_at = $1, updated_at = $1
+		WHERE status = 'running' AND heartbeat_at < $2
+		RETURNING ` + buildJobColumns
+
+	rows, err := s.DB.Query(ctx, failQuery, now, staleBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish orphaned jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.BuildJob
+	for rows.Next() {
+		job, err := scanBuildJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan build job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating build jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func scanBuildJob(row db.Row) (*models.BuildJob, error) {
+	job := &models.BuildJob{}
+	var payload []byte
+
+	err := row.Scan(
+		&job.ID, &job.VersionID, &job.AppID, &job.Status, &payload, &job.CancelRequested,
+		&job.Attempts, &job.MaxAttempts, &job.WorkerID, &job.LastError,
+		&job.HeartbeatAt, &job.StartedAt, &job.FinishedAt, &job.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &job.Payload); err != nil {
+			return nil, fmt.Errorf("failed to parse job payload: %w", err)
+		}
+	}
+
+	return job, nil
+}
+
+// GetLatestJobForVersion retrieves the most recent build job for a version
+func (s *JobService) GetLatestJobForVersion(ctx context.Context, versionID string) (*models.BuildJob, error) {
+	query := `
+		SELECT ` + buildJobColumns + `
+		FROM build_jobs
+		WHERE version_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	job, err := scanBuildJob(s.DB.QueryRow(ctx, query, versionID))
+	if err != nil {
+		return nil, fmt.Errorf("build job not found: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetBlockingVersion returns the version number of the build that a queued job
+// is waiting on: the running build of the same app, or the newest older job of
+// the same app that is still queued. Returns nil when the job is not blocked.
+func (s *JobService) GetBlockingVersion(ctx context.Context, job *models.BuildJob) (*int, error) {
+	if job.Status != "queued" {
+		return nil, nil
+	}
+
+	query := `
+		SELECT v.version_number
+		FROM build_jobs o
+		JOIN versions v ON v.id = o.version_id
+		WHERE o.app_id = $1 AND o.id <> $2
+		  AND (o.status = 'running' OR (o.status = 'queued' AND o.created_at < $3))
+		ORDER BY (o.status = 'running') ASC, o.created_at DESC
+		LIMIT 1
+	`
+
+	var versionNumber int
+	err := s.DB.QueryRow(ctx, query, job.AppID, job.ID, job.CreatedAt).Scan(&versionNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find blocking build: %w", err)
+	}
+
+	return &versionNumber, nil
+}
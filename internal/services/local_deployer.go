@@ -0,0 +1,371 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// LocalDeployer builds the workspace with npm and publishes the static output
+// to a directory on disk, served by its ServeHTTP handler. It needs no external
+// accounts, so the whole pipeline can run offline.
+//
+// Layout under Dir:
+//
+//	deployments/{deploymentID}/   built output of one version
+//	projects/{projectID}.json     production deployment and domains of an app
+type LocalDeployer struct {
+	Dir      string
+	BaseURL  string
+	Executor executor.Executor
+
+	mu sync.Mutex // guards project files
+}
+
+// localProject is the on-disk state of a local project
+type localProject struct {
+	ID                     string   `json:"id"`
+	ProductionDeploymentID string   `json:"production_deployment_id,omitempty"`
+	Domains                []string `json:"domains,omitempty"`
+}
+
+// localOutputDirs are checked in order for the built static output
+var localOutputDirs = []string{"dist", "build", "out", filepath.Join(".vercel", "output", "static")}
+
+var localIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func NewLocalDeployer(dir, baseURL string, exec executor.Executor) *LocalDeployer {
+	return &LocalDeployer{
+		Dir:      dir,
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		Executor: exec,
+	}
+}
+
+func (d *LocalDeployer) Name() string {
+	return "local"
+}
+
+// Link records the app ID as the project ID in .rapidbuild/project.json
+func (d *LocalDeployer) Link(ctx context.Context, workspaceDir, appID string, output io.Writer) (string, error) {
+	if !localIDPattern.MatchString(appID) {
+		return "", fmt.Errorf("invalid project ID %q", appID)
+	}
+
+	metaDir := filepath.Join(workspaceDir, ".rapidbuild")
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create .rapidbuild directory: %w", err)
+	}
+
+	data, err := json.Marshal(localProject{ID: appID})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(metaDir, "project.json"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write project.json: %w", err)
+	}
+
+	if _, err := d.updateProject(appID, func(p *localProject) {}); err != nil {
+		return "", err
+	}
+
+	log.Printf("[LocalDeploy] Linked project %s\n", appID)
+	return appID, nil
+}
+
+// ProjectID reads the project ID from .rapidbuild/project.json
+func (d *LocalDeployer) ProjectID(workspaceDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(workspaceDir, ".rapidbuild", "project.json"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read project.json: %w", err)
+	}
+
+	var project localProject
+	if err := json.Unmarshal(data, &project); err != nil {
+		return "", fmt.Errorf("failed to parse project.json: %w", err)
+	}
+
+	return project.ID, nil
+}
+
+// Build runs npm install and npm run build in the workspace
+func (d *LocalDeployer) Build(ctx context.Context, workspaceDir string, output io.Writer) error {
+	log.Printf("[LocalDeploy] Building project in %s\n", workspaceDir)
+
+	for _, args := range [][]string{{"install"}, {"run", "build"}} {
+		var stdout, stderr bytes.Buffer
+		err := d.Executor.Run(ctx, executor.Command{
+			Name:   "npm",
+			Args:   args,
+			Dir:    workspaceDir,
+			Stdout: commandOutput(&stdout, output),
+			Stderr: commandOutput(&stderr, output),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// Build tools report compile errors on stdout, keep both for the fix loop
+			errorMsg := strings.TrimSpace(stderr.String() + "\n" + stdout.String())
+			if errorMsg == "" {
+				errorMsg = err.Error()
+			}
+			return &utils.CommandError{Message: fmt.Sprintf("npm %s failed: %s", strings.Join(args, " "), errorMsg), Err: err}
+		}
+	}
+
+	if _, err := d.outputDir(workspaceDir); err != nil {
+		return err
+	}
+
+	log.Printf("[LocalDeploy] Build successful in %s\n", workspaceDir)
+	return nil
+}
+
+// Deploy copies the built output to deployments/{versionID}
+func (d *LocalDeployer) Deploy(ctx context.Context, workspaceDir, appID, versionID string, output io.Writer) (*Deployment, error) {
+	if !localIDPattern.MatchString(versionID) {
+		return nil, fmt.Errorf("invalid deployment ID %q", versionID)
+	}
+
+	outputDir, err := d.outputDir(workspaceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDir := filepath.Join(d.Dir, "deployments", versionID)
+	if err := os.RemoveAll(targetDir); err != nil {
+		return nil, fmt.Errorf("failed to clear previous deployment: %w", err)
+	}
+	if err := copyDir(outputDir, targetDir); err != nil {
+		return nil, fmt.Errorf("failed to copy build output: %w", err)
+	}
+
+	deployment := &Deployment{ID: versionID, URL: d.deploymentURL(versionID), State: "READY"}
+	if output != nil {
+		fmt.Fprintf(output, "Copied %s to %s\n", outputDir, targetDir)
+	}
+	log.Printf("[LocalDeploy] Deployment successful: %s\n", deployment.URL)
+	return deployment, nil
+}
+
+// Promote makes the deployment the production deployment of the project
+func (d *LocalDeployer) Promote(ctx context.Context, projectID, deploymentID, domain string) error {
+	if _, err := os.Stat(filepath.Join(d.Dir, "deployments", deploymentID)); err != nil {
+		return fmt.Errorf("deployment %s not found", deploymentID)
+	}
+
+	_, err := d.updateProject(projectID, func(p *localProject) {
+		p.ProductionDeploymentID = deploymentID
+		addDomain(p, domain)
+	})
+	return err
+}
+
+// AddDomain records a domain for the project
+func (d *LocalDeployer) AddDomain(ctx context.Context, projectID, domain string) error {
+	_, err := d.updateProject(projectID, func(p *localProject) {
+		addDomain(p, domain)
+	})
+	return err
+}
+
+// Status reports READY if the deployment exists on disk
+func (d *LocalDeployer) Status(ctx context.Context, deploymentID string) (*Deployment, error) {
+	if !localIDPattern.MatchString(deploymentID) {
+		return nil, fmt.Errorf("invalid deployment ID %q", deploymentID)
+	}
+
+	deployment := &Deployment{ID: deploymentID, URL: d.deploymentURL(deploymentID), State: "READY"}
+	if _, err := os.Stat(filepath.Join(d.Dir, "deployments", deploymentID)); err != nil {
+		deployment.State = "NOT_FOUND"
+	}
+	return deployment, nil
+}
+
+// ServeHTTP serves deployments at /{deploymentID}/... and the production
+// deployment of a project at /production/{projectID}/... (mount with
+// http.StripPrefix). Unknown paths fall back to index.html for SPA routing.
+func (d *LocalDeployer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+
+	var deploymentID, filePath string
+	if parts[0] == "production" && len(parts) >= 2 {
+		project, err := d.readProject(parts[1])
+		if err != nil || project.ProductionDeploymentID == "" {
+			http.NotFound(w, r)
+			return
+		}
+		deploymentID = project.ProductionDeploymentID
+		if len(parts) == 3 {
+			filePath = parts[2]
+		}
+	} else {
+		deploymentID = parts[0]
+		if len(parts) >= 2 {
+			filePath = strings.Join(parts[1:], "/")
+		}
+	}
+
+	if !localIDPattern.MatchString(deploymentID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	root := filepath.Join(d.Dir, "deployments", deploymentID)
+	name := path.Clean("/" + filePath)
+	if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil || info.IsDir() {
+		name = "/index.html"
+	}
+
+	file, err := http.Dir(root).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+func (d *LocalDeployer) deploymentURL(deploymentID string) string {
+	return fmt.Sprintf("%s/%s/", d.BaseURL, deploymentID)
+}
+
+// outputDir finds the built static output in the workspace
+func (d *LocalDeployer) outputDir(workspaceDir string) (string, error) {
+	for _, dir := range localOutputDirs {
+		candidate := filepath.Join(workspaceDir, dir)
+		if _, err := os.Stat(filepath.Join(candidate, "index.html")); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no build output with index.html found (looked in %s)", strings.Join(localOutputDirs, ", "))
+}
+
+func (d *LocalDeployer) projectPath(projectID string) (string, error) {
+	if !localIDPattern.MatchString(projectID) {
+		return "", fmt.Errorf("invalid project ID %q", projectID)
+	}
+	return filepath.Join(d.Dir, "projects", projectID+".json"), nil
+}
+
+func (d *LocalDeployer) readProject(projectID string) (*localProject, error) {
+	projectPath, err := d.projectPath(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var project localProject
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse project %s: %w", projectID, err)
+	}
+	return &project, nil
+}
+
+// updateProject loads (or creates) a project, applies fn and writes it back
+func (d *LocalDeployer) updateProject(projectID string, fn func(p *localProject)) (*localProject, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	projectPath, err := d.projectPath(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := d.readProject(projectID)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		project = &localProject{ID: projectID}
+	}
+
+	fn(project)
+
+	data, err := json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(projectPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create projects directory: %w", err)
+	}
+	if err := os.WriteFile(projectPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write project %s: %w", projectID, err)
+	}
+	return project, nil
+}
+
+func addDomain(p *localProject, domain string) {
+	if domain == "" {
+		return
+	}
+	for _, existing := range p.Domains {
+		if existing == domain {
+			return
+		}
+	}
+	p.Domains = append(p.Domains, domain)
+}
+
+// copyDir copies the regular files and directories under src to dst
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -170,13 +170,13 @@ func (s *OAuthService) getGoogleUserInfo(ctx context.Context, accessToken string
 func (s *OAuthService) getUserByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
 	user := &models.User{}
 	query := `
-		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, created_at, updated_at
+		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, plan, created_at, updated_at
 		FROM users
 		WHERE google_id = $1
 	`
 	err := s.DB.QueryRow(ctx, query, googleID).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.AvatarURL,
-		&user.EmailVerified, &user.GoogleID, &user.CreatedAt, &user.UpdatedAt,
+		&user.EmailVerified, &user.GoogleID, &user.Plan, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, errors.New("user not found")
@@ -189,13 +189,13 @@ func (s *OAuthService) getUserByGoogleID(ctx context.Context, googleID string) (
 func (s *OAuthService) getUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
 	query := `
-		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, created_at, updated_at
+		SELECT id, email, password_hash, full_name, avatar_url, email_verified, google_id, plan, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 	err := s.DB.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.AvatarURL,
-		&user.EmailVerified, &user.GoogleID, &user.CreatedAt, &user.UpdatedAt,
+		&user.EmailVerified, &user.GoogleID, &user.Plan, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, errors.New("user not found")
@@ -224,6 +224,7 @@ func (s *OAuthService) createUserFromGoogle(ctx context.Context, googleUser *Goo
 		AvatarURL:     &googleUser.Picture,
 		EmailVerified: googleUser.VerifiedEmail,
 		GoogleID:      &googleUser.ID,
+		Plan:          DefaultPlan,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
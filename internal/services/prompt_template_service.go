@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// builtinPrompts holds the templates shipped with the binary, in prompts/{name}/{version}/
+//
+//go:embed prompts
+var builtinPrompts embed.FS
+
+// MaxCustomInstructions bounds the custom instructions injected into every prompt of an app
+const MaxCustomInstructions = 4000
+
+// Prompt template files of a template version
+const (
+	generatePromptFile = "generate.tmpl"
+	fixPromptFile      = "fix.tmpl"
+)
+
+// PromptTemplate is one version of a prompt template: the prompt for code
+// generation and the prompt for fixing build errors
+type PromptTemplate struct {
+	Name     string
+	Version  int
+	Source   string // database, files or builtin
+	generate *template.Template
+	fix      *template.Template
+}
+
+// Ref is how versions record the template they were generated with, e.g. default@1
+func (t *PromptTemplate) Ref() string {
+	return fmt.Sprintf("%s@%d", t.Name, t.Version)
+}
+
+// GeneratePromptData is available to generate templates
+type GeneratePromptData struct {
+	AppID              string
+	Requirements       string
+	CustomInstructions string
+	Comments           []models.Comment
+	Files              []PromptFile
+}
+
+// PromptFile is a requirement file downloaded into the workspace
+type PromptFile struct {
+	Name      string // Original file name
+	Path      string // Path relative to the workspace, e.g. requirements/01-spec.md
+	Image     bool
+	Text      string // Inlined content of text files; empty for images and binary files
+	Truncated bool   // Text holds only the start of the file
+}
+
+// FixPromptData is available to fix templates
+type FixPromptData struct {
+	Attempt            int
+	MaxAttempts        int
+	Errors             string
+	CustomInstructions string
+}
+
+// RenderGenerate renders the code generation prompt
+func (t *PromptTemplate) RenderGenerate(data GeneratePromptData) (string, error) {
+	return renderPrompt(t.generate, data)
+}
+
+// RenderFix renders the prompt for fixing build errors
+func (t *PromptTemplate) RenderFix(data FixPromptData) (string, error) {
+	return renderPrompt(t.fix, data)
+}
+
+func renderPrompt(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// PromptTemplateService resolves prompt templates from the prompt_templates
+// table, PROMPT_TEMPLATES_DIR and the built-in templates, in that order, and
+// stores the prompt settings of apps
+type PromptTemplateService struct {
+	DB     *db.PostgresClient
+	Config *config.Config
+}
+
+func NewPromptTemplateService(dbClient *db.PostgresClient, cfg *config.Config) *PromptTemplateService {
+	return &PromptTemplateService{
+		DB:     dbClient,
+		Config: cfg,
+	}
+}
+
+// GetTemplate resolves a template reference: "name" for the latest version or "name@version"
+func (s *PromptTemplateService) GetTemplate(ctx context.Context, ref string) (*PromptTemplate, error) {
+	name, version, err := parseTemplateRef("prompt template", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == 0 {
+		infos, err := s.ListTemplates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.Name == name && info.Version > version {
+				version = info.Version
+			}
+		}
+		if version == 0 {
+			return nil, fmt.Errorf("prompt template %q not found", name)
+		}
+	}
+
+	// Database
+	if s.DB != nil {
+		var generate, fix string
+		query := `SELECT generate_template, fix_template FROM prompt_templates WHERE name = $1 AND version = $2`
+		err := s.DB.QueryRow(ctx, query, name, version).Scan(&generate, &fix)
+		if err == nil {
+			return parsePromptTemplate(name, version, "database", generate, fix)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get prompt template: %w", err)
+		}
+	}
+
+	// Files
+	dir := path.Join(name, strconv.Itoa(version))
+	for _, source := range s.promptSources() {
+		generate, genErr := fs.ReadFile(source.fs, path.Join(dir, generatePromptFile))
+		fix, fixErr := fs.ReadFile(source.fs, path.Join(dir, fixPromptFile))
+		if genErr == nil && fixErr == nil {
+			return parsePromptTemplate(name, version, source.name, string(generate), string(fix))
+		}
+	}
+
+	return nil, fmt.Errorf("prompt template %s@%d not found", name, version)
+}
+
+// ListTemplates returns every available template version
+func (s *PromptTemplateService) ListTemplates(ctx context.Context) ([]models.PromptTemplateInfo, error) {
+	seen := make(map[string]bool)
+	var infos []models.PromptTemplateInfo
+	add := func(info models.PromptTemplateInfo) {
+		key := fmt.Sprintf("%s@%d", info.Name, info.Version)
+		if !seen[key] {
+			seen[key] = true
+			infos = append(infos, info)
+		}
+	}
+
+	if s.DB != nil {
+		rows, err := s.DB.Query(ctx, `SELECT name, version FROM prompt_templates`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			info := models.PromptTemplateInfo{Source: "database"}
+			if err := rows.Scan(&info.Name, &info.Version); err != nil {
+				return nil, fmt.Errorf("failed to scan prompt template: %w", err)
+			}
+			add(info)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating prompt templates: %w", err)
+		}
+	}
+
+	for _, source := range s.promptSources() {
+		names, _ := fs.ReadDir(source.fs, ".")
+		for _, name := range names {
+			if !name.IsDir() {
+				continue
+			}
+			versions, _ := fs.ReadDir(source.fs, name.Name())
+			for _, v := range versions {
+				version, err := strconv.Atoi(v.Name())
+				if err != nil || version <= 0 || !v.IsDir() {
+					continue
+				}
+				add(models.PromptTemplateInfo{Name: name.Name(), Version: version, Source: source.name})
+			}
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Version < infos[j].Version
+	})
+	return infos, nil
+}
+
+type promptSource struct {
+	name string
+	fs   fs.FS
+}
+
+func (s *PromptTemplateService) promptSources() []promptSource {
+	var sources []promptSource
+	if s.Config != nil && s.Config.PromptTemplatesDir != "" {
+		sources = append(sources, promptSource{"files", os.DirFS(s.Config.PromptTemplatesDir)})
+	}
+	builtin, _ := fs.Sub(builtinPrompts, "prompts")
+	return append(sources, promptSource{"builtin", builtin})
+}
+
+// GetPromptSettings returns the prompt template and custom instructions of an app
+func (s *PromptTemplateService) GetPromptSettings(ctx context.Context, appID string) (*models.AppPromptSettings, error) {
+	settings := &models.AppPromptSettings{}
+	query := `SELECT prompt_template, COALESCE(custom_instructions, '') FROM apps WHERE id = $1`
+	err := s.DB.QueryRow(ctx, query, appID).Scan(&settings.PromptTemplate, &settings.CustomInstructions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt settings: %w", err)
+	}
+	return settings, nil
+}
+
+// UpdatePromptSettings stores an app's prompt template and custom instructions.
+// A nil template uses the default template.
+func (s *PromptTemplateService) UpdatePromptSettings(ctx context.Context, appID string, settings models.AppPromptSettings) error {
+	var instructions *string
+	if settings.CustomInstructions != "" {
+		instructions = &settings.CustomInstructions
+	}
+
+	query := `UPDATE apps SET prompt_template = $1, custom_instructions = $2, updated_at = NOW() WHERE id = $3`
+	rowsAffected, err := s.DB.Exec(ctx, query, settings.PromptTemplate, instructions, appID)
+	if err != nil {
+		return fmt.Errorf("failed to update prompt settings: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("app not found")
+	}
+
+	return nil
+}
+
+// TemplateRef returns the template an app's builds use: its own or the default
+func (s *PromptTemplateService) TemplateRef(settings *models.AppPromptSettings) string {
+	if settings != nil && settings.PromptTemplate != nil && *settings.PromptTemplate != "" {
+		return *settings.PromptTemplate
+	}
+	return s.Config.PromptTemplate
+}
+
+// parseTemplateRef parses "name" (version 0, meaning the latest) or "name@version"
+// references to prompt and starter templates
+func parseTemplateRef(kind, ref string) (string, int, error) {
+	name, versionStr, pinned := strings.Cut(strings.TrimSpace(ref), "@")
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return "", 0, fmt.Errorf("invalid %s %q", kind, ref)
+	}
+	if !pinned {
+		return name, 0, nil
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version <= 0 {
+		return "", 0, fmt.Errorf("invalid %s version in %q", kind, ref)
+	}
+	return name, version, nil
+}
+
+func parsePromptTemplate(name string, version int, source, generate, fix string) (*PromptTemplate, error) {
+	t := &PromptTemplate{Name: name, Version: version, Source: source}
+
+	var err error
+	t.generate, err = template.New(t.Ref() + "/" + generatePromptFile).Option("missingkey=error").Parse(generate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	t.fix, err = template.New(t.Ref() + "/" + fixPromptFile).Option("missingkey=error").Parse(fix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+
+	return t, nil
+}
@@ -9,8 +9,12 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
 )
 
+// runwareModel generates logos
+const runwareModel = "runware:100@1" // Fast model
+
 type RunwareService struct {
 	APIKey string
 }
@@ -24,11 +28,13 @@ type runwareRequest struct {
 	Height         int    `json:"height"`
 	Width          int    `json:"width"`
 	OutputFormat   string `json:"outputFormat"`
+	IncludeCost    bool   `json:"includeCost"`
 }
 
 type runwareResponse struct {
 	Data []struct {
-		ImageURL string `json:"imageURL"`
+		ImageURL string  `json:"imageURL"`
+		Cost     float64 `json:"cost"` // USD, with includeCost
 	} `json:"data"`
 }
 
@@ -38,8 +44,9 @@ func NewRunwareService(apiKey string) *RunwareService {
 	}
 }
 
-// GenerateLogo generates an app logo using Runware AI
-func (s *RunwareService) GenerateLogo(appName, category, colorScheme string) (string, error) {
+// GenerateLogo generates an app logo using Runware AI and returns its URL and
+// the usage of the request
+func (s *RunwareService) GenerateLogo(appName, category, colorScheme string) (string, *models.UsageEvent, error) {
 	// Create prompt for logo generation
 	prompt := fmt.Sprintf(`Modern, minimalist app icon logo for "%s".
 Style: Flat design, clean geometric shapes, %s color palette.
@@ -52,51 +59,64 @@ Suitable for app icon and branding.`, appName, colorScheme, category)
 		TaskType:       "imageInference",
 		TaskUUID:       uuid.New().String(),
 		PositivePrompt: prompt,
-		Model:          "runware:100@1", // Fast model
+		Model:          runwareModel,
 		NumberResults:  1,
 		Height:         512,
 		Width:          512,
 		OutputFormat:   "PNG",
+		IncludeCost:    true,
 	}
 
 	// Runware API expects an array of requests
 	jsonData, err := json.Marshal([]runwareRequest{reqBody})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Call Runware API
 	req, err := http.NewRequest("POST", "https://api.runware.ai/v1", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.APIKey))
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 60 * time.Second} // Logo generation can take time
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call Runware API: %w", err)
+		return "", nil, fmt.Errorf("failed to call Runware API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Runware API error (status %d): %s", resp.StatusCode, string(body))
+		return "", nil, fmt.Errorf("Runware API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// Parse response
 	var runwareResp runwareResponse
 	if err := json.NewDecoder(resp.Body).Decode(&runwareResp); err != nil {
-		return "", fmt.Errorf("failed to decode Runware response: %w", err)
+		return "", nil, fmt.Errorf("failed to decode Runware response: %w", err)
+	}
+
+	model := runwareModel
+	usage := &models.UsageEvent{
+		Provider:   "runware",
+		Operation:  UsageLogo,
+		Model:      &model,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	for _, image := range runwareResp.Data {
+		usage.CostUSD += image.Cost
 	}
 
 	if len(runwareResp.Data) == 0 {
-		return "", fmt.Errorf("no image generated by Runware")
+		return "", usage, fmt.Errorf("no image generated by Runware")
 	}
 
-	return runwareResp.Data[0].ImageURL, nil
+	return runwareResp.Data[0].ImageURL, usage, nil
 }
 
 // DownloadImage downloads the image from URL
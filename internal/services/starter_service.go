@@ -0,0 +1,595 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// Layout of a starter revision: {name}/{version}/starter.json describes it and
+// the code is in files/ next to it on disk, or in files.tar.gz in S3. The
+// built-in starter (STARTER_CODE_DIR) is the code itself, with an optional
+// starter.json at its root.
+const (
+	starterMetadataFile = "starter.json"
+	starterFilesDir     = "files"
+	starterArchiveFile  = "files.tar.gz"
+)
+
+// starterRegistryTTL is how long the list of starters is reused before the
+// sources are read again
+const starterRegistryTTL = time.Minute
+
+// starterExcludeDirs are never copied from a starter into a workspace
+var starterExcludeDirs = map[string]bool{
+	"node_modules":   true,
+	".git":           true,
+	".vercel":        true,
+	".rapidbuild":    true,
+	".agent-history": true,
+	"dist":           true,
+	".next":          true,
+}
+
+// starterMetadata is the content of starter.json
+type starterMetadata struct {
+	DisplayName    string   `json:"display_name"`
+	Description    string   `json:"description"`
+	Categories     []string `json:"categories"`
+	PromptTemplate string   `json:"prompt_template"`
+	Hash           string   `json:"hash"` // Optional; installing fails when the files do not match
+}
+
+// Starter is a starter revision and where its files are
+type Starter struct {
+	models.StarterTemplate
+	dir          string // Files of the files and builtin sources
+	s3Key        string // Archive of the s3 source
+	declaredHash string
+}
+
+// Ref is how apps select a starter revision, e.g. dashboard@2
+func (s *Starter) Ref() string {
+	return fmt.Sprintf("%s@%d", s.Name, s.Version)
+}
+
+// StarterService resolves starter templates from STARTER_TEMPLATES_DIR,
+// STARTER_TEMPLATES_S3_PREFIX and the built-in starter, in that order, and
+// installs them into workspaces
+type StarterService struct {
+	Config   *config.Config
+	S3Client *s3.Client
+
+	mu       sync.Mutex // guards the cached registry
+	cached   []*Starter
+	cachedAt time.Time
+}
+
+func NewStarterService(cfg *config.Config, s3Client *s3.Client) *StarterService {
+	return &StarterService{
+		Config:   cfg,
+		S3Client: s3Client,
+	}
+}
+
+// ListStarters returns every available starter revision
+func (s *StarterService) ListStarters(ctx context.Context) ([]models.StarterTemplate, error) {
+	starters, err := s.starters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.StarterTemplate, 0, len(starters))
+	for _, starter := range starters {
+		infos = append(infos, starter.StarterTemplate)
+	}
+	return infos, nil
+}
+
+// GetStarter resolves a starter reference: "name" for the latest version or "name@version"
+func (s *StarterService) GetStarter(ctx context.Context, ref string) (*Starter, error) {
+	name, version, err := parseTemplateRef("starter", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	starters, err := s.starters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Starter
+	for _, starter := range starters {
+		if starter.Name == name && (starter.Version == version || version == 0 && (found == nil || starter.Version > found.Version)) {
+			found = starter
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("starter %q not found", ref)
+	}
+	// Starters are shared through the registry cache
+	starter := *found
+	return &starter, nil
+}
+
+// InferStarter picks the starter for an app category: the first starter (by
+// name) whose latest version lists the category, or DEFAULT_STARTER
+func (s *StarterService) InferStarter(ctx context.Context, category string) string {
+	starters, err := s.starters(ctx)
+	if err != nil {
+		log.Printf("[Starter] Warning: Failed to list starters, using %s: %v\n", s.Config.DefaultStarter, err)
+		return s.Config.DefaultStarter
+	}
+
+	// Starters are sorted by name and version, so the last one per name is the latest
+	latest := make(map[string]*Starter)
+	var names []string
+	for _, starter := range starters {
+		if latest[starter.Name] == nil {
+			names = append(names, starter.Name)
+		}
+		latest[starter.Name] = starter
+	}
+
+	for _, name := range names {
+		for _, c := range latest[name].Categories {
+			if strings.EqualFold(c, category) {
+				return name
+			}
+		}
+	}
+	return s.Config.DefaultStarter
+}
+
+// Install copies a starter's files into dir and returns the installed
+// revision with the hash of the starter's files. The files are unpacked into
+// an empty directory first, so the hash covers the starter only and a hash
+// declared in starter.json that does not match fails the install before
+// anything is written to dir.
+func (s *StarterService) Install(ctx context.Context, starter *Starter, dir string) (*models.StarterRef, error) {
+	staging, err := os.MkdirTemp("", "starter-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to install starter %s: %w", starter.Ref(), err)
+	}
+	defer os.RemoveAll(staging)
+
+	if starter.s3Key != "" {
+		err = s.downloadStarter(ctx, starter.s3Key, staging)
+	} else {
+		err = copyStarterFiles(starter.dir, staging)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to install starter %s: %w", starter.Ref(), err)
+	}
+
+	hash, err := hashStarterFiles(staging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash starter %s: %w", starter.Ref(), err)
+	}
+	if starter.declaredHash != "" && hash != starter.declaredHash {
+		return nil, fmt.Errorf("starter %s does not match its declared hash %s (got %s)", starter.Ref(), starter.declaredHash, hash)
+	}
+
+	if err := copyStarterFiles(staging, dir); err != nil {
+		return nil, fmt.Errorf("failed to install starter %s: %w", starter.Ref(), err)
+	}
+
+	return &models.StarterRef{
+		Name:    starter.Name,
+		Version: starter.Version,
+		Hash:    hash,
+		Source:  starter.Source,
+	}, nil
+}
+
+// starters lists every starter revision sorted by name and version. The list
+// is read from the sources at most once per starterRegistryTTL.
+func (s *StarterService) starters(ctx context.Context) ([]*Starter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < starterRegistryTTL {
+		return s.cached, nil
+	}
+	starters, err := s.loadStarters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cached, s.cachedAt = starters, time.Now()
+	return starters, nil
+}
+
+// loadStarters reads every starter revision from the sources. When sources
+// provide the same revision, the first source wins.
+func (s *StarterService) loadStarters(ctx context.Context) ([]*Starter, error) {
+	seen := make(map[string]bool)
+	var starters []*Starter
+	add := func(starter *Starter) {
+		if !seen[starter.Ref()] {
+			seen[starter.Ref()] = true
+			starters = append(starters, starter)
+		}
+	}
+
+	// Files
+	if dir := s.Config.StarterTemplatesDir; dir != "" {
+		names, _ := os.ReadDir(dir)
+		for _, name := range names {
+			if !name.IsDir() {
+				continue
+			}
+			versions, _ := os.ReadDir(filepath.Join(dir, name.Name()))
+			for _, v := range versions {
+				version, err := strconv.Atoi(v.Name())
+				if err != nil || version <= 0 || !v.IsDir() {
+					continue
+				}
+				revisionDir := filepath.Join(dir, name.Name(), v.Name())
+				starter, err := localStarter(name.Name(), version, "files", filepath.Join(revisionDir, starterMetadataFile), filepath.Join(revisionDir, starterFilesDir))
+				if err != nil {
+					log.Printf("[Starter] Warning: Skipping starter %s@%d: %v\n", name.Name(), version, err)
+					continue
+				}
+				add(starter)
+			}
+		}
+	}
+
+	// S3
+	if prefix := s.Config.StarterTemplatesS3Prefix; prefix != "" && s.S3Client != nil {
+		s3Starters, err := s.s3Starters(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, starter := range s3Starters {
+			add(starter)
+		}
+	}
+
+	// Built-in
+	if info, err := os.Stat(s.Config.StarterCodeDir); err == nil && info.IsDir() {
+		dir := s.Config.StarterCodeDir
+		starter, err := localStarter(s.Config.DefaultStarter, 1, "builtin", filepath.Join(dir, starterMetadataFile), dir)
+		if err != nil {
+			log.Printf("[Starter] Warning: Skipping built-in starter in %s: %v\n", dir, err)
+		} else {
+			add(starter)
+		}
+	}
+
+	sort.Slice(starters, func(i, j int) bool {
+		if starters[i].Name != starters[j].Name {
+			return starters[i].Name < starters[j].Name
+		}
+		return starters[i].Version < starters[j].Version
+	})
+	if starters == nil {
+		starters = []*Starter{}
+	}
+	return starters, nil
+}
+
+// localStarter reads a starter revision on disk. The metadata file is
+// optional for the built-in starter. Like S3 starters, it lists the declared
+// hash; the files are hashed when the starter is installed.
+func localStarter(name string, version int, source, metadataPath, filesDir string) (*Starter, error) {
+	var metadata starterMetadata
+	data, err := os.ReadFile(metadataPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", starterMetadataFile, err)
+		}
+	case os.IsNotExist(err) && source == "builtin":
+	default:
+		return nil, err
+	}
+
+	info, err := os.Stat(filesDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", filesDir)
+	}
+
+	starter := newStarter(name, version, source, metadata)
+	starter.Hash = metadata.Hash
+	starter.dir = filesDir
+	return starter, nil
+}
+
+// s3Starters lists the starter revisions under prefix in the bucket
+func (s *StarterService) s3Starters(ctx context.Context, prefix string) ([]*Starter, error) {
+	var starters []*Starter
+	paginator := s3.NewListObjectsV2Paginator(s.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Config.S3Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list starters in S3: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			parts := strings.Split(strings.TrimPrefix(key, prefix), "/")
+			if len(parts) != 3 || parts[2] != starterMetadataFile {
+				continue
+			}
+			version, err := strconv.Atoi(parts[1])
+			if err != nil || version <= 0 || parts[0] == "" {
+				continue
+			}
+
+			metadata, err := s.readS3Metadata(ctx, key)
+			if err != nil {
+				log.Printf("[Starter] Warning: Skipping starter %s@%d in S3: %v\n", parts[0], version, err)
+				continue
+			}
+			starter := newStarter(parts[0], version, "s3", *metadata)
+			starter.Hash = metadata.Hash
+			starter.s3Key = path.Join(path.Dir(key), starterArchiveFile)
+			starters = append(starters, starter)
+		}
+	}
+	return starters, nil
+}
+
+func (s *StarterService) readS3Metadata(ctx context.Context, key string) (*starterMetadata, error) {
+	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	var metadata starterMetadata
+	if err := json.NewDecoder(result.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", starterMetadataFile, err)
+	}
+	return &metadata, nil
+}
+
+func newStarter(name string, version int, source string, metadata starterMetadata) *Starter {
+	starter := &Starter{
+		StarterTemplate: models.StarterTemplate{
+			Name:           name,
+			Version:        version,
+			DisplayName:    metadata.DisplayName,
+			Description:    metadata.Description,
+			Categories:     metadata.Categories,
+			PromptTemplate: metadata.PromptTemplate,
+			Source:         source,
+		},
+		declaredHash: metadata.Hash,
+	}
+	if starter.DisplayName == "" {
+		starter.DisplayName = name
+	}
+	if starter.Categories == nil {
+		starter.Categories = []string{}
+	}
+	return starter
+}
+
+// downloadStarter extracts a starter archive from S3 into dir
+func (s *StarterService) downloadStarter(ctx context.Context, key, dir string) error {
+	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	return extractStarterArchive(result.Body, dir)
+}
+
+// extractStarterArchive extracts a gzipped tar of starter files into dir.
+// Entries and symlinks that would land or point outside dir are rejected.
+func extractStarterArchive(r io.Reader, dir string) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name == "." || isStarterExcluded(name) {
+			continue
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if !utils.WithinDir(root, target) || target == root {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		// Earlier symlink entries may redirect the path
+		if err := utils.CheckResolved(root, target); err != nil {
+			return fmt.Errorf("invalid path in archive: %s: %w", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(link) || !utils.WithinDir(root, filepath.Join(filepath.Dir(target), link)) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			// Links through other links may resolve elsewhere than they read
+			if err := utils.CheckResolved(root, target); err != nil {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s: %w", header.Name, header.Linkname, err)
+			}
+		case tar.TypeReg:
+			if err := writeStarterFile(target, tr, os.FileMode(header.Mode)&0777); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyStarterFiles copies the files of a starter on disk into dir
+func copyStarterFiles(src, dir string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if isStarterExcluded(filepath.ToSlash(rel)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(dir, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return writeStarterFile(target, file, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func writeStarterFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// hashStarterFiles hashes the paths, sizes and contents of the starter files
+// in dir, in path order. Excluded directories and the metadata file are not
+// part of the hash, so a starter and a workspace it was installed into hash
+// the same.
+func hashStarterFiles(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isStarterExcluded(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s -> %s\n", rel, link)
+		case info.Mode().IsRegular():
+			fmt.Fprintf(h, "%s %d\n", rel, info.Size())
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(h, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isStarterExcluded reports whether a slash-separated path relative to the
+// starter root is left out of installs and hashes
+func isStarterExcluded(rel string) bool {
+	if rel == starterMetadataFile {
+		return true
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if starterExcludeDirs[part] {
+			return true
+		}
+	}
+	return false
+}
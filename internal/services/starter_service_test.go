@@ -0,0 +1,345 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/config"
+)
+
+func writeStarterFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashStarterFiles(t *testing.T) {
+	base := map[string]string{
+		"package.json": `{"name":"starter"}`,
+		"src/App.tsx":  "export default function App() {}",
+	}
+	hash := func(t *testing.T, files map[string]string, link string) string {
+		t.Helper()
+		dir := t.TempDir()
+		writeStarterFiles(t, dir, files)
+		if link != "" {
+			if err := os.Symlink(link, filepath.Join(dir, "link")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h, err := hashStarterFiles(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	with := func(name, content string) map[string]string {
+		files := map[string]string{}
+		for k, v := range base {
+			files[k] = v
+		}
+		files[name] = content
+		return files
+	}
+
+	baseHash := hash(t, base, "")
+	if !strings.HasPrefix(baseHash, "sha256:") {
+		t.Fatalf("hash = %q, want a sha256: prefix", baseHash)
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		link  string
+		same  bool
+	}{
+		{"same files", base, "", true},
+		{"metadata ignored", with(starterMetadataFile, `{"hash":"sha256:x"}`), "", true},
+		{"node_modules ignored", with("node_modules/react/index.js", "x"), "", true},
+		{"nested build output ignored", with("packages/web/dist/index.js", "x"), "", true},
+		{"content changed", with("src/App.tsx", "export default function App() { return null }"), "", false},
+		{"file added", with("src/util.ts", ""), "", false},
+		{"nested metadata hashed", with("src/starter.json", "{}"), "", false},
+		{"symlink", base, "src/App.tsx", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hash(t, tt.files, tt.link); (got == baseHash) != tt.same {
+				t.Errorf("hash equal to base = %v, want %v", got == baseHash, tt.same)
+			}
+		})
+	}
+
+	t.Run("renamed file", func(t *testing.T) {
+		renamed := map[string]string{"package.json": base["package.json"], "src/Main.tsx": base["src/App.tsx"]}
+		if hash(t, renamed, "") == baseHash {
+			t.Error("renaming a file kept the hash")
+		}
+	})
+}
+
+// newTestStarterService serves the "react" starter at versions 1 and 2 and
+// "dashboard" at version 1 from a templates dir, plus a built-in "react" starter
+func newTestStarterService(t *testing.T) *StarterService {
+	t.Helper()
+	templates := t.TempDir()
+	revision := func(name, version string, metadata starterMetadata, files map[string]string) {
+		dir := filepath.Join(templates, name, version)
+		writeStarterFiles(t, filepath.Join(dir, starterFilesDir), files)
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeStarterFiles(t, dir, map[string]string{starterMetadataFile: string(data)})
+	}
+	revision("react", "1", starterMetadata{DisplayName: "React v1"}, map[string]string{"package.json": `{"version":"1"}`})
+	revision("react", "2", starterMetadata{DisplayName: "React v2"}, map[string]string{"package.json": `{"version":"2"}`})
+	revision("dashboard", "1", starterMetadata{Categories: []string{"Analytics"}}, map[string]string{"package.json": `{"name":"dashboard"}`})
+	// Not revisions
+	writeStarterFiles(t, templates, map[string]string{"react/latest/files/x": "x", "react/0/files/x": "x", "README.md": "starters"})
+
+	builtin := t.TempDir()
+	writeStarterFiles(t, builtin, map[string]string{"package.json": `{"version":"builtin"}`})
+
+	return NewStarterService(&config.Config{
+		StarterCodeDir:      builtin,
+		DefaultStarter:      "react",
+		StarterTemplatesDir: templates,
+	}, nil)
+}
+
+func TestGetStarter(t *testing.T) {
+	s := newTestStarterService(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		ref         string
+		wantRef     string
+		wantDisplay string
+		wantErr     bool
+	}{
+		{ref: "react", wantRef: "react@2", wantDisplay: "React v2"},
+		{ref: " react ", wantRef: "react@2", wantDisplay: "React v2"},
+		{ref: "react@1", wantRef: "react@1", wantDisplay: "React v1"}, // The templates dir wins over the built-in starter
+		{ref: "dashboard", wantRef: "dashboard@1", wantDisplay: "dashboard"},
+		{ref: "react@3", wantErr: true},
+		{ref: "react@0", wantErr: true},
+		{ref: "react@latest", wantErr: true},
+		{ref: "missing", wantErr: true},
+		{ref: "../react", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			starter, err := s.GetStarter(ctx, tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", starter.Ref())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if starter.Ref() != tt.wantRef || starter.DisplayName != tt.wantDisplay || starter.Source != "files" {
+				t.Errorf("got %s (%q, %s), want %s (%q, files)", starter.Ref(), starter.DisplayName, starter.Source, tt.wantRef, tt.wantDisplay)
+			}
+		})
+	}
+
+	t.Run("built-in only", func(t *testing.T) {
+		builtin := t.TempDir()
+		writeStarterFiles(t, builtin, map[string]string{"package.json": "{}"})
+		s := NewStarterService(&config.Config{StarterCodeDir: builtin, DefaultStarter: "react"}, nil)
+		starter, err := s.GetStarter(ctx, "react")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if starter.Ref() != "react@1" || starter.Source != "builtin" {
+			t.Errorf("got %s from %s, want react@1 from builtin", starter.Ref(), starter.Source)
+		}
+	})
+}
+
+func TestInferStarter(t *testing.T) {
+	s := newTestStarterService(t)
+	tests := map[string]string{
+		"analytics": "dashboard",
+		"Analytics": "dashboard",
+		"blog":      "react",
+		"":          "react",
+	}
+	for category, want := range tests {
+		if got := s.InferStarter(context.Background(), category); got != want {
+			t.Errorf("InferStarter(%q) = %q, want %q", category, got, want)
+		}
+	}
+}
+
+func TestInstallStarter(t *testing.T) {
+	s := newTestStarterService(t)
+	ctx := context.Background()
+	starter, err := s.GetStarter(ctx, "react@2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceHash, err := hashStarterFiles(starter.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files already in the workspace are kept and not part of the hash
+	dir := t.TempDir()
+	writeStarterFiles(t, dir, map[string]string{"requirements/spec.md": "# Spec"})
+	ref, err := s.Install(ctx, starter, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Name != "react" || ref.Version != 2 || ref.Source != "files" || ref.Hash != sourceHash {
+		t.Errorf("ref = %+v, want react@2 from files with hash %s", ref, sourceHash)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err != nil || string(data) != `{"version":"2"}` {
+		t.Errorf("package.json = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "requirements", "spec.md")); err != nil {
+		t.Errorf("existing file removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, starterMetadataFile)); !os.IsNotExist(err) {
+		t.Error("starter.json was installed")
+	}
+
+	t.Run("declared hash matches", func(t *testing.T) {
+		declared := *starter
+		declared.declaredHash = sourceHash
+		if _, err := s.Install(ctx, &declared, t.TempDir()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("declared hash mismatch", func(t *testing.T) {
+		tampered := *starter
+		tampered.declaredHash = "sha256:0000"
+		dir := t.TempDir()
+		if _, err := s.Install(ctx, &tampered, dir); err == nil || !strings.Contains(err.Error(), "declared hash") {
+			t.Errorf("err = %v, want a declared hash mismatch", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); !os.IsNotExist(err) {
+			t.Error("files of a mismatching starter were installed")
+		}
+	})
+}
+
+func TestStarterRegistryCache(t *testing.T) {
+	s := newTestStarterService(t)
+	ctx := context.Background()
+	if _, err := s.GetStarter(ctx, "react@2"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeStarterFiles(t, filepath.Join(s.Config.StarterTemplatesDir, "react", "3", starterFilesDir), map[string]string{"package.json": "{}"})
+	writeStarterFiles(t, filepath.Join(s.Config.StarterTemplatesDir, "react", "3"), map[string]string{starterMetadataFile: "{}"})
+	if starter, err := s.GetStarter(ctx, "react"); err != nil || starter.Version != 2 {
+		t.Fatalf("got %v, %v; want the cached react@2", starter, err)
+	}
+
+	// Changes to a returned starter do not leak into the registry
+	starter, _ := s.GetStarter(ctx, "react@2")
+	starter.DisplayName = "changed"
+	if again, _ := s.GetStarter(ctx, "react@2"); again.DisplayName != "React v2" {
+		t.Errorf("display name = %q, want React v2", again.DisplayName)
+	}
+
+	s.cachedAt = time.Now().Add(-starterRegistryTTL)
+	if starter, err := s.GetStarter(ctx, "react"); err != nil || starter.Version != 3 {
+		t.Errorf("got %v, %v; want react@3 after the cache expired", starter, err)
+	}
+}
+
+// starterEntry is one entry of a test archive; Link makes it a symlink
+type starterEntry struct{ Name, Link, Body string }
+
+// starterArchive builds a gzipped tar of entries
+func starterArchive(t *testing.T, entries []starterEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.Name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.Body))}
+		if e.Link != "" {
+			header = &tar.Header{Name: e.Name, Linkname: e.Link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractStarterArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []starterEntry
+		valid   bool
+	}{
+		{"files and relative link", []starterEntry{
+			{Name: "./src/main.tsx", Body: "x"},
+			{Name: "./src/entry.tsx", Link: "main.tsx"},
+		}, true},
+		{"path traversal", []starterEntry{{Name: "../evil.js", Body: "x"}}, false},
+		{"absolute link", []starterEntry{{Name: "out", Link: "/tmp"}}, false},
+		{"link escaping", []starterEntry{{Name: "out", Link: ".."}}, false},
+		{"write through escaping link", []starterEntry{
+			{Name: "src/up", Link: ".."},
+			{Name: "src/up/up", Link: ".."},
+			{Name: "src/up/up/evil.js", Body: "x"},
+		}, false},
+		{"link through link", []starterEntry{
+			{Name: "self", Link: "."},
+			{Name: "out", Link: "self/.."},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			dir := filepath.Join(outside, "starter")
+			err := extractStarterArchive(starterArchive(t, tt.entries), dir)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected the archive to be rejected")
+			}
+			if _, err := os.Stat(filepath.Join(outside, "evil.js")); err == nil {
+				t.Error("archive wrote outside the destination")
+			}
+		})
+	}
+}
@@ -89,6 +89,38 @@ func (s *UploadService) UploadRequirementFile(
 	return &reqFile, nil
 }
 
+// ListRequirementFiles returns the files uploaded for a version, oldest first
+func (s *UploadService) ListRequirementFiles(ctx context.Context, versionID string) ([]models.RequirementFile, error) {
+	query := `
+		SELECT id, app_id, version_id, file_name, file_type, s3_path, created_at
+		FROM requirement_files
+		WHERE version_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := s.DB.Query(ctx, query, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list requirement files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []models.RequirementFile
+	for rows.Next() {
+		var file models.RequirementFile
+		err := rows.Scan(&file.ID, &file.AppID, &file.VersionID, &file.FileName, &file.FileType, &file.S3Path, &file.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan requirement file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating requirement files: %w", err)
+	}
+
+	return files, nil
+}
+
 // DownloadFile downloads a file from S3
 func (s *UploadService) DownloadFile(ctx context.Context, s3Path string) (io.ReadCloser, error) {
 	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
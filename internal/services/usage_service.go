@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// Usage operations
+const (
+	UsageGenerate  = "generate"   // Code generation run of a build
+	UsageFix       = "fix"        // Fix run of a build attempt
+	UsagePlan      = "plan"       // Planning pass of a plan-first build
+	UsageAppConfig = "app_config" // App config extraction when an app is created
+	UsageLogo      = "logo"       // Logo generation
+)
+
+// UsageService records what calls to AI providers consume (usage_events) and
+// sums it per version, app and user
+type UsageService struct {
+	DB *db.PostgresClient
+}
+
+func NewUsageService(dbClient *db.PostgresClient) *UsageService {
+	return &UsageService{
+		DB: dbClient,
+	}
+}
+
+// RecordUsage stores a usage event of an app. The user is the app's owner.
+func (s *UsageService) RecordUsage(ctx context.Context, event models.UsageEvent) error {
+	query := `
+		INSERT INTO usage_events (user_id, app_id, version_id, provider, operation, model, attempt, input_tokens, output_tokens, cost_usd, turns, duration_ms)
+		SELECT a.user_id, a.id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		FROM apps a
+		WHERE a.id = $1
+	`
+
+	rowsAffected, err := s.DB.Exec(ctx, query,
+		event.AppID, event.VersionID, event.Provider, event.Operation, event.Model, event.Attempt,
+		event.InputTokens, event.OutputTokens, event.CostUSD, event.Turns, event.DurationMs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("app not found")
+	}
+
+	return nil
+}
+
+// usageColumns sums usage events into the fields of models.UsageTotals
+const usageColumns = `COUNT(*), COALESCE(SUM(u.input_tokens), 0)::bigint, COALESCE(SUM(u.output_tokens), 0)::bigint, COALESCE(SUM(u.cost_usd), 0), COALESCE(SUM(u.turns), 0)`
+
+// GetAppUsage returns the usage of an app, per operation and per version
+func (s *UsageService) GetAppUsage(ctx context.Context, appID string) (*models.AppUsage, error) {
+	usage := &models.AppUsage{
+		AppID:       appID,
+		ByOperation: []models.OperationUsage{},
+		ByVersion:   []models.VersionUsage{},
+	}
+
+	err := s.DB.QueryRow(ctx, `SELECT `+usageColumns+` FROM usage_events u WHERE u.app_id = $1`, appID).Scan(totalsFields(&usage.Total)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app usage: %w", err)
+	}
+
+	usage.ByOperation, err = s.operationUsage(ctx, `u.app_id = $1`, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT v.id, v.version_number, ` + usageColumns + `
+		FROM usage_events u
+		JOIN versions v ON v.id = u.version_id
+		WHERE u.app_id = $1
+		GROUP BY v.id, v.version_number
+		ORDER BY v.version_number ASC
+	`
+	rows, err := s.DB.Query(ctx, query, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.VersionUsage
+		if err := rows.Scan(append([]interface{}{&v.VersionID, &v.VersionNumber}, totalsFields(&v.UsageTotals)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan version usage: %w", err)
+		}
+		usage.ByVersion = append(usage.ByVersion, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating version usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetUserUsage returns the usage of all apps of a user, per operation and per
+// app. Usage of deleted apps counts towards the total with an empty app ID.
+func (s *UsageService) GetUserUsage(ctx context.Context, userID string) (*models.UserUsage, error) {
+	usage := &models.UserUsage{
+		UserID:      userID,
+		ByOperation: []models.OperationUsage{},
+		ByApp:       []models.AppUsageTotals{},
+	}
+
+	err := s.DB.QueryRow(ctx, `SELECT `+usageColumns+` FROM usage_events u WHERE u.user_id = $1`, userID).Scan(totalsFields(&usage.Total)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user usage: %w", err)
+	}
+
+	usage.ByOperation, err = s.operationUsage(ctx, `u.user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT COALESCE(u.app_id::text, ''), COALESCE(a.name, ''), ` + usageColumns + `
+		FROM usage_events u
+		LEFT JOIN apps a ON a.id = u.app_id
+		WHERE u.user_id = $1
+		GROUP BY u.app_id, a.name
+		ORDER BY SUM(u.cost_usd) DESC
+	`
+	rows, err := s.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.AppUsageTotals
+		if err := rows.Scan(append([]interface{}{&a.AppID, &a.Name}, totalsFields(&a.UsageTotals)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan app usage: %w", err)
+		}
+		usage.ByApp = append(usage.ByApp, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating app usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// operationUsage sums the usage events matching where per provider and operation
+func (s *UsageService) operationUsage(ctx context.Context, where string, arg string) ([]models.OperationUsage, error) {
+	query := `
+		SELECT u.provider, u.operation, ` + usageColumns + `
+		FROM usage_events u
+		WHERE ` + where + `
+		GROUP BY u.provider, u.operation
+		ORDER BY u.provider, u.operation
+	`
+	rows, err := s.DB.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation usage: %w", err)
+	}
+	defer rows.Close()
+
+	operations := []models.OperationUsage{}
+	for rows.Next() {
+		var o models.OperationUsage
+		if err := rows.Scan(append([]interface{}{&o.Provider, &o.Operation}, totalsFields(&o.UsageTotals)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan operation usage: %w", err)
+		}
+		operations = append(operations, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating operation usage: %w", err)
+	}
+
+	return operations, nil
+}
+
+func totalsFields(t *models.UsageTotals) []interface{} {
+	return []interface{}{&t.Events, &t.InputTokens, &t.OutputTokens, &t.CostUSD, &t.Turns}
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// VercelDeployer deploys through the Vercel CLI (link, build, deploy) and the
+// Vercel REST API (promote, domains, status)
+type VercelDeployer struct {
+	VercelService *VercelService
+	Executor      executor.Executor
+}
+
+func NewVercelDeployer(vercelService *VercelService, exec executor.Executor) *VercelDeployer {
+	return &VercelDeployer{
+		VercelService: vercelService,
+		Executor:      exec,
+	}
+}
+
+func (d *VercelDeployer) Name() string {
+	return "vercel"
+}
+
+// env is the stage environment of the Vercel CLI commands that talk to the API
+// (link, pull, deploy); only they get the token and the CLI's auth directory
+func (d *VercelDeployer) env() []string {
+	if d.VercelService == nil || d.VercelService.Config.Token == "" {
+		return nil
+	}
+	return []string{"VERCEL_TOKEN=" + d.VercelService.Config.Token}
+}
+
+// ProjectID reads the project ID from .vercel/project.json
+func (d *VercelDeployer) ProjectID(workspaceDir string) (string, error) {
+	projectFile := filepath.Join(workspaceDir, ".vercel", "project.json")
+	data, err := os.ReadFile(projectFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read project.json: %w", err)
+	}
+
+	var projectData struct {
+		ProjectID string `json:"projectId"`
+	}
+	if err := json.Unmarshal(data, &projectData); err != nil {
+		return "", fmt.Errorf("failed to parse project.json: %w", err)
+	}
+
+	return projectData.ProjectID, nil
+}
+
+// Link links the workspace to a Vercel project (named after the workspace folder) and returns the project ID
+func (d *VercelDeployer) Link(ctx context.Context, workspaceDir, appID string, output io.Writer) (string, error) {
+	log.Printf("[Vercel] Linking project for app %s\n", appID)
+
+	var stdout, stderr bytes.Buffer
+	err := d.Executor.Run(ctx, executor.Command{
+		Name:   "vercel",
+		Args:   []string{"link", "-y"},
+		Dir:    workspaceDir,
+		Env:    d.env(),
+		Access: executor.AccessDeploy,
+		Stdout: commandOutput(&stdout, output),
+		Stderr: commandOutput(&stderr, output),
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errorMsg := stderr.String()
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		return "", &utils.CommandError{Message: fmt.Sprintf("Vercel link failed: %s", strings.TrimSpace(errorMsg)), Err: err}
+	}
+
+	log.Printf("[Vercel] Link output: %s\n", stdout.String())
+
+	// Read the project ID from .vercel/project.json
+	projectID, err := d.ProjectID(workspaceDir)
+	if err != nil {
+		log.Printf("[Vercel] Warning: Could not read project ID: %v\n", err)
+		return "", nil
+	}
+
+	log.Printf("[Vercel] Project ID: %s\n", projectID)
+	return projectID, nil
+}
+
+// Build pulls the project settings with the token, then runs vercel build
+// without it to create the prebuilt output. The build runs the app's own build
+// scripts, so it never gets VERCEL_TOKEN.
+func (d *VercelDeployer) Build(ctx context.Context, workspaceDir string, output io.Writer) error {
+	log.Printf("[Vercel Build] Building project in %s\n", workspaceDir)
+
+	var pullOut, pullErr bytes.Buffer
+	err := d.Executor.Run(ctx, executor.Command{
+		Name:   "vercel",
+		Args:   []string{"pull", "--environment=preview", "-y"},
+		Dir:    workspaceDir,
+		Env:    d.env(),
+		Access: executor.AccessDeploy,
+		Stdout: commandOutput(&pullOut, output),
+		Stderr: commandOutput(&pullErr, output),
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errorMsg := pullErr.String()
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		return &utils.CommandError{Message: fmt.Sprintf("Vercel pull failed: %s", strings.TrimSpace(errorMsg)), Err: err}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = d.Executor.Run(ctx, executor.Command{
+		Name:   "vercel",
+		Args:   []string{"build", "--target=preview", "-y"},
+		Dir:    workspaceDir,
+		Stdout: commandOutput(&stdout, output),
+		Stderr: commandOutput(&stderr, output),
+	})
+
+	// Combine output for logging
+	combinedOutput := stdout.String()
+	if stderr.Len() > 0 {
+		combinedOutput += "\n--- BUILD ERRORS ---\n" + stderr.String()
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Return detailed error with full output
+		errorMsg := strings.TrimSpace(combinedOutput)
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		return &utils.CommandError{Message: errorMsg, Err: err}
+	}
+
+	log.Printf("[Vercel Build] Build successful in %s\n", workspaceDir)
+	return nil
+}
+
+// Deploy deploys the pre-built workspace to Vercel as a preview deployment
+// and makes it publicly accessible
+func (d *VercelDeployer) Deploy(ctx context.Context, workspaceDir, appID, versionID string, output io.Writer) (*Deployment, error) {
+	// Deploy to Vercel with --prebuilt flag (workspace was built by Build)
+	log.Printf("[Vercel] Deploying version %s\n", versionID)
+	var stdout, stderr bytes.Buffer
+	err := d.Executor.Run(ctx, executor.Command{
+		Name:   "vercel",
+		Args:   []string{"--yes", "--prebuilt", "--target=preview"},
+		Dir:    workspaceDir,
+		Env:    d.env(),
+		Access: executor.AccessDeploy,
+		Stdout: commandOutput(&stdout, output),
+		Stderr: commandOutput(&stderr, output),
+	})
+
+	if err != nil {
+		// The build was cancelled or its stage timed out
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// Extract error message
+		errorMsg := stderr.String()
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		return nil, &utils.CommandError{Message: fmt.Sprintf("Vercel deployment failed: %s", strings.TrimSpace(errorMsg)), Err: err}
+	}
+
+	deploymentURL, deploymentID := parseVercelDeployOutput(stdout.String())
+
+	// Without a URL the version cannot be opened; a guessed one would mark a
+	// deployment completed that may not exist
+	if deploymentURL == "" {
+		return nil, fmt.Errorf("Vercel deployment finished but no deployment URL was found in the CLI output: %s", strings.TrimSpace(stdout.String()))
+	}
+
+	// Fallback for deployment ID: use versionID if parsing failed
+	if deploymentID == "" {
+		log.Printf("[Vercel] Warning: Could not parse deployment ID from output, using versionID as fallback\n")
+		deploymentID = versionID
+	} else {
+		log.Printf("[Vercel] Parsed deployment ID from CLI output: %s\n", deploymentID)
+	}
+
+	log.Printf("[Vercel] Deployment successful: %s\n", deploymentURL)
+
+	// Disable Vercel deployment protection to make it publicly accessible
+	projectID, err := d.ProjectID(workspaceDir)
+	if err != nil {
+		log.Printf("[Vercel] Warning: Could not read project ID to disable protection: %v\n", err)
+	} else {
+		log.Printf("[Vercel] Disabling deployment protection for project %s\n", projectID)
+		if err := d.VercelService.DisableDeploymentProtection(projectID); err != nil {
+			// Log but don't fail the build - this is not critical
+			log.Printf("[Vercel] Warning: Failed to disable deployment protection: %v\n", err)
+		} else {
+			log.Printf("[Vercel] ✅ Deployment protection disabled\n")
+		}
+	}
+
+	return &Deployment{ID: deploymentID, URL: deploymentURL, State: "READY"}, nil
+}
+
+// parseVercelDeployOutput returns the deployment URL and ID from the output of
+// vercel deploy, or empty strings for those it cannot find. The CLI prints:
+//
+//	Inspect: https://vercel.com/.../PROJECT_ID/DEPLOYMENT_ID [time]
+//	Preview: https://PROJECT-HASH.vercel.app [time]
+func parseVercelDeployOutput(output string) (deploymentURL, deploymentID string) {
+	outputLines := strings.Split(output, "\n")
+
+	for _, line := range outputLines {
+		// Parse Inspect URL to get deployment ID
+		if strings.Contains(line, "Inspect:") {
+			parts := strings.Fields(line)
+			for i, part := range parts {
+				if part == "Inspect:" && i+1 < len(parts) {
+					inspectURL := parts[i+1]
+					// Deployment ID is the last segment of the Inspect URL
+					urlParts := strings.Split(inspectURL, "/")
+					if len(urlParts) > 0 {
+						deploymentID = urlParts[len(urlParts)-1]
+					}
+					break
+				}
+			}
+		}
+
+		// Parse Preview URL
+		if strings.Contains(line, "Preview:") {
+			parts := strings.Fields(line)
+			for i, part := range parts {
+				if part == "Preview:" && i+1 < len(parts) {
+					deploymentURL = strings.TrimSpace(parts[i+1])
+					break
+				}
+			}
+		}
+	}
+
+	// Fallback: try to parse deployment URL from bare URL lines if Preview not found
+	if deploymentURL == "" {
+		for _, line := range outputLines {
+			if strings.Contains(line, "https://") && strings.Contains(line, "vercel.app") {
+				// Extract URL from the line, handling cases like "...vercel.appQueued"
+				parts := strings.Fields(line)
+				for _, part := range parts {
+					if strings.HasPrefix(part, "https://") && strings.Contains(part, "vercel.app") {
+						// Split at ".app" to handle appended status
+						if idx := strings.Index(part, ".app"); idx != -1 {
+							deploymentURL = strings.TrimSpace(part[:idx+4])
+							break
+						}
+					}
+				}
+				if deploymentURL != "" {
+					break
+				}
+			}
+		}
+	}
+
+	return deploymentURL, deploymentID
+}
+
+// Promote points the production domain at a deployment
+func (d *VercelDeployer) Promote(ctx context.Context, projectID, deploymentID, domain string) error {
+	return d.VercelService.PromoteDeployment(projectID, deploymentID, domain)
+}
+
+// AddDomain adds a custom domain to the project
+func (d *VercelDeployer) AddDomain(ctx context.Context, projectID, domain string) error {
+	return d.VercelService.AddDomainToProject(projectID, domain)
+}
+
+// Status gets the state of a deployment from the Vercel API
+func (d *VercelDeployer) Status(ctx context.Context, deploymentID string) (*Deployment, error) {
+	deployment, err := d.VercelService.GetDeploymentStatus(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	return &Deployment{ID: deployment.ID, URL: deployment.URL, State: deployment.State}, nil
+}
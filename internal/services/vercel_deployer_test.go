@@ -0,0 +1,38 @@
+package services
+
+import "testing"
+
+func TestParseVercelDeployOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		url    string
+		id     string
+	}{
+		{
+			name:   "inspect and preview",
+			output: "Vercel CLI 44.2.0\nInspect: https://vercel.com/team/app/dpl_abc123 [2s]\nPreview: https://app-hash-team.vercel.app [2s]\n",
+			url:    "https://app-hash-team.vercel.app",
+			id:     "dpl_abc123",
+		},
+		{
+			name:   "bare URL with appended status",
+			output: "Inspect: https://vercel.com/team/app/dpl_abc123 [1s]\nhttps://app-hash-team.vercel.appQueued\n",
+			url:    "https://app-hash-team.vercel.app",
+			id:     "dpl_abc123",
+		},
+		{
+			name:   "no URL",
+			output: "Vercel CLI 44.2.0\nDeploying team/app\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, id := parseVercelDeployOutput(tt.output)
+			if url != tt.url || id != tt.id {
+				t.Errorf("parseVercelDeployOutput = %q, %q; want %q, %q", url, id, tt.url, tt.id)
+			}
+		})
+	}
+}
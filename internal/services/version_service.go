@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
@@ -13,19 +14,30 @@ import (
 )
 
 type VersionService struct {
-	DB            *db.PostgresClient
-	VercelService *VercelService
+	DB       *db.PostgresClient
+	Deployer Deployer
 }
 
-func NewVersionService(dbClient *db.PostgresClient, vercelService *VercelService) *VersionService {
+func NewVersionService(dbClient *db.PostgresClient, deployer Deployer) *VersionService {
 	return &VersionService{
-		DB:            dbClient,
-		VercelService: vercelService,
+		DB:       dbClient,
+		Deployer: deployer,
 	}
 }
 
-// CreateVersion creates a new version for an app
-func (s *VersionService) CreateVersion(ctx context.Context, appID string, requirements *string) (*models.Version, error) {
+// CreateVersion creates a new version for an app. baseVersionID branches it
+// from that version's code; nil builds on the latest completed version.
+func (s *VersionService) CreateVersion(ctx context.Context, appID string, requirements, baseVersionID *string) (*models.Version, error) {
+	return s.createVersion(ctx, appID, requirements, baseVersionID, nil)
+}
+
+// CreateRetryVersion creates a new version of the app that rebuilds a failed
+// or cancelled version with its requirements, linked to it by retry_of_version_id
+func (s *VersionService) CreateRetryVersion(ctx context.Context, original *models.Version, baseVersionID *string) (*models.Version, error) {
+	return s.createVersion(ctx, original.AppID, original.Requirements, baseVersionID, &original.ID)
+}
+
+func (s *VersionService) createVersion(ctx context.Context, appID string, requirements, baseVersionID, retryOf *string) (*models.Version, error) {
 	// Get the latest version number
 	var maxVersion int
 	query := `SELECT COALESCE(MAX(version_number), 0) FROM versions WHERE app_id = $1`
@@ -35,26 +47,29 @@ func (s *VersionService) CreateVersion(ctx context.Context, appID string, requir
 	}
 
 	version := models.Version{
-		ID:            uuid.New().String(),
-		AppID:         appID,
-		VersionNumber: maxVersion + 1,
-		Status:        "pending",
-		Requirements:  requirements,
-		CreatedAt:     time.Now(),
+		ID:               uuid.New().String(),
+		AppID:            appID,
+		VersionNumber:    maxVersion + 1,
+		Status:           "pending",
+		Requirements:     requirements,
+		BaseVersionID:    baseVersionID,
+		RetryOfVersionID: retryOf,
+		CreatedAt:        time.Now(),
 	}
 
 	insertQuery := `
-		INSERT INTO versions (id, app_id, version_number, status, requirements, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at
+		INSERT INTO versions (id, app_id, version_number, status, requirements, base_version_id, retry_of_version_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at, verification_results, failure, base_version_id, retry_of_version_id, prompt_template, agent_session, security_findings, change_plan, starter
 	`
 
 	err = s.DB.QueryRow(ctx, insertQuery,
-		version.ID, version.AppID, version.VersionNumber, version.Status, version.Requirements, version.CreatedAt,
+		version.ID, version.AppID, version.VersionNumber, version.Status, version.Requirements, version.BaseVersionID, version.RetryOfVersionID, version.CreatedAt,
 	).Scan(
 		&version.ID, &version.AppID, &version.VersionNumber, &version.Status, &version.Requirements,
 		&version.S3CodePath, &version.VercelURL, &version.VercelDeployID,
-		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt,
+		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt, &version.VerificationResults, &version.Failure,
+		&version.BaseVersionID, &version.RetryOfVersionID, &version.PromptTemplate, &version.AgentSession, &version.SecurityFindings, &version.ChangePlan, &version.Starter,
 	)
 
 	if err != nil {
@@ -68,7 +83,7 @@ func (s *VersionService) CreateVersion(ctx context.Context, appID string, requir
 func (s *VersionService) GetVersion(ctx context.Context, versionID string) (*models.Version, error) {
 	version := &models.Version{}
 	query := `
-		SELECT id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at
+		SELECT id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at, verification_results, failure, base_version_id, retry_of_version_id, prompt_template, agent_session, security_findings, change_plan, starter
 		FROM versions
 		WHERE id = $1
 	`
@@ -76,7 +91,8 @@ func (s *VersionService) GetVersion(ctx context.Context, versionID string) (*mod
 	err := s.DB.QueryRow(ctx, query, versionID).Scan(
 		&version.ID, &version.AppID, &version.VersionNumber, &version.Status, &version.Requirements,
 		&version.S3CodePath, &version.VercelURL, &version.VercelDeployID,
-		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt,
+		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt, &version.VerificationResults, &version.Failure,
+		&version.BaseVersionID, &version.RetryOfVersionID, &version.PromptTemplate, &version.AgentSession, &version.SecurityFindings, &version.ChangePlan, &version.Starter,
 	)
 
 	if err != nil {
@@ -86,10 +102,11 @@ func (s *VersionService) GetVersion(ctx context.Context, versionID string) (*mod
 	return version, nil
 }
 
-// ListVersions retrieves all versions for an app
+// ListVersions retrieves all versions for an app. Build logs are not included;
+// read them with BuildLogService.
 func (s *VersionService) ListVersions(ctx context.Context, appID string) ([]models.Version, error) {
 	query := `
-		SELECT id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at
+		SELECT id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, error_message, created_at, verification_results, failure, base_version_id, retry_of_version_id, prompt_template, agent_session, security_findings, change_plan, starter
 		FROM versions
 		WHERE app_id = $1
 		ORDER BY version_number DESC
@@ -107,7 +124,8 @@ func (s *VersionService) ListVersions(ctx context.Context, appID string) ([]mode
 		err := rows.Scan(
 			&version.ID, &version.AppID, &version.VersionNumber, &version.Status, &version.Requirements,
 			&version.S3CodePath, &version.VercelURL, &version.VercelDeployID,
-			&version.BuildLog, &version.ErrorMessage, &version.CreatedAt,
+			&version.ErrorMessage, &version.CreatedAt, &version.VerificationResults, &version.Failure,
+			&version.BaseVersionID, &version.RetryOfVersionID, &version.PromptTemplate, &version.AgentSession, &version.SecurityFindings, &version.ChangePlan, &version.Starter,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan version: %w", err)
@@ -122,6 +140,35 @@ func (s *VersionService) ListVersions(ctx context.Context, appID string) ([]mode
 	return versions, nil
 }
 
+// GetVersionTree returns the versions of an app as a tree: each version is a
+// child of the version it was built from. Versions built from starter code
+// (or whose base was deleted) are roots.
+func (s *VersionService) GetVersionTree(ctx context.Context, appID string) ([]*models.VersionNode, error) {
+	versions, err := s.ListVersions(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*models.VersionNode, len(versions))
+	for _, version := range versions {
+		nodes[version.ID] = &models.VersionNode{Version: version, Children: []*models.VersionNode{}}
+	}
+
+	// ListVersions is newest first; walk oldest first so children are in build order
+	roots := []*models.VersionNode{}
+	for i := len(versions) - 1; i >= 0; i-- {
+		node := nodes[versions[i].ID]
+		if base := node.BaseVersionID; base != nil && nodes[*base] != nil && *base != node.ID {
+			parent := nodes[*base]
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots, nil
+}
+
 // UpdateVersion updates a version
 func (s *VersionService) UpdateVersion(ctx context.Context, versionID string, updates map[string]interface{}) (*models.Version, error) {
 	// Build dynamic UPDATE query
@@ -137,6 +184,24 @@ func (s *VersionService) UpdateVersion(ctx context.Context, versionID string, up
 		argCount++
 	}
 
+	if baseVersionID, ok := updates["base_version_id"].(*string); ok {
+		setClauses = append(setClauses, fmt.Sprintf("base_version_id = $%d", argCount))
+		args = append(args, baseVersionID)
+		argCount++
+	}
+
+	if promptTemplate, ok := updates["prompt_template"].(string); ok {
+		setClauses = append(setClauses, fmt.Sprintf("prompt_template = $%d", argCount))
+		args = append(args, promptTemplate)
+		argCount++
+	}
+
+	if agentSession, ok := updates["agent_session"].(string); ok {
+		setClauses = append(setClauses, fmt.Sprintf("agent_session = $%d", argCount))
+		args = append(args, agentSession)
+		argCount++
+	}
+
 	if s3CodePath, ok := updates["s3_code_path"].(string); ok {
 		setClauses = append(setClauses, fmt.Sprintf("s3_code_path = $%d", argCount))
 		args = append(args, s3CodePath)
@@ -167,6 +232,56 @@ func (s *VersionService) UpdateVersion(ctx context.Context, versionID string, up
 		argCount++
 	}
 
+	if results, ok := updates["verification_results"].([]models.VerificationResult); ok {
+		data, err := json.Marshal(results)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode verification results: %w", err)
+		}
+		setClauses = append(setClauses, fmt.Sprintf("verification_results = $%d", argCount))
+		args = append(args, data)
+		argCount++
+	}
+
+	if findings, ok := updates["security_findings"].([]models.SecurityFinding); ok {
+		data, err := json.Marshal(findings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode security findings: %w", err)
+		}
+		setClauses = append(setClauses, fmt.Sprintf("security_findings = $%d", argCount))
+		args = append(args, data)
+		argCount++
+	}
+
+	if plan, ok := updates["change_plan"].(*models.ChangePlan); ok {
+		data, err := json.Marshal(plan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode change plan: %w", err)
+		}
+		setClauses = append(setClauses, fmt.Sprintf("change_plan = $%d", argCount))
+		args = append(args, data)
+		argCount++
+	}
+
+	if starter, ok := updates["starter"].(*models.StarterRef); ok {
+		data, err := json.Marshal(starter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode starter: %w", err)
+		}
+		setClauses = append(setClauses, fmt.Sprintf("starter = $%d", argCount))
+		args = append(args, data)
+		argCount++
+	}
+
+	if failure, ok := updates["failure"].(*models.BuildFailure); ok {
+		data, err := json.Marshal(failure)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode build failure: %w", err)
+		}
+		setClauses = append(setClauses, fmt.Sprintf("failure = $%d", argCount))
+		args = append(args, data)
+		argCount++
+	}
+
 	// Legacy fields for backwards compatibility
 	if deployURL, ok := updates["deploy_url"].(string); ok {
 		setClauses = append(setClauses, fmt.Sprintf("vercel_url = $%d", argCount))
@@ -189,13 +304,14 @@ func (s *VersionService) UpdateVersion(ctx context.Context, versionID string, up
 	query += fmt.Sprintf(" WHERE id = $%d", argCount)
 	args = append(args, versionID)
 
-	query += " RETURNING id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at"
+	query += " RETURNING id, app_id, version_number, status, requirements, s3_code_path, vercel_url, vercel_deploy_id, build_log, error_message, created_at, verification_results, failure, base_version_id, retry_of_version_id, prompt_template, agent_session, security_findings, change_plan, starter"
 
 	version := &models.Version{}
 	err := s.DB.QueryRow(ctx, query, args...).Scan(
 		&version.ID, &version.AppID, &version.VersionNumber, &version.Status, &version.Requirements,
 		&version.S3CodePath, &version.VercelURL, &version.VercelDeployID,
-		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt,
+		&version.BuildLog, &version.ErrorMessage, &version.CreatedAt, &version.VerificationResults, &version.Failure,
+		&version.BaseVersionID, &version.RetryOfVersionID, &version.PromptTemplate, &version.AgentSession, &version.SecurityFindings, &version.ChangePlan, &version.Starter,
 	)
 
 	if err != nil {
@@ -220,6 +336,111 @@ func (s *VersionService) DeleteVersion(ctx context.Context, versionID string) er
 	return nil
 }
 
+// DecidePlan stores the user's decision on the change plan of a version that
+// is awaiting approval and moves it to status. It fails when the version is
+// not awaiting approval, so a plan is approved or rejected at most once.
+func (s *VersionService) DecidePlan(ctx context.Context, versionID string, plan *models.ChangePlan, status string) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode change plan: %w", err)
+	}
+
+	query := `UPDATE versions SET change_plan = $1, status = $2 WHERE id = $3 AND status = 'awaiting_approval'`
+	rowsAffected, err := s.DB.Exec(ctx, query, data, status, versionID)
+	if err != nil {
+		return fmt.Errorf("failed to update change plan: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("version is not awaiting approval")
+	}
+
+	return nil
+}
+
+// ReopenPlan moves a version whose approved plan could not be queued back to
+// awaiting_approval with the plan it had before, so it can be approved again
+func (s *VersionService) ReopenPlan(ctx context.Context, versionID string, plan *models.ChangePlan) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode change plan: %w", err)
+	}
+
+	query := `UPDATE versions SET change_plan = $1, status = 'awaiting_approval' WHERE id = $2 AND status = 'pending'`
+	if _, err := s.DB.Exec(ctx, query, data, versionID); err != nil {
+		return fmt.Errorf("failed to reopen change plan: %w", err)
+	}
+	return nil
+}
+
+// FailUnqueuedVersion fails a pending version whose build job could not be
+// queued, so it can be retried instead of staying pending without a job
+func (s *VersionService) FailUnqueuedVersion(ctx context.Context, versionID string, cause error) error {
+	message := fmt.Sprintf("Failed to queue the build: %v", cause)
+	failure, err := json.Marshal(&models.BuildFailure{Stage: "queue", Category: "internal_error", Retryable: true})
+	if err != nil {
+		return fmt.Errorf("failed to encode build failure: %w", err)
+	}
+
+	query := `UPDATE versions SET status = 'failed', error_message = $1, failure = $2 WHERE id = $3 AND status = 'pending'`
+	if _, err := s.DB.Exec(ctx, query, message, failure, versionID); err != nil {
+		return fmt.Errorf("failed to update version: %w", err)
+	}
+	return nil
+}
+
+// Limits of change plans edited by users
+const (
+	maxPlanFiles        = 500
+	maxPlanDependencies = 100
+	maxPlanTextChars    = 20000
+)
+
+// ValidateChangePlan checks a change plan edited by the user
+func ValidateChangePlan(plan *models.ChangePlan) error {
+	var problems []string
+	if strings.TrimSpace(plan.Summary) == "" {
+		problems = append(problems, "summary is required")
+	}
+	if len(plan.Summary)+len(plan.Approach) > maxPlanTextChars {
+		problems = append(problems, fmt.Sprintf("summary and approach may be at most %d characters", maxPlanTextChars))
+	}
+	if len(plan.Files) > maxPlanFiles {
+		problems = append(problems, fmt.Sprintf("at most %d files", maxPlanFiles))
+	}
+	for i, file := range plan.Files {
+		if strings.TrimSpace(file.Path) == "" {
+			problems = append(problems, fmt.Sprintf("files[%d].path is required", i))
+		}
+		if file.Action != "create" && file.Action != "modify" && file.Action != "delete" {
+			problems = append(problems, fmt.Sprintf("files[%d].action must be create, modify or delete", i))
+		}
+	}
+	if len(plan.Dependencies) > maxPlanDependencies {
+		problems = append(problems, fmt.Sprintf("at most %d dependencies", maxPlanDependencies))
+	}
+	for i, dep := range plan.Dependencies {
+		if strings.TrimSpace(dep.Name) == "" {
+			problems = append(problems, fmt.Sprintf("dependencies[%d].name is required", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid change plan: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ResetAgentSessions forgets the stored agent sessions of an app's versions,
+// so the next build starts a new session
+func (s *VersionService) ResetAgentSessions(ctx context.Context, appID string) error {
+	query := `UPDATE versions SET agent_session = NULL WHERE app_id = $1`
+	if _, err := s.DB.Exec(ctx, query, appID); err != nil {
+		return fmt.Errorf("failed to reset agent sessions: %w", err)
+	}
+	return nil
+}
+
 // PromoteVersion promotes a version to production
 func (s *VersionService) PromoteVersion(ctx context.Context, versionID string) error {
 	// Get the version to promote
@@ -234,10 +455,10 @@ func (s *VersionService) PromoteVersion(ctx context.Context, versionID string) e
 	}
 
 	if version.VercelDeployID == nil || *version.VercelDeployID == "" {
-		return fmt.Errorf("version has no vercel deployment ID")
+		return fmt.Errorf("version has no deployment ID")
 	}
 
-	// Fetch app to get Vercel project ID, prod_version, and production_url
+	// Fetch app to get the deployment project ID, prod_version, and production_url
 	var app models.App
 	getAppQuery := `SELECT vercel_project_id, prod_version, production_url FROM apps WHERE id = $1`
 	err = s.DB.QueryRow(ctx, getAppQuery, version.AppID).Scan(&app.VercelProjectID, &app.ProdVersion, &app.ProductionURL)
@@ -246,13 +467,13 @@ func (s *VersionService) PromoteVersion(ctx context.Context, versionID string) e
 	}
 
 	if app.VercelProjectID == nil || *app.VercelProjectID == "" {
-		return fmt.Errorf("app has no vercel project ID")
+		return fmt.Errorf("app has no deployment project ID")
 	}
 
 	// If this is the first promotion, add the custom production domain to the project
 	if app.ProdVersion == nil && app.ProductionURL != nil && *app.ProductionURL != "" {
 		log.Printf("[PromoteVersion] First promotion - adding custom domain %s to project %s\n", *app.ProductionURL, *app.VercelProjectID)
-		err = s.VercelService.AddDomainToProject(*app.VercelProjectID, *app.ProductionURL)
+		err = s.Deployer.AddDomain(ctx, *app.VercelProjectID, *app.ProductionURL)
 		if err != nil {
 			// Log warning but don't fail the promotion
 			log.Printf("[PromoteVersion] Warning: Failed to add custom domain to project: %v\n", err)
@@ -266,10 +487,10 @@ func (s *VersionService) PromoteVersion(ctx context.Context, versionID string) e
 		return fmt.Errorf("app has no production URL configured")
 	}
 
-	// Call Vercel API to update the production domain to point to this deployment
-	err = s.VercelService.PromoteDeployment(*app.VercelProjectID, *version.VercelDeployID, *app.ProductionURL)
+	// Point the production domain at this deployment
+	err = s.Deployer.Promote(ctx, *app.VercelProjectID, *version.VercelDeployID, *app.ProductionURL)
 	if err != nil {
-		return fmt.Errorf("failed to promote deployment on Vercel: %w", err)
+		return fmt.Errorf("failed to promote deployment on %s: %w", s.Deployer.Name(), err)
 	}
 
 	// Update the app's prod_version
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+type WorkerService struct {
+	DB *db.PostgresClient
+}
+
+func NewWorkerService(dbClient *db.PostgresClient) *WorkerService {
+	return &WorkerService{DB: dbClient}
+}
+
+// RegisterWorker records a worker process as running
+func (s *WorkerService) RegisterWorker(ctx context.Context, workerID, hostname string, pid, concurrency int) error {
+	now := time.Now()
+	query := `
+		INSERT INTO workers (id, hostname, pid, status, concurrency, active_jobs, started_at, last_seen_at)
+		VALUES ($1, $2, $3, 'running', $4, 0, $5, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET hostname = $2, pid = $3, status = 'running', concurrency = $4, active_jobs = 0, started_at = $5, last_seen_at = $5
+	`
+
+	if _, err := s.DB.Exec(ctx, query, workerID, hostname, pid, concurrency, now); err != nil {
+		return fmt.Errorf("failed to register worker: %w", err)
+	}
+
+	return nil
+}
+
+// Heartbeat refreshes a worker's liveness and active job count
+func (s *WorkerService) Heartbeat(ctx context.Context, workerID string, activeJobs int) error {
+	query := `UPDATE workers SET last_seen_at = $1, active_jobs = $2, status = 'running' WHERE id = $3`
+
+	if _, err := s.DB.Exec(ctx, query, time.Now(), activeJobs, workerID); err != nil {
+		return fmt.Errorf("failed to heartbeat worker: %w", err)
+	}
+
+	return nil
+}
+
+// DeregisterWorker marks a worker as stopped
+func (s *WorkerService) DeregisterWorker(ctx context.Context, workerID string) error {
+	query := `UPDATE workers SET status = 'stopped', active_jobs = 0, last_seen_at = $1 WHERE id = $2`
+
+	if _, err := s.DB.Exec(ctx, query, time.Now(), workerID); err != nil {
+		return fmt.Errorf("failed to deregister worker: %w", err)
+	}
+
+	return nil
+}
+
+// GetWorker retrieves a worker by ID. A worker is considered alive when it is
+// running and has been seen within the lease timeout.
+func (s *WorkerService) GetWorker(ctx context.Context, workerID string, leaseTimeout time.Duration) (*models.Worker, error) {
+	worker := &models.Worker{}
+	query := `
+		SELECT id, hostname, pid, status, concurrency, active_jobs, started_at, last_seen_at
+		FROM workers
+		WHERE id = $1
+	`
+
+	err := s.DB.QueryRow(ctx, query, workerID).Scan(
+		&worker.ID, &worker.Hostname, &worker.PID, &worker.Status,
+		&worker.Concurrency, &worker.ActiveJobs, &worker.StartedAt, &worker.LastSeenAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("worker not found: %w", err)
+	}
+
+	worker.Alive = worker.Status == "running" && time.Since(worker.LastSeenAt) < leaseTimeout
+	return worker, nil
+}
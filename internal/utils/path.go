@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithinDir reports whether path is root or inside it
+func WithinDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// CheckResolved resolves the symlinks in path, or in its deepest existing
+// parent, and checks that the result is still inside root
+func CheckResolved(root, path string) error {
+	for path != root {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if !WithinDir(root, resolved) {
+		return fmt.Errorf("resolves outside the destination")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ExitCode returns the exit code of the process behind err, 0 when err is nil,
+// or nil when err did not come from a process that exited
+func ExitCode(err error) *int {
+	code := 0
+	if err == nil {
+		return &code
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() < 0 {
+		return nil
+	}
+
+	code = exitErr.ExitCode()
+	return &code
+}
+
+// CommandError reports a failed command with a readable message (usually its
+// stderr) while keeping the underlying *exec.ExitError available to ExitCode
+type CommandError struct {
+	Message string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package utils
+
+import (
+	"os/exec"
+	"time"
+)
+
+// KillProcessGroupOnCancel falls back to killing only the process itself on
+// platforms without process groups
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 10 * time.Second
+}
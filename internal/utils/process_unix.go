@@ -0,0 +1,30 @@
+//go:build unix
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// processWaitDelay bounds how long Wait blocks on output pipes held open by
+// orphaned grandchildren after the process group was killed
+const processWaitDelay = 10 * time.Second
+
+// KillProcessGroupOnCancel runs cmd in its own process group and makes context
+// cancellation kill the whole group, so tools spawned by the command (node,
+// npm, build servers) do not outlive a cancelled or timed out build.
+// Must be called before cmd.Start.
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	cmd.Cancel = func() error {
+		// Negative PID signals every process in the group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = processWaitDelay
+}
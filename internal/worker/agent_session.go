@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// agentHistoryDir is the workspace folder code generators keep their session
+// in. It is not part of the packaged code; it is stored per version next to it.
+const agentHistoryDir = ".agent-history"
+
+// maxAgentSessionBytes bounds the stored session of a version. Larger
+// sessions are not stored and the next version starts a new one.
+const maxAgentSessionBytes = 50 * 1024 * 1024
+
+// saveAgentSession uploads the workspace's agent session so versions built
+// on this one resume it
+func (b *Builder) saveAgentSession(ctx context.Context, workspaceDir, appID, versionID string) {
+	dir := filepath.Join(workspaceDir, agentHistoryDir)
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "agent-session-*.tar.gz")
+	if err != nil {
+		log.Printf("[AgentSession] Warning: Failed to create archive for version %s: %v\n", versionID, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeArchive(tmp, dir); err != nil {
+		log.Printf("[AgentSession] Warning: Failed to archive session of version %s: %v\n", versionID, err)
+		return
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		log.Printf("[AgentSession] Warning: Failed to archive session of version %s: %v\n", versionID, err)
+		return
+	}
+	if size > maxAgentSessionBytes {
+		log.Printf("[AgentSession] Session of version %s is %d MB, not storing it\n", versionID, size/(1024*1024))
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		log.Printf("[AgentSession] Warning: Failed to archive session of version %s: %v\n", versionID, err)
+		return
+	}
+
+	key := fmt.Sprintf("apps/%s/versions/%s/agent-session.tar.gz", appID, versionID)
+	_, err = b.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.Config.S3Bucket),
+		Key:    aws.String(key),
+		Body:   tmp,
+	})
+	if err != nil {
+		log.Printf("[AgentSession] Warning: Failed to upload session of version %s: %v\n", versionID, err)
+		return
+	}
+
+	if _, err := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+		"agent_session": key,
+	}); err != nil {
+		log.Printf("[AgentSession] Warning: Failed to record session of version %s: %v\n", versionID, err)
+	}
+}
+
+// restoreAgentSession restores the agent session stored with the base version
+// into the workspace. Without one (first version, reset memory, or a failed
+// download) the agent starts a new session.
+func (b *Builder) restoreAgentSession(ctx context.Context, workspaceDir string, base *models.Version) {
+	if base == nil || base.AgentSession == nil || *base.AgentSession == "" {
+		return
+	}
+
+	if err := b.downloadAgentSession(ctx, *base.AgentSession, filepath.Join(workspaceDir, agentHistoryDir)); err != nil {
+		log.Printf("[AgentSession] Warning: Failed to restore session of version %s, starting a new one: %v\n", base.ID, err)
+		os.RemoveAll(filepath.Join(workspaceDir, agentHistoryDir))
+		return
+	}
+	log.Printf("[AgentSession] Restored session of version %s\n", base.ID)
+}
+
+func (b *Builder) downloadAgentSession(ctx context.Context, s3Path, dir string) error {
+	result, err := b.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Config.S3Bucket),
+		Key:    aws.String(s3Path),
+	})
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	tmp, err := os.CreateTemp("", "agent-session-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, io.LimitReader(result.Body, maxAgentSessionBytes+1))
+	if err != nil {
+		return err
+	}
+	if n > maxAgentSessionBytes {
+		return fmt.Errorf("session archive is larger than %d MB", maxAgentSessionBytes/(1024*1024))
+	}
+
+	os.RemoveAll(dir)
+	return extractArchive(tmp.Name(), dir)
+}
@@ -2,90 +2,107 @@ package worker
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/redis/go-redis/v9"
 	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
 	"github.com/rapidbuildapp/rapidbuild/internal/models"
 	"github.com/rapidbuildapp/rapidbuild/internal/services"
 )
 
 type Builder struct {
-	Config         *config.Config
-	AppService     *services.AppService
-	VersionService *services.VersionService
-	VercelService  *services.VercelService
-	S3Client       *s3.Client
-	RedisClient    *redis.Client
+	Config             *config.Config
+	AppService         *services.AppService
+	AppManager         appmanager.Manager
+	VersionService     *services.VersionService
+	Deployer           services.Deployer
+	Executor           executor.Executor
+	BuildStepService   *services.BuildStepService
+	BuildLogService    *services.BuildLogService
+	DependencyCache    *DependencyCache // nil when disabled
+	BuildPolicyService *services.BuildPolicyService
+	UploadService      *services.UploadService
+	PromptService      *services.PromptTemplateService
+	StarterService     *services.StarterService
+	UsageService       *services.UsageService
+	JobService         *services.JobService
+	WorkerService      *services.WorkerService
+	S3Client           *s3.Client
+	RedisClient        *redis.Client
+	WorkerID           string
+	CodeGenerators     map[string]CodeGenerator
+
+	// Parsed from SECURITY_BLOCK_SEVERITY and SECURITY_RULE_SEVERITIES
+	securityScanner *securityScanner
+
+	// Cancel functions of builds running on this worker, keyed by version ID
+	activeMu     sync.Mutex
+	activeBuilds map[string]context.CancelFunc
 }
 
-func NewBuilder(cfg *config.Config, appService *services.AppService, versionService *services.VersionService, vercelService *services.VercelService, s3Client *s3.Client, redisClient *redis.Client) *Builder {
-	return &Builder{
-		Config:         cfg,
-		AppService:     appService,
-		VersionService: versionService,
-		VercelService:  vercelService,
-		S3Client:       s3Client,
-		RedisClient:    redisClient,
-	}
-}
-
-// findClaudePath attempts to locate the Claude CLI executable
-func findClaudePath() string {
-	// Check environment variable first
-	if path := os.Getenv("CLAUDE_CLI_PATH"); path != "" {
-		return path
-	}
-
-	// Try common installation paths
-	commonPaths := []string{
-		"/home/ubuntu/.local/bin/claude",
-		"/usr/local/bin/claude",
-		"/home/ubuntu/.nvm/versions/node/v22.16.0/bin/claude",
-		"/usr/bin/claude",
-	}
-
-	for _, path := range commonPaths {
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
+func NewBuilder(cfg *config.Config, appService *services.AppService, appManager appmanager.Manager, versionService *services.VersionService, deployer services.Deployer, exec executor.Executor, buildStepService *services.BuildStepService, buildLogService *services.BuildLogService, dependencyCache *DependencyCache, buildPolicyService *services.BuildPolicyService, uploadService *services.UploadService, promptService *services.PromptTemplateService, starterService *services.StarterService, usageService *services.UsageService, jobService *services.JobService, workerService *services.WorkerService, s3Client *s3.Client, redisClient *redis.Client) (*Builder, error) {
+	// Invalid severities fail at startup rather than in every build's scan
+	scanner, err := newSecurityScanner(cfg.SecurityBlockSeverity, cfg.SecurityRuleSeverities)
+	if err != nil {
+		return nil, err
 	}
 
-	// Return "claude" as fallback (relies on PATH)
-	return "claude"
+	return &Builder{
+		Config:             cfg,
+		AppService:         appService,
+		AppManager:         appManager,
+		VersionService:     versionService,
+		Deployer:           deployer,
+		Executor:           exec,
+		BuildStepService:   buildStepService,
+		BuildLogService:    buildLogService,
+		DependencyCache:    dependencyCache,
+		BuildPolicyService: buildPolicyService,
+		UploadService:      uploadService,
+		PromptService:      promptService,
+		StarterService:     starterService,
+		UsageService:       usageService,
+		JobService:         jobService,
+		WorkerService:      workerService,
+		S3Client:           s3Client,
+		RedisClient:        redisClient,
+		WorkerID:           newWorkerID(cfg),
+		CodeGenerators:     newCodeGenerators(exec),
+		securityScanner:    scanner,
+		activeBuilds:       make(map[string]context.CancelFunc),
+	}, nil
 }
 
 // BuildApp orchestrates the entire build process
-func (b *Builder) BuildApp(ctx context.Context, versionID, appID, requirements string, comments []models.Comment, ownerEmail string) error {
-	// Add panic recovery
+func (b *Builder) BuildApp(ctx context.Context, versionID, appID string, payload models.BuildJobPayload) (err error) {
+	// A panic fails the version and the app like any other error, and the
+	// returned error makes the queue fail the job instead of completing it
 	defer func() {
 		if r := recover(); r != nil {
-			errMsg := fmt.Sprintf("Build panic: %v", r)
-			log.Printf("[BuildApp] PANIC for version %s: %s\n", versionID, errMsg)
-			b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
-				"status":        "failed",
-				"error_message": &errMsg,
-			})
+			log.Printf("[BuildApp] PANIC for version %s: %v\n", versionID, r)
+			err = b.handleError(ctx, versionID, "worker", "Build panicked", withFailureCategory(failureInternal, fmt.Errorf("build panicked: %v", r)))
 		}
 	}()
 
 	log.Printf("[BuildApp] Starting build for version %s, app %s\n", versionID, appID)
 
 	// Update status to building immediately
-	_, err := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+	_, err = b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
 		"status": "building",
 	})
 	if err != nil {
@@ -94,72 +111,185 @@ func (b *Builder) BuildApp(ctx context.Context, versionID, appID, requirements s
 
 	b.sendProgress(versionID, "building", "Starting build process...")
 
-	// Create workspace using appID for easier troubleshooting
+	// Retry and timeout limits of this app (plan defaults plus app overrides)
+	policy := b.buildPolicy(ctx, appID)
+
+	// Close steps left running by an earlier attempt whose worker died
+	if b.BuildStepService != nil {
+		if err := b.BuildStepService.AbortRunningSteps(ctx, versionID, "failed"); err != nil {
+			log.Printf("[BuildApp] Warning: %v\n", err)
+		}
+	}
+
+	// Create workspace using appID for easier troubleshooting.
+	// Safe to share per app because the build queue runs one build per app at a time.
 	workspaceDir := filepath.Join(b.Config.WorkspaceDir, appID)
+	step := b.startStep(ctx, appID, versionID, stepWorkspaceSetup, 1)
 	if err := os.MkdirAll(workspaceDir, 0755); err != nil {
-		return b.handleError(ctx, versionID, "Failed to create workspace", err)
+		step.finish(ctx, err)
+		return b.handleError(ctx, versionID, stepWorkspaceSetup, "Failed to create workspace", err)
 	}
 	defer b.cleanup(workspaceDir)
 
-	// Download previous version from S3 if exists, otherwise use starter code
+	// Download previous version from S3 if exists, otherwise install the app's starter
 	b.sendProgress(versionID, "building", "Setting up workspace...")
-	isFirstVersion, err := b.setupWorkspace(ctx, workspaceDir, appID)
+	baseVersion, err := b.setupWorkspace(ctx, workspaceDir, appID, versionID, payload)
+	step.finish(ctx, err)
 	if err != nil {
-		return b.handleError(ctx, versionID, "Failed to setup workspace", err)
+		return b.handleError(ctx, versionID, stepWorkspaceSetup, "Failed to setup workspace", err)
+	}
+	isFirstVersion := baseVersion == nil
+
+	// Record the code this version starts from so retries can start from it again,
+	// and carry over the starter the app's code was born from
+	var baseVersionID *string
+	if baseVersion != nil {
+		baseVersionID = &baseVersion.ID
+	}
+	updates := map[string]interface{}{"base_version_id": baseVersionID}
+	if baseVersion != nil && baseVersion.Starter != nil {
+		updates["starter"] = baseVersion.Starter
+	}
+	if _, err := b.VersionService.UpdateVersion(ctx, versionID, updates); err != nil {
+		log.Printf("[BuildApp] Warning: Failed to record base version: %v\n", err)
+	}
+
+	// Resume the agent session of the version the code comes from
+	b.restoreAgentSession(ctx, workspaceDir, baseVersion)
+
+	// Restore node_modules before the agent runs so it and the build start from installed dependencies
+	b.restoreDependencies(ctx, workspaceDir, appID, versionID)
+
+	if err := b.Executor.Prepare(workspaceDir); err != nil {
+		return b.handleError(ctx, versionID, stepWorkspaceSetup, "Failed to prepare workspace sandbox", withFailureCategory(failureSandbox, err))
+	}
+
+	// Pick the code generator configured for this app
+	var appGenerator *string
+	if app, err := b.AppService.GetAppByID(ctx, appID); err == nil {
+		appGenerator = app.CodeGenerator
+	} else {
+		log.Printf("[BuildApp] Warning: Failed to load app settings, using default code generator: %v\n", err)
+	}
+	generator, err := b.codeGeneratorFor(appGenerator)
+	if err != nil {
+		return b.handleError(ctx, versionID, stepCodeGeneration, "Invalid code generator", withFailureCategory(failureConfig, err))
+	}
+
+	// Prompt template and custom instructions of this app
+	prompts, err := b.loadPromptSettings(ctx, appID)
+	if err != nil {
+		return b.handleError(ctx, versionID, stepCodeGeneration, "Invalid prompt template", withFailureCategory(failureConfig, err))
+	}
+	if _, err := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{"prompt_template": prompts.template.Ref()}); err != nil {
+		log.Printf("[BuildApp] Warning: Failed to record prompt template: %v\n", err)
 	}
 
-	// Handle Vercel project linking
-	var vercelProjectID string
+	// Plan-first builds stop after planning until the user approves the plan
+	if payload.PlanFirst && payload.ApprovedPlan == nil && !payload.SkipCodeGeneration {
+		files := b.downloadRequirementFiles(ctx, workspaceDir, appID, versionID)
+		prompt, err := b.buildPrompt(prompts, appID, payload.Requirements, payload.Comments, files)
+		if err != nil {
+			return b.handleError(ctx, versionID, stepPlan, "Invalid prompt template", withFailureCategory(failureConfig, err))
+		}
+		return b.planChanges(ctx, generator, workspaceDir, appID, versionID, prompt, policy)
+	}
+
+	// Handle deployment project linking
+	var projectID string
 	if isFirstVersion {
-		// First version - always need to link Vercel project
-		b.sendProgress(versionID, "building", "Linking Vercel project...")
-		vercelProjectID, err = b.linkVercel(ctx, workspaceDir, versionID)
+		// First version - always need to link the deployment project
+		b.sendProgress(versionID, "building", "Linking deployment project...")
+		step := b.startStep(ctx, appID, versionID, stepLink, 1)
+		err = withStageTimeout(ctx, "Linking", policy.LinkTimeoutMinutes, func(ctx context.Context) error {
+			projectID, err = b.Deployer.Link(ctx, workspaceDir, appID, step)
+			return err
+		})
+		step.finish(ctx, err)
 		if err != nil {
-			return b.handleError(ctx, versionID, "Failed to link Vercel project", err)
+			return b.handleError(ctx, versionID, stepLink, "Failed to link deployment project", err)
 		}
 	} else {
-		// Subsequent version - .vercel folder should exist from S3, just read project ID
-		log.Printf("[Vercel] Reusing existing .vercel folder from previous version\n")
-		vercelProjectID, err = b.getVercelProjectID(workspaceDir)
+		// Subsequent version - project metadata should exist from S3, just read project ID
+		log.Printf("[Deploy] Reusing existing %s project from previous version\n", b.Deployer.Name())
+		projectID, err = b.Deployer.ProjectID(workspaceDir)
 		if err != nil {
-			log.Printf("[Vercel] Warning: Could not read project ID from .vercel folder: %v\n", err)
+			log.Printf("[Deploy] Warning: Could not read project ID from workspace: %v\n", err)
 		} else {
-			log.Printf("[Vercel] Project ID from existing .vercel folder: %s\n", vercelProjectID)
+			log.Printf("[Deploy] Project ID from workspace: %s\n", projectID)
 		}
 	}
 
-	// Store Vercel project ID in apps table
-	if vercelProjectID != "" {
+	// Store project ID in apps table
+	if projectID != "" {
 		updateQuery := `UPDATE apps SET vercel_project_id = $1, updated_at = $2 WHERE id = $3`
-		_, err = b.VersionService.DB.Exec(ctx, updateQuery, vercelProjectID, time.Now(), appID)
+		_, err = b.VersionService.DB.Exec(ctx, updateQuery, projectID, time.Now(), appID)
 		if err != nil {
-			log.Printf("[Vercel] Warning: Failed to store Vercel project ID: %v\n", err)
+			log.Printf("[Deploy] Warning: Failed to store project ID: %v\n", err)
 		} else {
-			log.Printf("[Vercel] Stored project ID %s for app %s\n", vercelProjectID, appID)
+			log.Printf("[Deploy] Stored project ID %s for app %s\n", projectID, appID)
 		}
 	}
 
-	// Prepare prompt for Claude
-	prompt := b.buildPrompt(appID, requirements, comments)
+	if payload.SkipCodeGeneration {
+		// Build-only retry: the workspace holds the code generated for the retried version
+		log.Printf("[CodeGen] Reusing code of version %s for version %s\n", baseVersion.ID, versionID)
+		b.sendProgress(versionID, "building", fmt.Sprintf("Reusing generated code of version %d...", baseVersion.VersionNumber))
+	} else {
+		// Download the files the user attached to the requirements into the workspace
+		files := b.downloadRequirementFiles(ctx, workspaceDir, appID, versionID)
+
+		// Prepare prompt for the code generator
+		prompt, err := b.buildPrompt(prompts, appID, payload.Requirements, payload.Comments, files)
+		if err != nil {
+			return b.handleError(ctx, versionID, stepCodeGeneration, "Invalid prompt template", withFailureCategory(failureConfig, err))
+		}
+		if payload.ApprovedPlan != nil {
+			prompt += approvedPlanPrompt(payload.ApprovedPlan)
+		}
 
-	// Run Claude CLI
-	b.sendProgress(versionID, "building", "Running AI code generation...")
-	if err := b.runClaude(ctx, workspaceDir, prompt, versionID); err != nil {
-		return b.handleError(ctx, versionID, "AI code generation failed", err)
+		// Run AI code generation
+		b.sendProgress(versionID, "building", "Running AI code generation...")
+		step = b.startStep(ctx, appID, versionID, stepCodeGeneration, 1)
+		var result *GenerationResult
+		err = withStageTimeout(ctx, "Code generation", policy.AgentTimeoutMinutes, func(ctx context.Context) error {
+			result, err = generator.Generate(ctx, workspaceDir, prompt, step)
+			return err
+		})
+		step.finish(ctx, err)
+		b.recordUsage(ctx, generator, appID, versionID, services.UsageGenerate, 1, result)
+		if err != nil {
+			return b.handleError(ctx, versionID, stepCodeGeneration, "AI code generation failed", err)
+		}
+		log.Printf("[CodeGen] %s changed %d files for version %s\n", generator.Name(), len(result.FilesChanged), versionID)
 	}
 
-	// Build/fix retry loop (max 3 attempts)
+	// Build/verify/fix retry loop (policy.MaxAttempts attempts)
+	maxAttempts := policy.MaxAttempts
 	var buildErr error
-	for attempt := 1; attempt <= 3; attempt++ {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		// Send progress update
 		if attempt == 1 {
-			b.sendProgress(versionID, "building", "Building with Vercel...")
+			b.sendProgress(versionID, "building", "Building app...")
 		} else {
-			b.sendProgress(versionID, "building", fmt.Sprintf("Retrying build (attempt %d/3)...", attempt))
+			b.sendProgress(versionID, "building", fmt.Sprintf("Retrying build (attempt %d/%d)...", attempt, maxAttempts))
 		}
 
-		// Run Vercel build
-		buildErr = b.buildForVercel(ctx, workspaceDir, versionID, attempt)
+		// Run the deployer's build
+		log.Printf("[BuildApp] Building version %s with %s (attempt %d/%d)\n", versionID, b.Deployer.Name(), attempt, maxAttempts)
+		step := b.startStep(ctx, appID, versionID, stepBuild, attempt)
+		buildErr = withStageTimeout(ctx, "Build", policy.BuildTimeoutMinutes, func(ctx context.Context) error {
+			return b.Deployer.Build(ctx, workspaceDir, step)
+		})
+		step.finish(ctx, buildErr)
+
+		// Run the app's tests, linter and type checker on a successful build
+		failure, failedStage := "Build", stepBuild
+		if buildErr == nil {
+			b.sendProgress(versionID, "building", "Verifying app...")
+			buildErr = b.verifyBuild(ctx, workspaceDir, appID, versionID, attempt, policy)
+			failure, failedStage = "Verification", stepVerify
+		}
 
 		if buildErr == nil {
 			// Build successful!
@@ -167,136 +297,195 @@ func (b *Builder) BuildApp(ctx context.Context, versionID, appID, requirements s
 			break
 		}
 
-		// Build failed
-		log.Printf("[BuildApp] Build failed (attempt %d/3): %v\n", attempt, buildErr)
+		// Build or verification failed
+		log.Printf("[BuildApp] %s failed (attempt %d/%d): %v\n", failure, attempt, maxAttempts, buildErr)
 
 		// If this was the last attempt, give up
-		if attempt >= 3 {
-			return b.handleError(ctx, versionID, "Build failed after 3 attempts", buildErr)
+		if attempt >= maxAttempts {
+			return b.handleGeneratedCodeError(ctx, workspaceDir, appID, versionID, failedStage, fmt.Sprintf("%s failed after %d attempts", failure, maxAttempts), buildErr)
 		}
 
-		// Ask Claude to fix the errors
-		b.sendProgress(versionID, "building", fmt.Sprintf("Build failed (attempt %d/3), Claude is fixing errors...", attempt))
+		// Ask the code generator to fix the errors
+		b.sendProgress(versionID, "building", fmt.Sprintf("%s failed (attempt %d/%d), AI is fixing errors...", failure, attempt, maxAttempts))
 
-		if err := b.fixBuildErrors(ctx, workspaceDir, versionID, buildErr.Error(), attempt); err != nil {
-			return b.handleError(ctx, versionID, "Claude failed to fix build errors", err)
+		if err := b.fixBuildErrors(ctx, generator, prompts, workspaceDir, appID, versionID, buildErr.Error(), attempt, policy); err != nil {
+			return b.handleGeneratedCodeError(ctx, workspaceDir, appID, versionID, stepFix, "AI failed to fix build errors", err)
 		}
 
 		// Loop will retry the build
 	}
 
+	// Check the generated code and the built output before anything is deployed
+	b.sendProgress(versionID, "building", "Scanning for security issues...")
+	if err := b.scanSecurity(ctx, workspaceDir, appID, versionID); err != nil {
+		return b.handleGeneratedCodeError(ctx, workspaceDir, appID, versionID, stepSecurityScan, "Security scan failed", err)
+	}
+
 	// Create app database and collections if schemas exist
 	schemasDir := filepath.Join(workspaceDir, "schemas")
 	if _, err := os.Stat(schemasDir); err == nil {
 		b.sendProgress(versionID, "building", "Setting up database schema...")
+		step := b.startStep(ctx, appID, versionID, stepSchemaSetup, 1)
 
-		// Fetch app details to pass to app-manager (for logo, name, etc.)
-		app, err := b.AppService.GetApp(ctx, appID, "")
-		if err != nil {
-			log.Printf("[BuildApp] Warning: Failed to fetch app details: %v\n", err)
-			app = nil
+		// Fetch app details so the MongoDB app gets the current name and logo
+		var app *models.App
+		if b.AppService != nil {
+			app, err = b.AppService.GetAppByID(ctx, appID)
+			if err != nil {
+				log.Printf("[BuildApp] Warning: Failed to fetch app details: %v\n", err)
+				app = nil
+			}
 		}
 
-		if err := b.setupDatabase(ctx, schemasDir, appID, ownerEmail, app); err != nil {
+		err = withStageTimeout(ctx, "Database setup", policy.SchemaTimeoutMinutes, func(ctx context.Context) error {
+			return b.setupDatabase(ctx, schemasDir, appID, payload.OwnerEmail, app, step)
+		})
+		step.finish(ctx, err)
+		if err != nil {
 			// Log warning but don't fail the build - database setup is optional
 			log.Printf("[BuildApp] Warning: Failed to setup database for app %s: %v\n", appID, err)
 		}
 	}
 
-	// Deploy to Vercel (workspace is pre-built by Claude)
-	b.sendProgress(versionID, "building", "Deploying to Vercel...")
-	vercelURL, vercelDeployID, err := b.deployToVercel(ctx, workspaceDir, appID, versionID)
+	// Deploy the pre-built workspace
+	b.sendProgress(versionID, "building", "Deploying app...")
+	step = b.startStep(ctx, appID, versionID, stepDeploy, 1)
+	var deployment *services.Deployment
+	err = withStageTimeout(ctx, "Deployment", policy.DeployTimeoutMinutes, func(ctx context.Context) error {
+		deployment, err = b.Deployer.Deploy(ctx, workspaceDir, appID, versionID, step)
+		return err
+	})
+	step.finish(ctx, err)
 	if err != nil {
-		return b.handleError(ctx, versionID, "Failed to deploy to Vercel", err)
+		return b.handleGeneratedCodeError(ctx, workspaceDir, appID, versionID, stepDeploy, "Failed to deploy app", err)
 	}
 
-	// Disable Vercel deployment protection to make it publicly accessible
-	if b.VercelService != nil {
-		projectID, err := b.getVercelProjectID(workspaceDir)
-		if err != nil {
-			log.Printf("[Vercel] Warning: Could not read project ID to disable protection: %v\n", err)
-		} else {
-			log.Printf("[Vercel] Disabling deployment protection for project %s\n", projectID)
-			if err := b.VercelService.DisableDeploymentProtection(projectID); err != nil {
-				// Log but don't fail the build - this is not critical
-				log.Printf("[Vercel] Warning: Failed to disable deployment protection: %v\n", err)
-			} else {
-				log.Printf("[Vercel] ✅ Deployment protection disabled\n")
-			}
-		}
-	}
-
-	// Update version with Vercel URL and mark as completed
+	// Update version with deployment URL and mark as completed
 	// User can now view the preview!
 	_, err = b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
-		"vercel_url":       vercelURL,
-		"vercel_deploy_id": vercelDeployID,
+		"vercel_url":       deployment.URL,
+		"vercel_deploy_id": deployment.ID,
 		"status":           "completed",
 	})
 	if err != nil {
-		log.Printf("[BuildApp] ERROR updating version with Vercel URL and status: %v\n", err)
-		return b.handleError(ctx, versionID, "Failed to mark as completed", err)
+		log.Printf("[BuildApp] ERROR updating version with deployment URL and status: %v\n", err)
+		return b.handleError(ctx, versionID, stepDeploy, "Failed to mark as completed", withFailureCategory(failureInternal, err))
 	}
 
 	b.sendProgress(versionID, "completed", "Build completed successfully!")
 	log.Printf("[BuildApp] ✅ Build completed successfully for version %s\n", versionID)
 
-	// Launch async background tasks for S3 upload and app status update
-	// These are not critical for users to view the preview
-	go func() {
-		bgCtx := context.Background()
+	// Package the code and mark the app active before releasing the workspace.
+	// This runs before the job completes so the next build of this app (which is
+	// held back until then) restores from this version's code. Failures here are
+	// not critical for users to view the preview.
+	b.finalizeBuild(context.WithoutCancel(ctx), workspaceDir, appID, versionID)
 
-		// Package core code for next iteration
-		log.Printf("[BuildApp] [Async] Packaging code for version %s\n", versionID)
-		tarPath, err := b.packageCode(workspaceDir)
-		if err != nil {
-			log.Printf("[BuildApp] [Async] Warning: Failed to package code: %v\n", err)
-			return
-		}
+	return nil
+}
 
-		// Upload to S3
-		log.Printf("[BuildApp] [Async] Uploading to S3 for version %s\n", versionID)
-		s3Path, err := b.uploadToS3(bgCtx, tarPath, appID, versionID)
-		if err != nil {
-			log.Printf("[BuildApp] [Async] Warning: Failed to upload to S3: %v\n", err)
-			return
-		}
+// finalizeBuild uploads the workspace to S3 for the next iteration and marks the app active
+func (b *Builder) finalizeBuild(ctx context.Context, workspaceDir, appID, versionID string) {
+	// Package core code for next iteration
+	log.Printf("[BuildApp] Packaging code for version %s\n", versionID)
+	step := b.startStep(ctx, appID, versionID, stepPackage, 1)
+	tarPath, err := b.packageCode(workspaceDir)
+	if err != nil {
+		step.finish(ctx, err)
+		log.Printf("[BuildApp] Warning: Failed to package code: %v\n", err)
+		return
+	}
 
-		// Update version with S3 path
-		_, err = b.VersionService.UpdateVersion(bgCtx, versionID, map[string]interface{}{
-			"s3_code_path": s3Path,
-		})
-		if err != nil {
-			log.Printf("[BuildApp] [Async] Warning: Failed to update S3 path: %v\n", err)
-		} else {
-			log.Printf("[BuildApp] [Async] ✅ S3 upload completed for version %s\n", versionID)
-		}
+	// Upload to S3
+	log.Printf("[BuildApp] Uploading to S3 for version %s\n", versionID)
+	s3Path, err := b.uploadToS3(ctx, tarPath, appID, versionID)
+	if err == nil {
+		fmt.Fprintf(step, "Uploaded %s to %s\n", filepath.Base(tarPath), s3Path)
+	}
+	step.finish(ctx, err)
+	if err != nil {
+		log.Printf("[BuildApp] Warning: Failed to upload to S3: %v\n", err)
+		return
+	}
 
-		// Update app status to active
-		_, err = b.AppService.UpdateApp(bgCtx, appID, "", map[string]interface{}{
-			"status": "active",
-		})
+	// Update version with S3 path
+	_, err = b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+		"s3_code_path": s3Path,
+	})
+	if err != nil {
+		log.Printf("[BuildApp] Warning: Failed to update S3 path: %v\n", err)
+	} else {
+		log.Printf("[BuildApp] ✅ S3 upload completed for version %s\n", versionID)
+	}
+
+	b.saveAgentSession(ctx, workspaceDir, appID, versionID)
+
+	// Update app status to active
+	_, err = b.AppService.UpdateApp(ctx, appID, "", map[string]interface{}{
+		"status": "active",
+	})
+	if err != nil {
+		log.Printf("[BuildApp] Warning: Failed to update app status: %v\n", err)
+	} else {
+		log.Printf("[BuildApp] ✅ App status updated to active for %s\n", appID)
+	}
+
+	// Cache the installed dependencies of the successful build
+	if b.DependencyCache != nil {
+		step := b.startStep(ctx, appID, versionID, stepDependencySave, 1)
+		err := b.DependencyCache.Save(ctx, appID, workspaceDir, step)
+		step.finish(ctx, err)
 		if err != nil {
-			log.Printf("[BuildApp] [Async] Warning: Failed to update app status: %v\n", err)
-		} else {
-			log.Printf("[BuildApp] [Async] ✅ App status updated to active for %s\n", appID)
+			log.Printf("[DepCache] Warning: Failed to cache dependencies for version %s: %v\n", versionID, err)
 		}
-	}()
+	}
+}
 
-	return nil
+// restoreDependencies restores node_modules from the dependency cache. A miss
+// or failure only means the build installs dependencies itself.
+func (b *Builder) restoreDependencies(ctx context.Context, workspaceDir, appID, versionID string) {
+	if b.DependencyCache == nil {
+		return
+	}
+
+	step := b.startStep(ctx, appID, versionID, stepDependencyRestore, 1)
+	hit, err := b.DependencyCache.Restore(ctx, appID, workspaceDir, step)
+	if err == nil && !hit {
+		fmt.Fprintln(step, "No cached dependencies for this package.json and lockfile")
+	}
+	step.finish(ctx, err)
+	if err != nil {
+		log.Printf("[DepCache] Warning: Failed to restore dependencies for version %s: %v\n", versionID, err)
+	} else if hit {
+		log.Printf("[DepCache] Restored dependencies for version %s\n", versionID)
+	}
 }
 
-func (b *Builder) setupWorkspace(ctx context.Context, workspaceDir, appID string) (bool, error) {
+// setupWorkspace restores the code a build starts from and returns the version
+// it came from, or nil for starter code
+func (b *Builder) setupWorkspace(ctx context.Context, workspaceDir, appID, versionID string, payload models.BuildJobPayload) (*models.Version, error) {
+	// Retries start from the same code as the version they retry
+	if payload.BaseVersionID != "" {
+		base, err := b.VersionService.GetVersion(ctx, payload.BaseVersionID)
+		if err != nil {
+			return nil, err
+		}
+		if base.S3CodePath == nil || *base.S3CodePath == "" {
+			return nil, fmt.Errorf("version %d has no stored code", base.VersionNumber)
+		}
+		return base, b.downloadFromS3(ctx, *base.S3CodePath, workspaceDir)
+	}
+
 	// Try to get the latest version's code from S3
 	versions, err := b.VersionService.ListVersions(ctx, appID)
 	if err != nil || len(versions) == 0 {
-		// No previous version, copy starter code
-		return true, b.copyStarterCode(workspaceDir)
+		// No previous version, install the app's starter
+		return nil, b.installStarter(ctx, workspaceDir, appID, versionID)
 	}
 
-	// Find the latest completed version
+	// Find the latest completed version (versions are listed newest first)
 	var latestVersion *models.Version
-	for i := len(versions) - 1; i >= 0; i-- {
+	for i := range versions {
 		if versions[i].Status == "completed" && versions[i].S3CodePath != nil && *versions[i].S3CodePath != "" {
 			latestVersion = &versions[i]
 			break
@@ -304,237 +493,116 @@ func (b *Builder) setupWorkspace(ctx context.Context, workspaceDir, appID string
 	}
 
 	if latestVersion == nil {
-		return true, b.copyStarterCode(workspaceDir)
+		return nil, b.installStarter(ctx, workspaceDir, appID, versionID)
 	}
 
 	// Download from S3 and extract
-	return false, b.downloadFromS3(ctx, *latestVersion.S3CodePath, workspaceDir)
-}
-
-func (b *Builder) copyStarterCode(workspaceDir string) error {
-	// Use rsync to exclude heavy directories like node_modules, .vercel, .agent-history
-	cmd := exec.Command("rsync", "-av",
-		"--exclude=node_modules",
-		"--exclude=.vercel",
-		"--exclude=.agent-history",
-		"--exclude=dist",
-		"--exclude=.git",
-		"--exclude=.next",
-		b.Config.StarterCodeDir+"/",
-		workspaceDir+"/",
-	)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to copy starter code: %w, output: %s", err, string(output))
-	}
-	return nil
+	return latestVersion, b.downloadFromS3(ctx, *latestVersion.S3CodePath, workspaceDir)
 }
 
-func (b *Builder) buildPrompt(appID, requirements string, comments []models.Comment) string {
-	var sb strings.Builder
-
-	// Add app ID for configuration
-	sb.WriteString("## App Configuration\n")
-	sb.WriteString(fmt.Sprintf("App ID: %s\n", appID))
-	sb.WriteString("IMPORTANT: Configure the RapidBuildProvider with this appId in src/App.jsx:\n")
-	sb.WriteString(fmt.Sprintf("<RapidBuildProvider appId=\"%s\">\n\n", appID))
-
-	if requirements != "" {
-		sb.WriteString("## Requirements\n")
-		sb.WriteString(requirements)
-		sb.WriteString("\n\n")
-	}
+// starterWait bounds how long the first build of a new app waits for the
+// starter inferred from the app's category
+const starterWait = 30 * time.Second
 
-	if len(comments) > 0 {
-		sb.WriteString("## User Comments\n")
-		for _, comment := range comments {
-			sb.WriteString(fmt.Sprintf("Page: %s\n", comment.PagePath))
-			sb.WriteString(fmt.Sprintf("Element: %s\n", comment.ElementPath))
-			sb.WriteString(fmt.Sprintf("Comment: %s\n\n", comment.Content))
-		}
+// installStarter installs the app's starter template into the workspace and
+// records the installed starter revision on the version
+func (b *Builder) installStarter(ctx context.Context, workspaceDir, appID, versionID string) error {
+	starter, err := b.StarterService.GetStarter(ctx, b.starterRef(ctx, appID))
+	if err != nil {
+		return err
 	}
-
-	return sb.String()
-}
-
-func (b *Builder) runClaude(ctx context.Context, workspaceDir, prompt, versionID string) error {
-	// Create context with timeout (6 hours for build)
-	claudeCtx, cancel := context.WithTimeout(ctx, 360*time.Minute)
-	defer cancel()
-
-	// Get Claude CLI path
-	claudePath := findClaudePath()
-
-	// Build command with proper shell execution
-	// Using bash -c to handle complex prompts
-	cmd := exec.CommandContext(claudeCtx, "bash", "-c", fmt.Sprintf(
-		"cd %s && %s -p --dangerously-skip-permissions %q",
-		workspaceDir,
-		claudePath,
-		prompt,
-	))
-
-	// Set environment variables for PATH
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("CLAUDE_CLI_PATH=%s", claudePath),
-		"PATH=/home/ubuntu/.local/bin:/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/bin:/usr/local/bin:/sbin:/bin",
-	)
-
-	// Capture output separately
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Execute command
-	err := cmd.Run()
-
-	// Combine output for logging
-	combinedOutput := stdout.String()
-	if stderr.Len() > 0 {
-		combinedOutput += "\n--- STDERR ---\n" + stderr.String()
-	}
-
-	// Update build log in database
-	b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
-		"build_log": combinedOutput,
-	})
-
+	installed, err := b.StarterService.Install(ctx, starter, workspaceDir)
 	if err != nil {
-		// Check if context was cancelled
-		if claudeCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("Claude execution timed out after 6 hours")
-		}
-
-		// Extract meaningful error message
-		errorMsg := stderr.String()
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
-
-		return fmt.Errorf("Claude execution failed: %s", strings.TrimSpace(errorMsg))
+		return err
 	}
+	log.Printf("[Starter] Installed starter %s (%s) for version %s\n", starter.Ref(), installed.Hash, versionID)
 
+	if _, err := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{"starter": installed}); err != nil {
+		log.Printf("[Starter] Warning: Failed to record starter of version %s: %v\n", versionID, err)
+	}
 	return nil
 }
 
-// buildForVercel runs vercel build to create the prebuilt output
-func (b *Builder) buildForVercel(ctx context.Context, workspaceDir, versionID string, attempt int) error {
-	// Create context with timeout (10 minutes for build)
-	buildCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
-
-	log.Printf("[Vercel Build] Building project for version %s (attempt %d/3)\n", versionID, attempt)
-
-	cmd := exec.CommandContext(buildCtx, "bash", "-c", fmt.Sprintf(
-		"cd %s && vercel build --target=preview -y",
-		workspaceDir,
-	))
-
-	cmd.Env = append(os.Environ(),
-		"PATH=/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/bin:/usr/local/bin:/sbin:/bin",
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-
-	// Combine output for logging
-	combinedOutput := stdout.String()
-	if stderr.Len() > 0 {
-		combinedOutput += "\n--- BUILD ERRORS ---\n" + stderr.String()
+// starterRef returns the app's starter. The starter of a new app is inferred
+// from the category extracted after the app is created, so the first build
+// waits briefly for it before pinning DEFAULT_STARTER.
+func (b *Builder) starterRef(ctx context.Context, appID string) string {
+	if b.AppService == nil {
+		return b.Config.DefaultStarter
 	}
 
-	if err != nil {
-		if buildCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("Vercel build timed out after 10 minutes")
+	deadline := time.Now().Add(starterWait)
+	for {
+		app, err := b.AppService.GetAppByID(ctx, appID)
+		if err != nil {
+			log.Printf("[Starter] Warning: Failed to get app %s, using starter %s: %v\n", appID, b.Config.DefaultStarter, err)
+			return b.Config.DefaultStarter
+		}
+		if app.StarterTemplate != nil && *app.StarterTemplate != "" {
+			return *app.StarterTemplate
+		}
+		if time.Now().After(deadline) || time.Since(app.CreatedAt) > starterWait {
+			break
 		}
 
-		// Return detailed error with full output
-		errorMsg := strings.TrimSpace(combinedOutput)
-		if errorMsg == "" {
-			errorMsg = err.Error()
+		select {
+		case <-ctx.Done():
+			return b.Config.DefaultStarter
+		case <-time.After(2 * time.Second):
 		}
-		return fmt.Errorf("%s", errorMsg)
 	}
 
-	log.Printf("[Vercel Build] Build successful for version %s\n", versionID)
-	return nil
+	// Pin the default so a late category inference does not swap the starter under built code
+	if picked, err := b.AppService.SetStarterTemplate(ctx, appID, b.Config.DefaultStarter); err != nil {
+		log.Printf("[Starter] Warning: Failed to set starter of app %s: %v\n", appID, err)
+	} else if !picked {
+		if app, err := b.AppService.GetAppByID(ctx, appID); err == nil && app.StarterTemplate != nil {
+			return *app.StarterTemplate
+		}
+	}
+	return b.Config.DefaultStarter
 }
 
-// fixBuildErrors runs Claude to fix build errors
-func (b *Builder) fixBuildErrors(ctx context.Context, workspaceDir, versionID string, buildError string, attempt int) error {
-	log.Printf("[Claude Fix] Asking Claude to fix build errors (attempt %d/3)\n", attempt)
-
-	// Create context with timeout (6 hours for fix, same as initial build)
-	claudeCtx, cancel := context.WithTimeout(ctx, 360*time.Minute)
-	defer cancel()
+// buildPrompt renders the code generation prompt with the app's template
+func (b *Builder) buildPrompt(prompts *promptSettings, appID, requirements string, comments []models.Comment, files []services.PromptFile) (string, error) {
+	return prompts.template.RenderGenerate(services.GeneratePromptData{
+		AppID:              appID,
+		Requirements:       requirements,
+		CustomInstructions: prompts.customInstructions,
+		Comments:           comments,
+		Files:              files,
+	})
+}
 
-	// Get Claude CLI path
-	claudePath := findClaudePath()
+// fixBuildErrors asks the code generator to fix build errors
+func (b *Builder) fixBuildErrors(ctx context.Context, generator CodeGenerator, prompts *promptSettings, workspaceDir, appID, versionID string, buildError string, attempt int, policy models.BuildPolicy) error {
+	log.Printf("[CodeGen] Asking %s to fix build errors (attempt %d/%d)\n", generator.Name(), attempt, policy.MaxAttempts)
 
 	// Build error fix prompt
-	fixPrompt := fmt.Sprintf(`BUILD FAILED (Attempt %d/3):
-
-%s
-
-Please analyze the errors above and fix them. Focus on:
-- Syntax errors
-- Type errors
-- Import/export issues
-- Missing dependencies
-- Build configuration issues
-
-Fix the issues directly in the code.`, attempt, buildError)
-
-	// Build command
-	cmd := exec.CommandContext(claudeCtx, "bash", "-c", fmt.Sprintf(
-		"cd %s && %s -c -p --dangerously-skip-permissions %q",
-		workspaceDir,
-		claudePath,
-		fixPrompt,
-	))
-
-	// Set environment variables for PATH
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("CLAUDE_CLI_PATH=%s", claudePath),
-		"PATH=/home/ubuntu/.local/bin:/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/bin:/usr/local/bin:/sbin:/bin",
-	)
-
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Execute command
-	err := cmd.Run()
-
-	// Combine output for logging
-	combinedOutput := stdout.String()
-	if stderr.Len() > 0 {
-		combinedOutput += "\n--- STDERR ---\n" + stderr.String()
-	}
-
-	// Append fix attempt to build log
-	b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
-		"build_log": combinedOutput,
+	fixPrompt, err := prompts.template.RenderFix(services.FixPromptData{
+		Attempt:            attempt,
+		MaxAttempts:        policy.MaxAttempts,
+		Errors:             buildError,
+		CustomInstructions: prompts.customInstructions,
 	})
-
 	if err != nil {
-		if claudeCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("Claude fix timed out after 6 hours")
-		}
-
-		errorMsg := stderr.String()
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
+		return withFailureCategory(failureConfig, err)
+	}
 
-		return fmt.Errorf("Claude failed to fix errors: %s", strings.TrimSpace(errorMsg))
+	step := b.startStep(ctx, appID, versionID, stepFix, attempt)
+	var result *GenerationResult
+	err = withStageTimeout(ctx, "Fixing build errors", policy.AgentTimeoutMinutes, func(ctx context.Context) error {
+		var err error
+		result, err = generator.Fix(ctx, workspaceDir, fixPrompt, step)
+		return err
+	})
+	step.finish(ctx, err)
+	b.recordUsage(ctx, generator, appID, versionID, services.UsageFix, attempt, result)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("[Claude Fix] Claude completed fix attempt %d\n", attempt)
+	log.Printf("[CodeGen] %s completed fix attempt %d (%d files changed)\n", generator.Name(), attempt, len(result.FilesChanged))
 	return nil
 }
 
@@ -560,6 +628,7 @@ func (b *Builder) packageCode(workspaceDir string) (string, error) {
 		"dist":           true,
 		".git":           true,
 		".next":          true,
+		requirementsDir:  true, // Uploaded requirement files are downloaded again for each build
 	}
 
 	// Walk the workspace and add files to tar
@@ -685,205 +754,24 @@ func (b *Builder) cleanup(workspaceDir string) {
 	os.Remove(workspaceDir + ".tar.gz")
 }
 
-// getVercelProjectID reads the project ID from .vercel/project.json
-func (b *Builder) getVercelProjectID(workspaceDir string) (string, error) {
-	projectFile := filepath.Join(workspaceDir, ".vercel", "project.json")
-	data, err := os.ReadFile(projectFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to read project.json: %w", err)
-	}
-
-	var projectData struct {
-		ProjectID string `json:"projectId"`
-	}
-	if err := json.Unmarshal(data, &projectData); err != nil {
-		return "", fmt.Errorf("failed to parse project.json: %w", err)
-	}
-
-	return projectData.ProjectID, nil
-}
-
-// linkVercel links the workspace to a Vercel project and returns the project ID
-func (b *Builder) linkVercel(ctx context.Context, workspaceDir, versionID string) (string, error) {
-	// Create context with timeout (2 minutes for link)
-	linkCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-	defer cancel()
-
-	log.Printf("[Vercel] Linking project for version %s\n", versionID)
-
-	cmd := exec.CommandContext(linkCtx, "bash", "-c", fmt.Sprintf(
-		"cd %s && vercel link -y",
-		workspaceDir,
-	))
-
-	cmd.Env = append(os.Environ(),
-		"PATH=/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/bin:/usr/local/bin:/sbin:/bin",
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if linkCtx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("Vercel link timed out after 2 minutes")
-		}
-		errorMsg := stderr.String()
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
-		return "", fmt.Errorf("Vercel link failed: %s", strings.TrimSpace(errorMsg))
-	}
-
-	log.Printf("[Vercel] Link output: %s\n", stdout.String())
-
-	// Read the project ID from .vercel/project.json
-	projectID, err := b.getVercelProjectID(workspaceDir)
-	if err != nil {
-		log.Printf("[Vercel] Warning: Could not read project ID: %v\n", err)
-		return "", nil
-	}
-
-	log.Printf("[Vercel] Project ID: %s\n", projectID)
-	return projectID, nil
+func (b *Builder) sendProgress(versionID, status, message string) {
+	b.publishProgress(models.BuildProgress{
+		VersionID: versionID,
+		Status:    status,
+		Message:   message,
+		Timestamp: time.Now(),
+	})
 }
 
-// deployToVercel deploys the pre-built workspace to Vercel
-func (b *Builder) deployToVercel(ctx context.Context, workspaceDir, appID, versionID string) (string, string, error) {
-	// Create context with timeout (10 minutes for deployment)
-	deployCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
-
-	// Set environment variables for PATH
-	envVars := append(os.Environ(),
-		"PATH=/home/ubuntu/.nvm/versions/node/v22.16.0/bin:/usr/bin:/usr/local/bin:/sbin:/bin",
-	)
-
-	// Deploy to Vercel with --prebuilt flag (workspace is already built by Claude)
-	log.Printf("[Vercel] Deploying version %s\n", versionID)
-	cmd := exec.CommandContext(deployCtx, "bash", "-c", fmt.Sprintf(
-		"cd %s && vercel --yes --prebuilt --target=preview",
-		workspaceDir,
-	))
-	cmd.Env = envVars
-
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Execute deployment
-	err := cmd.Run()
-
-	if err != nil {
-		// Check if context was cancelled
-		if deployCtx.Err() == context.DeadlineExceeded {
-			return "", "", fmt.Errorf("Vercel deployment timed out after 10 minutes")
-		}
-
-		// Extract error message
-		errorMsg := stderr.String()
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
-		return "", "", fmt.Errorf("Vercel deployment failed: %s", strings.TrimSpace(errorMsg))
-	}
-
-	// Parse deployment URL and deployment ID from CLI output
-	// Vercel CLI outputs:
-	//   Inspect: https://vercel.com/.../PROJECT_ID/DEPLOYMENT_ID [time]
-	//   Preview: https://PROJECT-HASH.vercel.app [time]
-	output := stdout.String()
-	outputLines := strings.Split(output, "\n")
-
-	deploymentURL := ""
-	deploymentID := ""
-
-	for _, line := range outputLines {
-		// Parse Inspect URL to get deployment ID
-		if strings.Contains(line, "Inspect:") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Inspect:" && i+1 < len(parts) {
-					inspectURL := parts[i+1]
-					// Deployment ID is the last segment of the Inspect URL
-					urlParts := strings.Split(inspectURL, "/")
-					if len(urlParts) > 0 {
-						deploymentID = urlParts[len(urlParts)-1]
-					}
-					break
-				}
-			}
-		}
-
-		// Parse Preview URL
-		if strings.Contains(line, "Preview:") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Preview:" && i+1 < len(parts) {
-					deploymentURL = strings.TrimSpace(parts[i+1])
-					break
-				}
-			}
-		}
-	}
-
-	// Fallback: try to parse deployment URL from bare URL lines if Preview not found
-	if deploymentURL == "" {
-		for _, line := range outputLines {
-			if strings.Contains(line, "https://") && strings.Contains(line, "vercel.app") {
-				// Extract URL from the line, handling cases like "...vercel.appQueued"
-				parts := strings.Fields(line)
-				for _, part := range parts {
-					if strings.HasPrefix(part, "https://") && strings.Contains(part, "vercel.app") {
-						// Split at ".app" to handle appended status
-						if idx := strings.Index(part, ".app"); idx != -1 {
-							deploymentURL = strings.TrimSpace(part[:idx+4])
-							break
-						}
-					}
-				}
-				if deploymentURL != "" {
-					break
-				}
-			}
-		}
-	}
-
-	// Final fallback: generate URL from workspace directory
-	if deploymentURL == "" {
-		folderName := filepath.Base(workspaceDir)
-		deploymentURL = fmt.Sprintf("https://%s.vercel.app", folderName)
-		log.Printf("[Vercel] Could not parse URL from output, using fallback: %s\n", deploymentURL)
-	}
-
-	// Fallback for deployment ID: use versionID if parsing failed
-	if deploymentID == "" {
-		log.Printf("[Vercel] Warning: Could not parse deployment ID from output, using versionID as fallback\n")
-		deploymentID = versionID
-	} else {
-		log.Printf("[Vercel] Parsed deployment ID from CLI output: %s\n", deploymentID)
-	}
-
-	log.Printf("[Vercel] Deployment successful: %s\n", deploymentURL)
-
-	return deploymentURL, deploymentID, nil
-}
+func (b *Builder) publishProgress(progress models.BuildProgress) {
+	versionID := progress.VersionID
 
-func (b *Builder) sendProgress(versionID, status, message string) {
 	// Check if Redis is configured
 	if b.RedisClient == nil {
 		log.Printf("[Redis] Warning: RedisClient is nil, cannot send progress for version %s\n", versionID)
 		return
 	}
 
-	progress := models.BuildProgress{
-		VersionID: versionID,
-		Status:    status,
-		Message:   message,
-		Timestamp: time.Now(),
-	}
-
 	// Publish to Redis channel for this version
 	data, err := json.Marshal(progress)
 	if err != nil {
@@ -898,15 +786,71 @@ func (b *Builder) sendProgress(versionID, status, message string) {
 	}
 }
 
-func (b *Builder) handleError(ctx context.Context, versionID, message string, err error) error {
+// handleGeneratedCodeError stores the workspace of a build that failed after
+// code generation as the version's code, so it can be retried without
+// generating it again, then marks the version failed
+func (b *Builder) handleGeneratedCodeError(ctx context.Context, workspaceDir, appID, versionID, stage, message string, err error) error {
+	if ctx.Err() == nil {
+		b.storeFailedCode(ctx, workspaceDir, appID, versionID)
+	}
+	return b.handleError(ctx, versionID, stage, message, err)
+}
+
+// storeFailedCode packages and uploads the workspace of a failed build.
+// Only completed versions are used as the base of later builds.
+func (b *Builder) storeFailedCode(ctx context.Context, workspaceDir, appID, versionID string) {
+	step := b.startStep(ctx, appID, versionID, stepPackage, 1)
+	tarPath, err := b.packageCode(workspaceDir)
+	var s3Path string
+	if err == nil {
+		s3Path, err = b.uploadToS3(ctx, tarPath, appID, versionID)
+	}
+	if err == nil {
+		fmt.Fprintf(step, "Uploaded %s to %s\n", filepath.Base(tarPath), s3Path)
+		_, err = b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+			"s3_code_path": s3Path,
+		})
+	}
+	step.finish(ctx, err)
+	if err != nil {
+		log.Printf("[BuildApp] Warning: Failed to store code of failed version %s: %v\n", versionID, err)
+		return
+	}
+
+	// Retries of this version resume the session that produced the code
+	b.saveAgentSession(ctx, workspaceDir, appID, versionID)
+}
+
+// handleError marks the version failed in stage, with err classified for clients
+func (b *Builder) handleError(ctx context.Context, versionID, stage, message string, err error) error {
+	// A cancelled build context means the user asked to stop this build, or
+	// that another worker took it over and now records its outcome
+	if errors.Is(ctx.Err(), context.Canceled) {
+		if cause := context.Cause(ctx); errors.Is(cause, services.ErrLeaseLost) {
+			return fmt.Errorf("build for version %s stopped: %w", versionID, cause)
+		}
+		return b.markCancelled(versionID)
+	}
+
+	// Persist the failure even if the build context is already done
+	ctx = context.WithoutCancel(ctx)
+
+	failure := classifyFailure(stage, err)
 	fullMsg := fmt.Sprintf("%s: %v", message, err)
-	log.Printf("[BuildApp] ERROR for version %s: %s\n", versionID, fullMsg)
-	b.sendProgress(versionID, "failed", fullMsg)
+	log.Printf("[BuildApp] ERROR for version %s (%s/%s): %s\n", versionID, failure.Stage, failure.Category, fullMsg)
+	b.publishProgress(models.BuildProgress{
+		VersionID: versionID,
+		Status:    "failed",
+		Message:   fullMsg,
+		Failure:   failure,
+		Timestamp: time.Now(),
+	})
 
 	errMsg := err.Error()
 	_, updateErr := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
 		"status":        "failed",
 		"error_message": &errMsg,
+		"failure":       failure,
 	})
 	if updateErr != nil {
 		log.Printf("[BuildApp] Failed to update version with error: %v\n", updateErr)
@@ -924,53 +868,44 @@ func (b *Builder) handleError(ctx context.Context, versionID, message string, er
 		}
 	}
 
-	return fmt.Errorf(fullMsg)
+	return errors.New(fullMsg)
 }
 
-// setupDatabase updates database schemas using app-manager CLI
-// Note: App already exists in MongoDB (created in CreateApp), this only updates schemas
-func (b *Builder) setupDatabase(ctx context.Context, schemasDir, appID, ownerEmail string, app *models.App) error {
+// setupDatabase applies the schemas in schemasDir to the app's database. The
+// app is created in MongoDB first (idempotently) in case the setup that runs
+// when the app is created failed.
+func (b *Builder) setupDatabase(ctx context.Context, schemasDir, appID, ownerEmail string, app *models.App, output io.Writer) error {
 	log.Printf("[Database] Updating schemas for app %s with schemas from %s\n", appID, schemasDir)
 
-	// Create context with timeout (2 minutes for database setup)
-	dbCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-	defer cancel()
-
-	// Use schemas command to update only schemas (app already exists from CreateApp)
-	args := []string{"schemas", appID, "--dir", schemasDir}
-
-	// Run app-manager schemas command
-	// This only updates collection schemas, app already exists
-	cmd := exec.CommandContext(dbCtx, "app-manager", args...)
-
-	// Set environment variables (include pnpm path where app-manager is installed)
-	cmd.Env = append(os.Environ(),
-		"PATH=/home/ubuntu/.local/share/pnpm:/usr/local/bin:/usr/bin:/bin",
-	)
-
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Execute command
-	err := cmd.Run()
-
-	// Log output
-	if stdout.Len() > 0 {
-		log.Printf("[Database] Output: %s\n", stdout.String())
+	schemas, err := appmanager.LoadSchemas(schemasDir)
+	if err != nil {
+		return err
+	}
+	if len(schemas) == 0 {
+		fmt.Fprintf(output, "No schemas in %s\n", schemasDir)
+		return nil
 	}
 
-	if err != nil {
-		if dbCtx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("database setup timed out after 2 minutes")
+	if app != nil && ownerEmail != "" {
+		if _, err := b.AppManager.CreateApp(ctx, appID, app.Name, ownerEmail); err != nil {
+			return err
 		}
-
-		errorMsg := stderr.String()
-		if errorMsg == "" {
-			errorMsg = err.Error()
+		if app.Logo != nil {
+			if _, err := b.AppManager.UpdateApp(ctx, appID, appmanager.AppUpdate{Logo: app.Logo}); err != nil {
+				return err
+			}
 		}
-		return fmt.Errorf("app-manager failed: %s", strings.TrimSpace(errorMsg))
+	}
+
+	result, err := b.AppManager.ApplySchemas(ctx, appID, schemas)
+	if err != nil {
+		return err
+	}
+	if len(result.Created) > 0 {
+		fmt.Fprintf(output, "Created collections: %s\n", strings.Join(result.Created, ", "))
+	}
+	if len(result.Updated) > 0 {
+		fmt.Fprintf(output, "Updated collections: %s\n", strings.Join(result.Updated, ", "))
 	}
 
 	log.Printf("[Database] ✅ Database setup completed for app %s\n", appID)
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/appmanager"
+	"github.com/rapidbuildapp/rapidbuild/internal/db"
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// testStarter has no dependencies, so npm install works offline. Its build
+// writes a page with a mount point and a script, which the smoke check loads.
+var testStarter = map[string]string{
+	"package.json": `{"name":"test-starter","version":"1.0.0","private":true,"scripts":{"build":"node build.js"}}`,
+	"build.js": `const fs = require("fs");
+fs.mkdirSync("dist/assets", { recursive: true });
+fs.writeFileSync("dist/index.html", '<html><body><div id="root"></div><script src="/assets/app.js"></script></body></html>');
+fs.writeFileSync("dist/assets/app.js", "document.getElementById('root').textContent = 'ok';");
+`,
+}
+
+// TestBuildAppWithFakeGenerator runs a whole build with the fake generator and
+// the local deployer. It needs a Postgres database with config/neon_schema.sql
+// and the migrations applied in TEST_DATABASE_URL, and npm on the PATH. S3
+// points at a closed port; packaging the code only logs warnings then.
+func TestBuildAppWithFakeGenerator(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	if _, err := exec.LookPath("npm"); err != nil {
+		t.Skip("npm is not installed")
+	}
+	ctx := context.Background()
+
+	starterDir := t.TempDir()
+	writeFiles(t, starterDir, testStarter)
+
+	cfg := config.Load()
+	cfg.DatabaseURL = databaseURL
+	cfg.WorkspaceDir = t.TempDir()
+	cfg.StarterCodeDir = starterDir
+	cfg.StarterTemplatesDir = ""
+	cfg.StarterTemplatesS3Prefix = ""
+	cfg.DefaultStarter = "react"
+	cfg.CodeGenerator = "claude" // The app selects the fake generator
+	cfg.Deployer = "local"
+	cfg.LocalDeployDir = t.TempDir()
+	cfg.LocalDeployBaseURL = "http://localhost:8092/deployments"
+	cfg.VerifyChecks = []string{checkSmoke}
+	cfg.SecurityScan = true
+
+	dbClient, err := db.NewPostgresClient(cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", databaseURL, err)
+	}
+	defer dbClient.Close()
+
+	userID, appID := uuid.New().String(), uuid.New().String()
+	if _, err := dbClient.Exec(ctx, `INSERT INTO users (id, email) VALUES ($1, $2)`, userID, userID+"@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbClient.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID)
+	})
+	if _, err := dbClient.Exec(ctx, `INSERT INTO apps (id, user_id, name, status, code_generator, starter_template) VALUES ($1, $2, 'FakeApp', 'building', 'fake', 'react')`, appID, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	s3Client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String("http://127.0.0.1:1"),
+		Credentials:      aws.AnonymousCredentials{},
+		UsePathStyle:     true,
+		RetryMaxAttempts: 1,
+	})
+	buildExecutor := executor.NewDirect(append(os.Environ(), "npm_config_audit=false", "npm_config_fund=false", "npm_config_update_notifier=false"))
+	deployer := services.NewLocalDeployer(cfg.LocalDeployDir, cfg.LocalDeployBaseURL, buildExecutor)
+	starterService := services.NewStarterService(cfg, s3Client)
+	appManager := appmanager.NewMemoryManager()
+	appService := services.NewAppService(dbClient, appManager, nil, nil, nil, starterService, s3Client, cfg)
+	versionService := services.NewVersionService(dbClient, deployer)
+	buildStepService := services.NewBuildStepService(dbClient)
+
+	builder, err := NewBuilder(cfg, appService, appManager, versionService, deployer, buildExecutor,
+		buildStepService, services.NewBuildLogService(s3Client, cfg), nil,
+		services.NewBuildPolicyService(dbClient), nil, services.NewPromptTemplateService(dbClient, cfg),
+		starterService, services.NewUsageService(dbClient), services.NewJobService(dbClient),
+		services.NewWorkerService(dbClient), s3Client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requirements := "A page that says ok"
+	version, err := versionService.CreateVersion(ctx, appID, &requirements, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.BuildApp(ctx, version.ID, appID, models.BuildJobPayload{Requirements: requirements}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	built, err := versionService.GetVersion(ctx, version.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.Status != "completed" {
+		t.Fatalf("status = %s, want completed (failure: %+v)", built.Status, built.Failure)
+	}
+	if built.VercelURL == nil || !strings.HasPrefix(*built.VercelURL, cfg.LocalDeployBaseURL) {
+		t.Errorf("deployment URL = %v, want one under %s", built.VercelURL, cfg.LocalDeployBaseURL)
+	}
+	if built.Starter == nil || built.Starter.Source != "builtin" || built.Starter.Hash == "" {
+		t.Errorf("starter = %+v, want the built-in starter with its hash", built.Starter)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LocalDeployDir, "deployments", version.ID, "index.html")); err != nil {
+		t.Errorf("deployment has no index.html: %v", err)
+	}
+
+	steps, err := buildStepService.ListSteps(ctx, version.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]string)
+	for _, step := range steps {
+		status[step.Name] = step.Status
+	}
+	for _, name := range []string{stepWorkspaceSetup, stepLink, stepCodeGeneration, stepBuild, stepVerify, stepSecurityScan, stepDeploy} {
+		if status[name] != "succeeded" {
+			t.Errorf("step %s is %q, want succeeded", name, status[name])
+		}
+	}
+}
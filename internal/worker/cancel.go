@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// cancelChannel carries version IDs of running builds that should be stopped
+const cancelChannel = "build:cancel"
+
+// errBuildCancelled is returned by BuildApp when the user cancelled the build
+var errBuildCancelled = errors.New("build cancelled")
+
+// CancelBuild cancels the active build of a version. A queued build is
+// cancelled right away; a running build is flagged in the queue and its worker
+// is signalled over Redis so the build subprocesses are killed promptly. If the
+// signal is missed, the worker still sees the flag on its next heartbeat.
+func (b *Builder) CancelBuild(ctx context.Context, versionID string) (*models.BuildJob, error) {
+	job, err := b.JobService.RequestCancel(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status == "cancelled" {
+		// Never started, so no worker will report the cancellation
+		b.markCancelled(versionID)
+		return job, nil
+	}
+
+	if b.RedisClient != nil {
+		if err := b.RedisClient.Publish(ctx, cancelChannel, versionID).Err(); err != nil {
+			log.Printf("[Redis] Failed to publish cancellation for version %s: %v\n", versionID, err)
+		}
+	}
+
+	return job, nil
+}
+
+// listenForCancellations cancels builds on this worker as cancellation signals arrive
+func (b *Builder) listenForCancellations(ctx context.Context) {
+	if b.RedisClient == nil {
+		return
+	}
+
+	pubsub := b.RedisClient.Subscribe(ctx, cancelChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			b.cancelActiveBuild(msg.Payload)
+		}
+	}
+}
+
+// trackBuild registers the cancel function of a build running on this worker
+func (b *Builder) trackBuild(versionID string, cancel context.CancelFunc) {
+	b.activeMu.Lock()
+	defer b.activeMu.Unlock()
+	b.activeBuilds[versionID] = cancel
+}
+
+func (b *Builder) untrackBuild(versionID string) {
+	b.activeMu.Lock()
+	defer b.activeMu.Unlock()
+	delete(b.activeBuilds, versionID)
+}
+
+// cancelActiveBuild cancels a build if it runs on this worker
+func (b *Builder) cancelActiveBuild(versionID string) {
+	b.activeMu.Lock()
+	cancel, ok := b.activeBuilds[versionID]
+	b.activeMu.Unlock()
+
+	if ok {
+		log.Printf("[Worker] Cancelling build for version %s\n", versionID)
+		cancel()
+	}
+}
+
+// markCancelled records a cancelled build and emits the final SSE event
+func (b *Builder) markCancelled(versionID string) error {
+	ctx := context.Background()
+
+	log.Printf("[BuildApp] Build cancelled for version %s\n", versionID)
+	b.sendProgress(versionID, "cancelled", "Build cancelled")
+
+	_, err := b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+		"status": "cancelled",
+	})
+	if err != nil {
+		log.Printf("[BuildApp] Failed to mark version %s cancelled: %v\n", versionID, err)
+	}
+
+	version, err := b.VersionService.GetVersion(ctx, versionID)
+	if err == nil {
+		b.updateAppStatusAfterCancel(ctx, version.AppID)
+	}
+
+	return fmt.Errorf("%w for version %s", errBuildCancelled, versionID)
+}
+
+// updateAppStatusAfterCancel leaves the app active if an earlier version is still usable
+func (b *Builder) updateAppStatusAfterCancel(ctx context.Context, appID string) {
+	status := "draft"
+	versions, err := b.VersionService.ListVersions(ctx, appID)
+	if err == nil {
+		for _, v := range versions {
+			if v.Status == "completed" {
+				status = "active"
+				break
+			}
+		}
+	}
+
+	if _, err := b.AppService.UpdateApp(ctx, appID, "", map[string]interface{}{
+		"status": status,
+	}); err != nil {
+		log.Printf("[BuildApp] Warning: Failed to update app status: %v\n", err)
+	}
+}
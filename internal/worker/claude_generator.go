@@ -0,0 +1,279 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// ClaudeGenerator runs the Claude Code CLI in non-interactive mode. It asks for
+// stream-json output so progress can be shown while the agent works, and
+// renders the events into a readable transcript.
+type ClaudeGenerator struct {
+	Executor executor.Executor
+}
+
+func NewClaudeGenerator(exec executor.Executor) *ClaudeGenerator {
+	return &ClaudeGenerator{
+		Executor: exec,
+	}
+}
+
+func (g *ClaudeGenerator) Name() string {
+	return "claude"
+}
+
+// Generate resumes the session restored into the workspace's agent history
+// (the session of the version the code comes from), or starts a fresh one
+func (g *ClaudeGenerator) Generate(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	result, err := g.runResuming(ctx, workspaceDir, prompt, claudeRun{}, output)
+	if err != nil {
+		return result, fmt.Errorf("Claude execution failed: %w", err)
+	}
+	return result, nil
+}
+
+// Plan runs the agent with read-only tools in the session Generate would resume
+func (g *ClaudeGenerator) Plan(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	result, err := g.runResuming(ctx, workspaceDir, prompt, claudeRun{readOnly: true}, output)
+	if err != nil {
+		return result, fmt.Errorf("Claude planning failed: %w", err)
+	}
+	return result, nil
+}
+
+// Fix continues the session of the last Generate/Fix run in the workspace
+func (g *ClaudeGenerator) Fix(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	result, err := g.run(ctx, workspaceDir, prompt, claudeRun{continueSession: true}, output)
+	if err != nil {
+		return result, fmt.Errorf("Claude failed to fix errors: %w", err)
+	}
+	return result, nil
+}
+
+// claudeRun selects how a run starts and what the agent may do
+type claudeRun struct {
+	continueSession bool // Continue the last run in the workspace when no session is stored
+	readOnly        bool // Only allow tools that read the workspace
+}
+
+// Tools of read-only runs. Other tools are denied since the run does not skip permission prompts.
+const (
+	claudeReadOnlyTools   = "Read,Glob,Grep,LS"
+	claudeDisallowedTools = "Bash,Edit,MultiEdit,Write,NotebookEdit"
+)
+
+// runResuming resumes the workspace's stored session, or starts a fresh one
+// when it cannot be resumed (e.g. written by an incompatible CLI version)
+func (g *ClaudeGenerator) runResuming(ctx context.Context, workspaceDir, prompt string, mode claudeRun, output io.Writer) (*GenerationResult, error) {
+	result, err := g.run(ctx, workspaceDir, prompt, mode, output)
+	if err != nil && ctx.Err() == nil && result != nil && result.Usage.Turns == 0 && readClaudeSessionID(workspaceDir) != "" {
+		fmt.Fprintf(generatorOutput(output), "Could not resume the previous agent session, starting a new one: %v\n", err)
+		os.RemoveAll(filepath.Join(workspaceDir, claudeSessionDir))
+		result, err = g.run(ctx, workspaceDir, prompt, mode, output)
+	}
+	return result, err
+}
+
+func (g *ClaudeGenerator) run(ctx context.Context, workspaceDir, prompt string, mode claudeRun, output io.Writer) (*GenerationResult, error) {
+	// Get Claude CLI path
+	claudePath := findClaudePath()
+
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	if mode.readOnly {
+		args = append(args, "--allowedTools", claudeReadOnlyTools, "--disallowedTools", claudeDisallowedTools)
+	} else {
+		args = append(args, "--dangerously-skip-permissions")
+	}
+	if sessionID := importClaudeSession(workspaceDir); sessionID != "" {
+		args = append([]string{"--resume", sessionID}, args...)
+	} else if mode.continueSession {
+		args = append([]string{"-c"}, args...)
+	}
+
+	// Render stream-json events as they arrive; keep stderr separately
+	stream := newClaudeStream(generatorOutput(output))
+	var stderr bytes.Buffer
+
+	before := snapshotWorkspace(workspaceDir)
+	start := time.Now()
+
+	// Only the agent gets the model API key and its config directories; the
+	// build, tests and deploys of the generated code do not
+	env := []string{"CLAUDE_CLI_PATH=" + claudePath}
+	if key, ok := os.LookupEnv("ANTHROPIC_API_KEY"); ok {
+		env = append(env, "ANTHROPIC_API_KEY="+key)
+	}
+
+	// The prompt contains user input, so it goes over stdin rather than argv or a shell
+	err := g.Executor.Run(ctx, executor.Command{
+		Name:   claudePath,
+		Args:   args,
+		Dir:    workspaceDir,
+		Env:    env,
+		Access: executor.AccessAgent,
+		Stdin:  strings.NewReader(prompt),
+		Stdout: stream,
+		Stderr: io.MultiWriter(&stderr, generatorOutput(output)),
+	})
+	stream.Flush()
+
+	// Keep the session with the workspace so fixes and later versions resume it
+	if sessionID := stream.SessionID(); sessionID != "" {
+		if exportErr := exportClaudeSession(workspaceDir, sessionID); exportErr != nil {
+			log.Printf("[CodeGen] Warning: Failed to keep Claude session %s: %v\n", sessionID, exportErr)
+		}
+	}
+
+	result := &GenerationResult{
+		FilesChanged: changedFiles(before, snapshotWorkspace(workspaceDir)),
+		Transcript:   formatTranscript(stream.Transcript(), stderr.String()),
+		Usage:        stream.Usage(),
+	}
+	result.Usage.Duration = time.Since(start)
+	if final := stream.Result(); final != nil {
+		result.Message = final.Result
+	}
+
+	if err != nil {
+		// The build was cancelled or the agent ran out of time
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		// Extract meaningful error message
+		errorMsg := stderr.String()
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+
+		return result, &utils.CommandError{Message: strings.TrimSpace(errorMsg), Err: err}
+	}
+
+	// The CLI can exit 0 with an error result (e.g. max turns reached)
+	if final := stream.Result(); final != nil && final.IsError {
+		return result, fmt.Errorf("agent run ended with %s: %s", final.Subtype, strings.TrimSpace(final.Result))
+	}
+
+	return result, nil
+}
+
+// claudeSessionDir holds the Claude session of the workspace: session-id and
+// the session transcript ({id}.jsonl) as stored by the CLI
+var claudeSessionDir = filepath.Join(agentHistoryDir, "claude")
+
+const claudeSessionIDFile = "session-id"
+
+var (
+	nonAlphanumeric = regexp.MustCompile(`[^a-zA-Z0-9]`)
+	validSessionID  = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+)
+
+// claudeProjectDir is where the CLI keeps the sessions of runs in workspaceDir
+func claudeProjectDir(workspaceDir string) (string, error) {
+	configDir := os.Getenv("CLAUDE_CONFIG_DIR")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(home, ".claude")
+	}
+	return filepath.Join(configDir, "projects", nonAlphanumeric.ReplaceAllString(workspaceDir, "-")), nil
+}
+
+func readClaudeSessionID(workspaceDir string) string {
+	data, err := os.ReadFile(filepath.Join(workspaceDir, claudeSessionDir, claudeSessionIDFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// importClaudeSession makes the workspace's session resumable by the CLI and
+// returns its ID, or "" when the workspace has none
+func importClaudeSession(workspaceDir string) string {
+	sessionID := readClaudeSessionID(workspaceDir)
+	if !validSessionID.MatchString(sessionID) {
+		return ""
+	}
+
+	projectDir, err := claudeProjectDir(workspaceDir)
+	if err != nil {
+		return ""
+	}
+	target := filepath.Join(projectDir, sessionID+".jsonl")
+	if _, err := os.Stat(target); err == nil {
+		// Same worker as the previous run
+		return sessionID
+	}
+
+	transcript, err := os.ReadFile(filepath.Join(workspaceDir, claudeSessionDir, sessionID+".jsonl"))
+	if err != nil {
+		return ""
+	}
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		return ""
+	}
+	if err := os.WriteFile(target, transcript, 0644); err != nil {
+		return ""
+	}
+	return sessionID
+}
+
+// exportClaudeSession copies the CLI's transcript of a session into the workspace
+func exportClaudeSession(workspaceDir, sessionID string) error {
+	projectDir, err := claudeProjectDir(workspaceDir)
+	if err != nil {
+		return err
+	}
+	transcript, err := os.ReadFile(filepath.Join(projectDir, sessionID+".jsonl"))
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(workspaceDir, claudeSessionDir)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, sessionID+".jsonl"), transcript, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, claudeSessionIDFile), []byte(sessionID+"\n"), 0644)
+}
+
+// findClaudePath attempts to locate the Claude CLI executable
+func findClaudePath() string {
+	// Check environment variable first
+	if path := os.Getenv("CLAUDE_CLI_PATH"); path != "" {
+		return path
+	}
+
+	// Try common installation paths
+	commonPaths := []string{
+		"/home/ubuntu/.local/bin/claude",
+		"/usr/local/bin/claude",
+		"/home/ubuntu/.nvm/versions/node/v22.16.0/bin/claude",
+		"/usr/bin/claude",
+	}
+
+	for _, path := range commonPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	// Return "claude" as fallback (relies on PATH)
+	return "claude"
+}
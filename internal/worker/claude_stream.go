@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// maxToolInputChars bounds how much of a tool call's input is shown in the transcript
+const maxToolInputChars = 200
+
+// claudeEvent is one line of `claude --output-format stream-json` output
+type claudeEvent struct {
+	Type      string         `json:"type"` // system, assistant, user, result
+	Subtype   string         `json:"subtype"`
+	SessionID string         `json:"session_id"`
+	Model     string         `json:"model"` // Set on the init event
+	Message   *claudeMessage `json:"message"`
+
+	// Set on the final result event
+	Result       string       `json:"result"`
+	IsError      bool         `json:"is_error"`
+	NumTurns     int          `json:"num_turns"`
+	TotalCostUSD float64      `json:"total_cost_usd"`
+	Usage        *claudeUsage `json:"usage"`
+}
+
+type claudeMessage struct {
+	Content []struct {
+		Type  string          `json:"type"` // text, tool_use, tool_result
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+}
+
+type claudeUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// claudeStream is the stdout of a Claude CLI run. It parses stream-json events
+// line by line, writes a readable rendering of each to output and keeps the
+// rendered transcript and the final result event.
+type claudeStream struct {
+	output io.Writer
+
+	mu         sync.Mutex
+	partial    []byte
+	transcript strings.Builder
+	result     *claudeEvent
+	sessionID  string
+	model      string
+}
+
+func newClaudeStream(output io.Writer) *claudeStream {
+	return &claudeStream{output: output}
+}
+
+func (s *claudeStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.handleLine(s.partial[:i])
+		s.partial = s.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush handles a final line without a trailing newline
+func (s *claudeStream) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.partial) > 0 {
+		s.handleLine(s.partial)
+		s.partial = nil
+	}
+}
+
+// Transcript returns the rendered events
+func (s *claudeStream) Transcript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transcript.String()
+}
+
+// SessionID returns the ID of the session the run used, or "" before the init event
+func (s *claudeStream) SessionID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionID
+}
+
+// Result returns the final result event, or nil if the run ended without one
+func (s *claudeStream) Result() *claudeEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result
+}
+
+// Usage reports the model of the init event and tokens, cost and turns from
+// the final result event
+func (s *claudeStream) Usage() GenerationUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := GenerationUsage{Model: s.model}
+	if s.result == nil {
+		return usage
+	}
+
+	usage.CostUSD = s.result.TotalCostUSD
+	usage.Turns = s.result.NumTurns
+	if u := s.result.Usage; u != nil {
+		usage.InputTokens = u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+		usage.OutputTokens = u.OutputTokens
+	}
+	return usage
+}
+
+// handleLine must be called with mu held
+func (s *claudeStream) handleLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	var event claudeEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		// Not an event (older CLI or plain text output), keep it verbatim
+		s.emit(string(line))
+		return
+	}
+
+	switch event.Type {
+	case "system":
+		if event.Subtype == "init" {
+			s.sessionID = event.SessionID
+			s.model = event.Model
+			s.emit(fmt.Sprintf("[session %s]", event.SessionID))
+		}
+	case "assistant":
+		if event.Message == nil {
+			return
+		}
+		for _, content := range event.Message.Content {
+			switch content.Type {
+			case "text":
+				s.emit(strings.TrimSpace(content.Text))
+			case "tool_use":
+				s.emit(fmt.Sprintf("→ %s %s", content.Name, summarizeToolInput(content.Input)))
+			}
+		}
+	case "result":
+		s.result = &event
+		s.emit(fmt.Sprintf("[%s: %d turns, $%.4f]", event.Subtype, event.NumTurns, event.TotalCostUSD))
+	}
+}
+
+// emit must be called with mu held
+func (s *claudeStream) emit(text string) {
+	if text == "" {
+		return
+	}
+	s.transcript.WriteString(text)
+	s.transcript.WriteString("\n")
+	fmt.Fprintln(s.output, text)
+}
+
+// summarizeToolInput renders tool input as compact single-line JSON
+func summarizeToolInput(input json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, input); err != nil {
+		return ""
+	}
+
+	summary := strings.ReplaceAll(compact.String(), "\\n", " ")
+	if len(summary) > maxToolInputChars {
+		summary = summary[:maxToolInputChars] + "..."
+	}
+	return summary
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+)
+
+// CodeGenerator is a code agent that writes and repairs app code in a workspace.
+// Implementations are selected per app (apps.code_generator) or globally
+// (CODE_GENERATOR). Agent output is written to output (which may be nil) line
+// by line as it is produced so it can be streamed to the user.
+type CodeGenerator interface {
+	// Name identifies the generator in config and the apps table
+	Name() string
+
+	// Generate implements the prompt against the workspace
+	Generate(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error)
+
+	// Fix continues from the last Generate/Fix run with a prompt describing build errors
+	Fix(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error)
+
+	// Plan answers the prompt without changing the workspace; the plan is in
+	// the result's Message
+	Plan(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error)
+}
+
+// GenerationResult is the structured outcome of a code generator run.
+// It is returned alongside errors so transcripts of failed runs are kept.
+type GenerationResult struct {
+	FilesChanged []string        `json:"files_changed"`
+	Transcript   string          `json:"transcript"`
+	Message      string          `json:"message,omitempty"` // Final response of the agent
+	Usage        GenerationUsage `json:"usage"`
+}
+
+// GenerationUsage reports what a generator run consumed
+type GenerationUsage struct {
+	Model        string        `json:"model,omitempty"`
+	InputTokens  int64         `json:"input_tokens"`
+	OutputTokens int64         `json:"output_tokens"`
+	CostUSD      float64       `json:"cost_usd"`
+	Turns        int           `json:"turns"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// defaultCodeGenerator is used when neither the app nor the config selects one
+const defaultCodeGenerator = "claude"
+
+// newCodeGenerators returns the registered code generators keyed by name
+func newCodeGenerators(exec executor.Executor) map[string]CodeGenerator {
+	generators := []CodeGenerator{
+		NewClaudeGenerator(exec),
+		NewFakeGenerator(),
+	}
+
+	registry := make(map[string]CodeGenerator, len(generators))
+	for _, g := range generators {
+		registry[g.Name()] = g
+	}
+	return registry
+}
+
+// codeGeneratorFor picks the generator for an app: the app's own setting wins
+// over the global CODE_GENERATOR setting
+func (b *Builder) codeGeneratorFor(appGenerator *string) (CodeGenerator, error) {
+	name := b.Config.CodeGenerator
+	if appGenerator != nil && *appGenerator != "" {
+		name = *appGenerator
+	}
+	if name == "" {
+		name = defaultCodeGenerator
+	}
+
+	generator, ok := b.CodeGenerators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown code generator %q", name)
+	}
+	return generator, nil
+}
+
+// Directories ignored when detecting which files a generator changed
+var snapshotExcludeDirs = map[string]bool{
+	"node_modules":   true,
+	".git":           true,
+	".vercel":        true,
+	".rapidbuild":    true,
+	".next":          true,
+	"dist":           true,
+	".agent-history": true,
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshotWorkspace records size and modification time of every workspace file
+func snapshotWorkspace(workspaceDir string) map[string]fileStamp {
+	snapshot := make(map[string]fileStamp)
+
+	filepath.Walk(workspaceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if snapshotExcludeDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(workspaceDir, path)
+		if err != nil {
+			return nil
+		}
+		snapshot[relPath] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+
+	return snapshot
+}
+
+// changedFiles lists files added, modified or removed between two snapshots
+func changedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+
+	for path, stamp := range after {
+		if prev, ok := before[path]; !ok || prev != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// generatorOutput returns output, or a writer that discards everything when output is nil
+func generatorOutput(output io.Writer) io.Writer {
+	if output == nil {
+		return io.Discard
+	}
+	return output
+}
+
+// formatTranscript combines stdout and stderr of a generator run for the build log
+func formatTranscript(stdout, stderr string) string {
+	transcript := stdout
+	if strings.TrimSpace(stderr) != "" {
+		transcript += "\n--- STDERR ---\n" + stderr
+	}
+	return transcript
+}
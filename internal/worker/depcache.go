@@ -0,0 +1,453 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// dependencyLockfiles are hashed together with package.json to key the cache
+var dependencyLockfiles = []string{"package-lock.json", "npm-shrinkwrap.json", "pnpm-lock.yaml", "yarn.lock"}
+
+// DependencyCache keeps node_modules archives keyed by the app and the hash of
+// package.json and the lockfile, so builds whose dependencies did not change
+// skip most of the install. node_modules is saved after the app's own code and
+// install scripts have run, so entries are never shared between apps. Entries
+// live in Dir as {key}.tar.gz and are evicted least recently used first once
+// the cache grows beyond MaxBytes. With S3 enabled, local misses fall back to
+// dependency-cache/{appID}/{key}.tar.gz in the bucket (expire those with a
+// bucket lifecycle rule).
+type DependencyCache struct {
+	Dir      string
+	MaxBytes int64
+	MaxEntry int64
+	S3Client *s3.Client // nil keeps the cache local
+	Bucket   string
+
+	mu sync.Mutex // serializes writes and eviction
+}
+
+// NewDependencyCache returns the cache configured by cfg, or nil when disabled
+func NewDependencyCache(cfg *config.Config, s3Client *s3.Client) (*DependencyCache, error) {
+	cache := &DependencyCache{
+		Dir:      cfg.DependencyCacheDir,
+		MaxBytes: cfg.DependencyCacheMaxBytes,
+		MaxEntry: cfg.DependencyCacheMaxEntry,
+		Bucket:   cfg.S3Bucket,
+	}
+
+	switch cfg.DependencyCache {
+	case "off":
+		return nil, nil
+	case "", "local":
+	case "s3":
+		cache.S3Client = s3Client
+	default:
+		return nil, fmt.Errorf("unknown dependency cache %q", cfg.DependencyCache)
+	}
+
+	if err := os.MkdirAll(cache.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dependency cache directory: %w", err)
+	}
+	return cache, nil
+}
+
+// Key hashes the app ID with package.json and the lockfile in the workspace.
+// Platform is part of the key because node_modules may contain native binaries.
+func (c *DependencyCache) Key(appID, workspaceDir string) (string, error) {
+	if appID == "" {
+		return "", fmt.Errorf("app ID is required")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s/%s\n", appID, runtime.GOOS, runtime.GOARCH)
+
+	for _, name := range append([]string{"package.json"}, dependencyLockfiles...) {
+		data, err := os.ReadFile(filepath.Join(workspaceDir, name))
+		if err != nil {
+			if os.IsNotExist(err) && name != "package.json" {
+				continue
+			}
+			return "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Restore extracts the app's cached node_modules for the workspace's
+// dependencies. It returns false on a cache miss, leaving the workspace untouched.
+func (c *DependencyCache) Restore(ctx context.Context, appID, workspaceDir string, output io.Writer) (bool, error) {
+	key, err := c.Key(appID, workspaceDir)
+	if err != nil {
+		return false, err
+	}
+
+	archivePath, err := c.lookup(ctx, appID, key)
+	if err != nil || archivePath == "" {
+		return false, err
+	}
+
+	target := filepath.Join(workspaceDir, "node_modules")
+	if err := os.RemoveAll(target); err != nil {
+		return false, fmt.Errorf("failed to clear node_modules: %w", err)
+	}
+
+	start := time.Now()
+	if err := extractArchive(archivePath, target); err != nil {
+		os.RemoveAll(target)
+		return false, fmt.Errorf("failed to extract cached dependencies: %w", err)
+	}
+
+	// Mark the entry as recently used
+	now := time.Now()
+	os.Chtimes(archivePath, now, now)
+
+	fmt.Fprintf(output, "Restored node_modules from cache %s in %s\n", key[:12], time.Since(start).Round(time.Millisecond))
+	return true, nil
+}
+
+// Save archives the workspace's node_modules under the key of the app and its
+// current package.json and lockfile, unless that entry already exists
+func (c *DependencyCache) Save(ctx context.Context, appID, workspaceDir string, output io.Writer) error {
+	source := filepath.Join(workspaceDir, "node_modules")
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		fmt.Fprintln(output, "No node_modules to cache")
+		return nil
+	}
+
+	key, err := c.Key(appID, workspaceDir)
+	if err != nil {
+		return err
+	}
+
+	archivePath := c.archivePath(key)
+	if _, err := os.Stat(archivePath); err == nil {
+		now := time.Now()
+		os.Chtimes(archivePath, now, now)
+		fmt.Fprintf(output, "Dependencies already cached as %s\n", key[:12])
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	start := time.Now()
+	err = writeArchive(tmp, source)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to archive node_modules: %w", err)
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if c.MaxEntry > 0 && info.Size() > c.MaxEntry {
+		fmt.Fprintf(output, "Skipping dependency cache: archive is %d MB, limit is %d MB\n", info.Size()>>20, c.MaxEntry>>20)
+		return nil
+	}
+
+	c.mu.Lock()
+	err = os.Rename(tmp.Name(), archivePath)
+	if err == nil {
+		c.evict(key)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	fmt.Fprintf(output, "Cached node_modules as %s (%d MB) in %s\n", key[:12], info.Size()>>20, time.Since(start).Round(time.Millisecond))
+
+	if c.S3Client != nil {
+		if err := c.upload(ctx, appID, key, archivePath); err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "Uploaded %s to S3\n", c.s3Key(appID, key))
+	}
+	return nil
+}
+
+func (c *DependencyCache) archivePath(key string) string {
+	return filepath.Join(c.Dir, key+".tar.gz")
+}
+
+func (c *DependencyCache) s3Key(appID, key string) string {
+	return fmt.Sprintf("dependency-cache/%s/%s.tar.gz", appID, key)
+}
+
+// lookup returns the local archive for key, downloading it from S3 on a local
+// miss. An empty path means the key is not cached.
+func (c *DependencyCache) lookup(ctx context.Context, appID, key string) (string, error) {
+	archivePath := c.archivePath(key)
+	if _, err := os.Stat(archivePath); err == nil {
+		return archivePath, nil
+	}
+	if c.S3Client == nil {
+		return "", nil
+	}
+
+	result, err := c.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(c.s3Key(appID, key)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to download cached dependencies: %w", err)
+	}
+	defer result.Body.Close()
+
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, result.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download cached dependencies: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		return "", fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	c.evict(key)
+	return archivePath, nil
+}
+
+func (c *DependencyCache) upload(ctx context.Context, appID, key, archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = c.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(c.s3Key(appID, key)),
+		Body:   file,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload cached dependencies: %w", err)
+	}
+	return nil
+}
+
+// evict removes the least recently used entries until the cache fits in
+// MaxBytes, never removing keep. Must be called with mu held.
+func (c *DependencyCache) evict(keep string) {
+	if c.MaxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		log.Printf("[DepCache] Warning: Failed to list cache: %v\n", err)
+		return
+	}
+
+	type cacheEntry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var archives []cacheEntry
+	var total int64
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+		if entry.Name() != keep+".tar.gz" {
+			archives = append(archives, cacheEntry{filepath.Join(c.Dir, entry.Name()), info.Size(), info.ModTime()})
+		}
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].modTime.Before(archives[j].modTime)
+	})
+	for _, archive := range archives {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err := os.Remove(archive.path); err != nil {
+			log.Printf("[DepCache] Warning: Failed to evict %s: %v\n", archive.path, err)
+			continue
+		}
+		total -= archive.size
+		log.Printf("[DepCache] Evicted %s\n", filepath.Base(archive.path))
+	}
+}
+
+// writeArchive writes dir as a gzipped tar, keeping symlinks (node_modules/.bin)
+func writeArchive(w io.Writer, dir string) error {
+	gzw, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(gzw)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// extractArchive unpacks an archive written by writeArchive into dir. Entries
+// and symlink targets must stay within dir, including through symlinks created
+// by earlier entries.
+func extractArchive(archivePath, dir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(header.Name))
+		if !utils.WithinDir(root, target) || target == root {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		// Earlier symlink entries may redirect the path
+		if err := utils.CheckResolved(root, target); err != nil {
+			return fmt.Errorf("invalid path in archive: %s: %w", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(link) || !utils.WithinDir(root, filepath.Join(filepath.Dir(target), link)) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s", header.Name, header.Linkname)
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			// Links through other links may resolve elsewhere than they read
+			if err := utils.CheckResolved(root, target); err != nil {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s: %w", header.Name, header.Linkname, err)
+			}
+		case tar.TypeReg:
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
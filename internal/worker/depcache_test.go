@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDependencyCacheKey(t *testing.T) {
+	base := map[string]string{
+		"package.json":      `{"dependencies":{"react":"^18.0.0"}}`,
+		"package-lock.json": `{"lockfileVersion":3}`,
+	}
+	key := func(t *testing.T, appID string, files map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		writeFiles(t, dir, files)
+		k, err := (&DependencyCache{}).Key(appID, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	with := func(name, content string) map[string]string {
+		files := map[string]string{}
+		for k, v := range base {
+			files[k] = v
+		}
+		files[name] = content
+		return files
+	}
+
+	baseKey := key(t, "app-1", base)
+	tests := []struct {
+		name  string
+		appID string
+		files map[string]string
+		same  bool
+	}{
+		{"same app and manifests", "app-1", base, true},
+		{"other app", "app-2", base, false},
+		{"package.json changed", "app-1", with("package.json", `{"dependencies":{"react":"^19.0.0"}}`), false},
+		{"lockfile changed", "app-1", with("package-lock.json", `{"lockfileVersion":2}`), false},
+		{"second lockfile", "app-1", with("yarn.lock", "# yarn"), false},
+		{"unrelated file", "app-1", with("src/App.tsx", "export {}"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := key(t, tt.appID, tt.files); (got == baseKey) != tt.same {
+				t.Errorf("key equal to base = %v, want %v", got == baseKey, tt.same)
+			}
+		})
+	}
+
+	t.Run("missing package.json", func(t *testing.T) {
+		if _, err := (&DependencyCache{}).Key("app-1", t.TempDir()); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("missing app ID", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFiles(t, dir, base)
+		if _, err := (&DependencyCache{}).Key("", dir); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestDependencyCacheRoundTrip(t *testing.T) {
+	cache := &DependencyCache{Dir: t.TempDir()}
+	manifests := map[string]string{"package.json": `{"name":"app"}`}
+
+	source := t.TempDir()
+	writeFiles(t, source, manifests)
+	writeFiles(t, source, map[string]string{"node_modules/lib/index.js": "module.exports = 1"})
+	if err := os.MkdirAll(filepath.Join(source, "node_modules", ".bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../lib/index.js", filepath.Join(source, "node_modules", ".bin", "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(context.Background(), "app-1", source, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	restore := func(appID string) (string, bool) {
+		dir := t.TempDir()
+		writeFiles(t, dir, manifests)
+		hit, err := cache.Restore(context.Background(), appID, dir, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir, hit
+	}
+
+	if _, hit := restore("app-2"); hit {
+		t.Error("another app restored the cached dependencies")
+	}
+	dir, hit := restore("app-1")
+	if !hit {
+		t.Fatal("expected a cache hit")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "node_modules", ".bin", "lib"))
+	if err != nil || string(data) != "module.exports = 1" {
+		t.Errorf("restored symlink reads %q, %v", data, err)
+	}
+}
+
+// tarEntry is one entry of a test archive; Link makes it a symlink
+type tarEntry struct {
+	Name, Link, Body string
+	Dir              bool
+}
+
+func writeTestArchive(t *testing.T, entries []tarEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.Name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.Body))}
+		switch {
+		case e.Dir:
+			header = &tar.Header{Name: e.Name, Mode: 0755, Typeflag: tar.TypeDir}
+		case e.Link != "":
+			header = &tar.Header{Name: e.Name, Linkname: e.Link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.Body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		valid   bool
+	}{
+		{"files and relative link", []tarEntry{
+			{Name: "lib", Dir: true},
+			{Name: "lib/index.js", Body: "x"},
+			{Name: ".bin", Dir: true},
+			{Name: ".bin/lib", Link: "../lib/index.js"},
+		}, true},
+		{"dangling link inside", []tarEntry{{Name: "missing", Link: "lib/missing.js"}}, true},
+		{"path traversal", []tarEntry{{Name: "../evil.js", Body: "x"}}, false},
+		{"absolute link", []tarEntry{{Name: "etc", Link: "/etc"}}, false},
+		{"link escaping", []tarEntry{{Name: "up", Link: "../.."}}, false},
+		{"nested link escaping", []tarEntry{
+			{Name: "lib", Dir: true},
+			{Name: "lib/up", Link: ".."},
+			{Name: "lib/up/up2", Link: "../.."},
+		}, false},
+		{"link through link", []tarEntry{
+			{Name: "self", Link: "."},
+			{Name: "out", Link: "self/.."},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			dir := filepath.Join(outside, "node_modules")
+			err := extractArchive(writeTestArchive(t, tt.entries), dir)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected the archive to be rejected")
+			}
+			if _, err := os.Stat(filepath.Join(outside, "evil.js")); err == nil {
+				t.Error("archive wrote outside the destination")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveWritesThroughInternalLinks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "node_modules")
+	archive := writeTestArchive(t, []tarEntry{
+		{Name: "self", Link: "."},
+		{Name: "self/pkg", Dir: true},
+		{Name: "self/pkg/file.js", Body: "x"},
+	})
+	if err := extractArchive(archive, dir); err != nil {
+		t.Fatalf("link to the destination itself should be allowed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "pkg", "file.js")); err != nil || !strings.Contains(string(data), "x") {
+		t.Errorf("file not written inside the destination: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// Failure categories stored in versions.failure
+const (
+	failureAgentCrash       = "agent_crash"         // The code agent exited with an error
+	failureAgentLimit       = "agent_limit"         // The agent hit its turn limit
+	failureAgentUnavailable = "agent_unavailable"   // Model API rate limited, overloaded or out of credit
+	failureCompileError     = "compile_error"       // Syntax, type or import errors the fix loop could not resolve
+	failureDependencyError  = "dependency_error"    // npm could not install dependencies
+	failureBuildError       = "build_error"         // Any other build failure
+	failureVerification     = "verification_failed" // Tests, lint or type checking kept failing
+	failureSecurity         = "security_blocked"    // The security scan found issues at or above the blocking severity
+	failureDeployQuota      = "deploy_quota"        // Hosting provider rate limit or quota
+	failureDeployAuth       = "deploy_auth"         // Hosting provider rejected the platform's credentials
+	failureDeployError      = "deploy_error"        // Any other link or deploy failure
+	failureTimeout          = "timeout"             // A stage ran past its build policy timeout
+	failureNetwork          = "network_error"       // Connection failures to external services
+	failureStorage          = "storage_unavailable" // S3 could not be read or written
+	failureSandbox          = "sandbox_error"       // The build sandbox could not be prepared
+	failureConfig           = "config_error"        // Invalid app settings (e.g. unknown code generator)
+	failureWorkerLost       = "worker_lost"         // Workers stopped responding while running the build
+	failureInternal         = "internal_error"      // Platform errors (database updates, workspace setup)
+)
+
+// failureFlags says, per category, whether running the same build again may
+// succeed and whether the user has to change something (requirements,
+// settings, plan) before it can
+var failureFlags = map[string]struct{ retryable, userActionable bool }{
+	failureAgentCrash:       {true, false},
+	failureAgentLimit:       {true, true},
+	failureAgentUnavailable: {true, false},
+	failureCompileError:     {false, true},
+	failureDependencyError:  {false, true},
+	failureBuildError:       {false, true},
+	failureVerification:     {false, true},
+	failureSecurity:         {false, true},
+	failureDeployQuota:      {true, false},
+	failureDeployAuth:       {false, false},
+	failureDeployError:      {true, false},
+	failureTimeout:          {true, true},
+	failureNetwork:          {true, false},
+	failureStorage:          {true, false},
+	failureSandbox:          {false, false},
+	failureConfig:           {false, true},
+	failureWorkerLost:       {true, false},
+	failureInternal:         {true, false},
+}
+
+// failurePattern maps command output to a category. Patterns are checked in
+// order against the error message, which carries the command's output.
+type failurePattern struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+var networkPatterns = []failurePattern{
+	{failureNetwork, regexp.MustCompile(`(?i)ECONNRESET|ETIMEDOUT|ECONNREFUSED|ENOTFOUND|EAI_AGAIN|socket hang up|network (error|timeout)`)},
+}
+
+var agentPatterns = []failurePattern{
+	{failureAgentUnavailable, regexp.MustCompile(`(?i)rate.?limit|usage limit|overloaded|credit balance|\b429\b|\b529\b`)},
+	{failureAgentLimit, regexp.MustCompile(`(?i)error_max_turns|max(imum)? turns`)},
+}
+
+var buildPatterns = []failurePattern{
+	{failureDependencyError, regexp.MustCompile(`(?i)npm (ERR!|error) (code )?(ERESOLVE|E404|ETARGET|ENOTFOUND)|Could not resolve dependency|No matching version found|404 Not Found - GET`)},
+	{failureCompileError, regexp.MustCompile(`(?i)error TS\d+|SyntaxError|Transform failed|Failed to resolve import|Could not resolve ["']|is not exported by|Unexpected token|Cannot find module|Expected .* but found`)},
+}
+
+var deployPatterns = []failurePattern{
+	// "exceeded" only counts next to a Vercel usage limit; errors like
+	// "Maximum call stack size exceeded" from the build are not quota problems
+	{failureDeployQuota, regexp.MustCompile(`(?i)rate.?limit|too many requests|resource is limited|api-deployments-[a-z]+-per-day|quota|(deployment|usage|request|bandwidth)s? limit (has been |was )?(reached|exceeded)|exceeded (the |your )?(daily |hourly )?(deployment|usage|request|bandwidth|rate)s? limit|payment required|upgrade (your|to)|\b429\b`)},
+	{failureDeployAuth, regexp.MustCompile(`(?i)token (is )?(not valid|invalid|expired)|not authorized|forbidden|no credentials|\b401\b|\b403\b`)},
+}
+
+var storagePattern = regexp.MustCompile(`(?i)operation error S3|NoSuchBucket|AccessDenied`)
+
+// classifiedError carries a category decided where the error happened
+type classifiedError struct {
+	category string
+	err      error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// withFailureCategory marks err with a failure category for classifyFailure
+func withFailureCategory(category string, err error) error {
+	return &classifiedError{category: category, err: err}
+}
+
+// stageTimeoutError is returned when a stage runs past its policy timeout
+type stageTimeoutError struct {
+	stage   string
+	timeout time.Duration
+}
+
+func (e *stageTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.stage, e.timeout)
+}
+
+// classifyFailure derives the failure taxonomy of a build that failed in stage with err
+func classifyFailure(stage string, err error) *models.BuildFailure {
+	failure := &models.BuildFailure{
+		Stage:    stage,
+		Category: failureCategory(stage, err),
+		ExitCode: utils.ExitCode(err),
+	}
+
+	flags := failureFlags[failure.Category]
+	failure.Retryable = flags.retryable
+	failure.UserActionable = flags.userActionable
+	return failure
+}
+
+func failureCategory(stage string, err error) string {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.category
+	}
+
+	var timeout *stageTimeoutError
+	if errors.As(err, &timeout) {
+		return failureTimeout
+	}
+
+	message := err.Error()
+	if category := matchFailure(networkPatterns, message); category != "" {
+		return category
+	}
+
+	switch stage {
+	case stepCodeGeneration, stepFix, stepPlan:
+		if category := matchFailure(agentPatterns, message); category != "" {
+			return category
+		}
+		return failureAgentCrash
+	case stepBuild:
+		if category := matchFailure(buildPatterns, message); category != "" {
+			return category
+		}
+		return failureBuildError
+	case stepVerify:
+		return failureVerification
+	case stepLink, stepDeploy:
+		if category := matchFailure(deployPatterns, message); category != "" {
+			return category
+		}
+		return failureDeployError
+	case stepWorkspaceSetup, stepPackage:
+		if storagePattern.MatchString(message) {
+			return failureStorage
+		}
+	}
+
+	return failureInternal
+}
+
+func matchFailure(patterns []failurePattern, message string) string {
+	for _, p := range patterns {
+		if p.pattern.MatchString(message) {
+			return p.category
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		stage    string
+		err      error
+		category string
+	}{
+		{"classified", stepSecurityScan, withFailureCategory(failureSecurity, errors.New("2 critical issues")), failureSecurity},
+		{"classified wrapped", stepBuild, fmt.Errorf("build: %w", withFailureCategory(failureSandbox, errors.New("bwrap"))), failureSandbox},
+		{"stage timeout", stepBuild, &stageTimeoutError{stage: "build", timeout: time.Minute}, failureTimeout},
+		{"network before stage", stepBuild, errors.New("npm ERR! code ECONNRESET"), failureNetwork},
+		{"agent rate limited", stepCodeGeneration, errors.New("API Error: 429 rate_limit_error"), failureAgentUnavailable},
+		{"agent overloaded", stepFix, errors.New("overloaded_error"), failureAgentUnavailable},
+		{"agent turn limit", stepPlan, errors.New("result: error_max_turns"), failureAgentLimit},
+		{"agent crash", stepCodeGeneration, errors.New("exit status 1"), failureAgentCrash},
+		{"unknown package", stepBuild, errors.New("npm ERR! code E404\nnpm ERR! 404 Not Found - GET https://registry.npmjs.org/nope"), failureDependencyError},
+		{"peer conflict", stepBuild, errors.New("npm error code ERESOLVE"), failureDependencyError},
+		{"type error", stepBuild, errors.New("src/App.tsx(3,7): error TS2322: Type 'string' is not assignable"), failureCompileError},
+		{"missing import", stepBuild, errors.New(`[vite]: Rollup failed to resolve import "x" from "src/main.tsx"`), failureCompileError},
+		{"other build failure", stepBuild, errors.New("vite exited with code 137"), failureBuildError},
+		{"verification", stepVerify, errors.New("3 tests failed"), failureVerification},
+		{"deploy rate limited", stepDeploy, errors.New("Error: Too many requests - try again in 10 minutes"), failureDeployQuota},
+		{"deploy daily limit", stepDeploy, errors.New(`Error: Resource is limited - try again in 24 hours (more than 100, code: "api-deployments-free-per-day").`), failureDeployQuota},
+		{"deploy limit exceeded", stepDeploy, errors.New("Error: You have exceeded your deployment limit"), failureDeployQuota},
+		{"deploy usage limit reached", stepLink, errors.New("Error: Your team's usage limit has been reached"), failureDeployQuota},
+		{"stack overflow during deploy", stepDeploy, errors.New("RangeError: Maximum call stack size exceeded\n    at render (src/App.tsx:10)"), failureDeployError},
+		{"timeout exceeded during deploy", stepDeploy, errors.New("Error: Build exceeded maximum duration"), failureDeployError},
+		{"deploy auth", stepLink, errors.New("Error: The specified token is not valid"), failureDeployAuth},
+		{"deploy error", stepDeploy, errors.New("Error: unexpected build output"), failureDeployError},
+		{"storage", stepPackage, errors.New("operation error S3: PutObject, NoSuchBucket"), failureStorage},
+		{"internal", stepSchemaSetup, errors.New("failed to update version"), failureInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := classifyFailure(tt.stage, tt.err)
+			if failure.Category != tt.category {
+				t.Fatalf("category = %q, want %q", failure.Category, tt.category)
+			}
+			flags := failureFlags[tt.category]
+			if failure.Stage != tt.stage || failure.Retryable != flags.retryable || failure.UserActionable != flags.userActionable {
+				t.Errorf("failure = %+v, want stage %q and flags %+v", failure, tt.stage, flags)
+			}
+			if failure.ExitCode != nil {
+				t.Errorf("exit code = %d for an error without one", *failure.ExitCode)
+			}
+		})
+	}
+}
+
+func TestFailureFlagsCoverCategories(t *testing.T) {
+	categories := []string{
+		failureAgentCrash, failureAgentLimit, failureAgentUnavailable, failureCompileError,
+		failureDependencyError, failureBuildError, failureVerification, failureSecurity,
+		failureDeployQuota, failureDeployAuth, failureDeployError, failureTimeout,
+		failureNetwork, failureStorage, failureSandbox, failureConfig, failureWorkerLost, failureInternal,
+	}
+	for _, category := range categories {
+		if _, ok := failureFlags[category]; !ok {
+			t.Errorf("no flags for %s", category)
+		}
+	}
+}
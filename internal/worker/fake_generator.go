@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fakeGeneratorFile is the only file the fake generator writes
+const fakeGeneratorFile = "RAPIDBUILD_GENERATED.md"
+
+// FakeGenerator is a deterministic code generator for tests and offline runs.
+// It records the prompt in a single file and leaves the starter code untouched,
+// so the rest of the pipeline (build, deploy) runs against known-good code.
+type FakeGenerator struct{}
+
+func NewFakeGenerator() *FakeGenerator {
+	return &FakeGenerator{}
+}
+
+func (g *FakeGenerator) Name() string {
+	return "fake"
+}
+
+// Generate writes the prompt and its hash to RAPIDBUILD_GENERATED.md
+func (g *FakeGenerator) Generate(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	sum := sha256.Sum256([]byte(prompt))
+	hash := hex.EncodeToString(sum[:])
+
+	content := fmt.Sprintf("# Generated by fake code generator\n\nPrompt SHA-256: %s\n\n%s\n", hash, prompt)
+	if err := os.WriteFile(filepath.Join(workspaceDir, fakeGeneratorFile), []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("fake generator failed to write output: %w", err)
+	}
+
+	transcript := fmt.Sprintf("fake generator: wrote %s (prompt %s)\n", fakeGeneratorFile, hash[:12])
+	io.WriteString(generatorOutput(output), transcript)
+
+	return &GenerationResult{
+		FilesChanged: []string{fakeGeneratorFile},
+		Transcript:   transcript,
+		Usage:        GenerationUsage{Turns: 1, Duration: time.Since(start)},
+	}, nil
+}
+
+// Fix changes nothing; the fake generator never produces broken code
+func (g *FakeGenerator) Fix(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	transcript := "fake generator: nothing to fix\n"
+	io.WriteString(generatorOutput(output), transcript)
+
+	return &GenerationResult{
+		Transcript: transcript,
+		Usage:      GenerationUsage{Turns: 1},
+	}, nil
+}
+
+// Plan proposes writing RAPIDBUILD_GENERATED.md, which is what Generate does
+func (g *FakeGenerator) Plan(ctx context.Context, workspaceDir, prompt string, output io.Writer) (*GenerationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("```json\n{\"summary\": \"Record the prompt\", \"approach\": \"The fake generator writes the prompt and its hash to a single file.\", \"files\": [{\"path\": %q, \"action\": \"create\", \"description\": \"Prompt and its SHA-256\"}], \"dependencies\": []}\n```\n", fakeGeneratorFile)
+	transcript := "fake generator: planned " + fakeGeneratorFile + "\n"
+	io.WriteString(generatorOutput(output), transcript)
+
+	return &GenerationResult{
+		Transcript: transcript,
+		Message:    message,
+		Usage:      GenerationUsage{Turns: 1},
+	}, nil
+}
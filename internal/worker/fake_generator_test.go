@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFakeGenerator(t *testing.T) {
+	ctx := context.Background()
+	g := NewFakeGenerator()
+	dir := t.TempDir()
+
+	result, err := g.Generate(ctx, dir, "Build a todo app", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.FilesChanged, []string{fakeGeneratorFile}) {
+		t.Errorf("files changed = %v", result.FilesChanged)
+	}
+	first, err := os.ReadFile(filepath.Join(dir, fakeGeneratorFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(first), "Build a todo app") {
+		t.Errorf("output does not contain the prompt:\n%s", first)
+	}
+
+	// The same prompt writes the same file
+	if _, err := g.Generate(ctx, dir, "Build a todo app", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := os.ReadFile(filepath.Join(dir, fakeGeneratorFile)); string(second) != string(first) {
+		t.Error("output is not deterministic")
+	}
+
+	// The plan is one the planning pass accepts
+	planned, err := g.Plan(ctx, dir, "Build a todo app", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := parseChangePlan(planned.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Path != fakeGeneratorFile || plan.Files[0].Action != "create" {
+		t.Errorf("plan files = %+v", plan.Files)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := g.Generate(cancelled, dir, "x", io.Discard); err == nil {
+		t.Error("Generate ran with a cancelled context")
+	}
+}
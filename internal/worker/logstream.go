@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// Limits for live log streaming. Output is published in batches at most every
+// logFlushInterval; a chatty process that outpaces logMaxLinesPerFlush has its
+// oldest unsent lines dropped once logMaxPendingLines are waiting.
+const (
+	logFlushInterval    = 500 * time.Millisecond
+	logMaxLinesPerFlush = 100
+	logMaxPendingLines  = 1000
+	logMaxLineBytes     = 2048
+)
+
+// logStream is an io.Writer that splits subprocess output into lines and
+// publishes them as "log" events on the version's build progress channel
+type logStream struct {
+	b         *Builder
+	versionID string
+	stage     string
+
+	mu      sync.Mutex
+	partial []byte
+	pending []string
+	dropped int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newLogStream starts streaming output of a build stage. It is a no-op writer
+// when Redis is not configured.
+func (b *Builder) newLogStream(versionID, stage string) *logStream {
+	s := &logStream{
+		b:         b,
+		versionID: versionID,
+		stage:     stage,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if b.RedisClient == nil {
+		close(s.done)
+		return s
+	}
+
+	go s.run()
+	return s
+}
+
+// Write queues complete lines for publishing; a trailing partial line waits for more output
+func (s *logStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.queueLine(s.partial[:i])
+		s.partial = s.partial[i+1:]
+	}
+
+	// Never hold an unbounded partial line (progress bars, minified output)
+	if len(s.partial) > logMaxLineBytes {
+		s.queueLine(s.partial)
+		s.partial = nil
+	}
+
+	return len(p), nil
+}
+
+// queueLine must be called with mu held
+func (s *logStream) queueLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > logMaxLineBytes {
+		line = append(line[:logMaxLineBytes:logMaxLineBytes], "..."...)
+	}
+
+	s.pending = append(s.pending, string(line))
+	if len(s.pending) > logMaxPendingLines {
+		overflow := len(s.pending) - logMaxPendingLines
+		s.pending = s.pending[overflow:]
+		s.dropped += overflow
+	}
+}
+
+// Close publishes any remaining output and stops the stream
+func (s *logStream) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return nil
+}
+
+func (s *logStream) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(false)
+		case <-s.stop:
+			s.flush(true)
+			return
+		}
+	}
+}
+
+// flush publishes up to logMaxLinesPerFlush lines, or everything when final
+func (s *logStream) flush(final bool) {
+	s.mu.Lock()
+	if final && len(s.partial) > 0 {
+		s.queueLine(s.partial)
+		s.partial = nil
+	}
+
+	n := len(s.pending)
+	if !final && n > logMaxLinesPerFlush {
+		n = logMaxLinesPerFlush
+	}
+	lines := s.pending[:n]
+	s.pending = s.pending[n:]
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+
+	if len(lines) == 0 && dropped == 0 {
+		return
+	}
+
+	event := models.BuildLogEvent{
+		Type:      models.BuildEventLog,
+		VersionID: s.versionID,
+		Stage:     s.stage,
+		Lines:     lines,
+		Dropped:   dropped,
+		Timestamp: time.Now(),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[Redis] Failed to marshal log event: %v\n", err)
+		return
+	}
+
+	channel := fmt.Sprintf("build:progress:%s", s.versionID)
+	if err := s.b.RedisClient.Publish(context.Background(), channel, data).Err(); err != nil {
+		log.Printf("[Redis] Failed to publish log event: %v\n", err)
+	}
+}
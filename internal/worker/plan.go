@@ -0,0 +1,253 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// planInstructions follow the generation prompt in the planning pass of a plan-first build
+const planInstructions = "\n\n## Planning Pass\n\n" +
+	"Do not change any files yet. Explore the workspace and plan how you will implement the " +
+	"requirements above. The user reviews the plan before any code is written, so make it " +
+	"specific: name every file you will create, modify or delete and every npm package you will add.\n\n" +
+	"End your response with the plan as a single JSON code block in this format:\n\n" +
+	"```json\n" +
+	"{\n" +
+	"  \"summary\": \"One or two sentences on what will change\",\n" +
+	"  \"approach\": \"How you will implement it\",\n" +
+	"  \"files\": [{\"path\": \"src/pages/Home.tsx\", \"action\": \"create|modify|delete\", \"description\": \"What changes in this file\"}],\n" +
+	"  \"dependencies\": [{\"name\": \"package-name\", \"version\": \"^1.0.0\", \"reason\": \"Why it is needed\"}],\n" +
+	"  \"risks\": [\"Anything that may not work as requested\"]\n" +
+	"}\n" +
+	"```\n"
+
+var planBlockPattern = regexp.MustCompile("(?s)```(?:json)?\\s*(\\{.*?\\})\\s*```")
+
+// planChanges runs the read-only planning pass of a plan-first build, stores
+// the plan on the version and leaves the version awaiting approval. The
+// workspace is discarded; approving the plan builds the version from scratch.
+func (b *Builder) planChanges(ctx context.Context, generator CodeGenerator, workspaceDir, appID, versionID, prompt string, policy models.BuildPolicy) error {
+	b.sendProgress(versionID, "building", "Planning changes...")
+	step := b.startStep(ctx, appID, versionID, stepPlan, 1)
+
+	var result *GenerationResult
+	var plan *models.ChangePlan
+	err := withStageTimeout(ctx, "Planning", policy.AgentTimeoutMinutes, func(ctx context.Context) error {
+		var err error
+		result, err = generator.Plan(ctx, workspaceDir, prompt+planInstructions, step)
+		return err
+	})
+	if err == nil {
+		plan, err = parseChangePlan(result.Message)
+	}
+	step.finish(ctx, err)
+	b.recordUsage(ctx, generator, appID, versionID, services.UsagePlan, 1, result)
+	if err != nil {
+		return b.handleError(ctx, versionID, stepPlan, "Planning failed", err)
+	}
+	if len(result.FilesChanged) > 0 {
+		log.Printf("[Plan] Warning: %s changed %d files while planning version %s; the changes are discarded\n", generator.Name(), len(result.FilesChanged), versionID)
+	}
+
+	_, err = b.VersionService.UpdateVersion(ctx, versionID, map[string]interface{}{
+		"change_plan": plan,
+		"status":      "awaiting_approval",
+	})
+	if err != nil {
+		return b.handleError(ctx, versionID, stepPlan, "Failed to store change plan", withFailureCategory(failureInternal, err))
+	}
+
+	b.sendProgress(versionID, "awaiting_approval", "Plan ready for review")
+	log.Printf("[Plan] Version %s is awaiting approval of a plan touching %d files\n", versionID, len(plan.Files))
+	return nil
+}
+
+// parseChangePlan reads the plan from the agent's final response: the last
+// JSON code block, or the outermost JSON object when there is no code block
+func parseChangePlan(message string) (*models.ChangePlan, error) {
+	var candidates []string
+	blocks := planBlockPattern.FindAllStringSubmatch(message, -1)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		candidates = append(candidates, blocks[i][1])
+	}
+	if start, end := strings.Index(message, "{"), strings.LastIndex(message, "}"); start >= 0 && end > start {
+		candidates = append(candidates, message[start:end+1])
+	}
+
+	for _, candidate := range candidates {
+		var plan models.ChangePlan
+		if err := json.Unmarshal([]byte(candidate), &plan); err != nil {
+			continue
+		}
+		if plan.Summary == "" && len(plan.Files) == 0 {
+			continue
+		}
+		normalizeChangePlan(&plan)
+		plan.Status = models.PlanProposed
+		plan.CreatedAt = time.Now()
+		return &plan, nil
+	}
+	return nil, fmt.Errorf("the agent did not return a change plan")
+}
+
+// normalizeChangePlan drops entries without a path or name and maps unknown
+// file actions to modify
+func normalizeChangePlan(plan *models.ChangePlan) {
+	files := []models.PlannedFile{}
+	for _, file := range plan.Files {
+		file.Path = strings.TrimSpace(file.Path)
+		if file.Path == "" {
+			continue
+		}
+		file.Action = strings.ToLower(strings.TrimSpace(file.Action))
+		if file.Action != "create" && file.Action != "delete" {
+			file.Action = "modify"
+		}
+		files = append(files, file)
+	}
+	plan.Files = files
+
+	dependencies := []models.PlannedDependency{}
+	for _, dep := range plan.Dependencies {
+		dep.Name = strings.TrimSpace(dep.Name)
+		if dep.Name != "" {
+			dependencies = append(dependencies, dep)
+		}
+	}
+	plan.Dependencies = dependencies
+}
+
+// approvedPlanPrompt is appended to the generation prompt of an approved
+// plan-first build. It is added outside the prompt template so templates
+// written before plan-first builds pass the plan on as well.
+func approvedPlanPrompt(plan *models.ChangePlan) string {
+	var sb strings.Builder
+	sb.WriteString("\n\n## Approved Plan\n\n")
+	sb.WriteString("The user reviewed and approved this plan. Implement it; deviate only where the code requires it.\n\n")
+	fmt.Fprintf(&sb, "Summary: %s\n", plan.Summary)
+	if plan.Approach != "" {
+		fmt.Fprintf(&sb, "\nApproach:\n%s\n", plan.Approach)
+	}
+	if len(plan.Files) > 0 {
+		sb.WriteString("\nFiles:\n")
+		for _, file := range plan.Files {
+			fmt.Fprintf(&sb, "- %s %s", file.Action, file.Path)
+			if file.Description != "" {
+				fmt.Fprintf(&sb, ": %s", file.Description)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	if len(plan.Dependencies) > 0 {
+		sb.WriteString("\nNew dependencies:\n")
+		for _, dep := range plan.Dependencies {
+			sb.WriteString("- " + dep.Name)
+			if dep.Version != "" {
+				sb.WriteString("@" + dep.Version)
+			}
+			if dep.Reason != "" {
+				fmt.Fprintf(&sb, ": %s", dep.Reason)
+			}
+			sb.WriteString("\n")
+		}
+	} else {
+		sb.WriteString("\nDo not add new dependencies.\n")
+	}
+	return sb.String()
+}
+
+// EditPlan replaces the proposed plan of a version awaiting approval with the
+// user's edited plan
+func (b *Builder) EditPlan(ctx context.Context, version *models.Version, edited models.ChangePlan) (*models.ChangePlan, error) {
+	plan := editedPlan(version, edited)
+	if err := b.VersionService.DecidePlan(ctx, version.ID, plan, "awaiting_approval"); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ApprovePlan approves the plan of a version awaiting approval, or the user's
+// edited plan when edited is set, and enqueues the build that implements it.
+// The build starts from the code the plan was made for.
+func (b *Builder) ApprovePlan(ctx context.Context, version *models.Version, edited *models.ChangePlan) (*models.BuildJob, error) {
+	if version.ChangePlan == nil {
+		return nil, fmt.Errorf("version has no change plan")
+	}
+	// The stored plan is kept as it is in case the plan has to be reopened
+	previous := *version.ChangePlan
+	approved := previous
+	plan := &approved
+	if edited != nil {
+		plan = editedPlan(version, *edited)
+	}
+	now := time.Now()
+	plan.Status = models.PlanApproved
+	plan.DecidedAt = &now
+
+	// Reuse the inputs of the planning job
+	job, err := b.JobService.GetLatestJobForVersion(ctx, version.ID)
+	if err != nil {
+		return nil, err
+	}
+	payload := job.Payload
+	payload.ApprovedPlan = plan
+	if payload.BaseVersionID == "" && version.BaseVersionID != nil {
+		payload.BaseVersionID = *version.BaseVersionID
+	}
+
+	// Moving out of awaiting_approval first makes a second approval fail
+	if err := b.VersionService.DecidePlan(ctx, version.ID, plan, "pending"); err != nil {
+		return nil, err
+	}
+	queued, err := b.JobService.EnqueueBuild(ctx, version.ID, version.AppID, payload)
+	if err != nil {
+		// Without a job the version would stay pending, so the plan goes back
+		// to awaiting approval
+		if reopenErr := b.VersionService.ReopenPlan(context.WithoutCancel(ctx), version.ID, &previous); reopenErr != nil {
+			log.Printf("[Plan] Failed to reopen the plan of version %s: %v\n", version.ID, reopenErr)
+		}
+		return nil, err
+	}
+	return queued, nil
+}
+
+// RejectPlan rejects the plan of a version awaiting approval and cancels the version
+func (b *Builder) RejectPlan(ctx context.Context, version *models.Version, feedback string) error {
+	if version.ChangePlan == nil {
+		return fmt.Errorf("version has no change plan")
+	}
+	plan := version.ChangePlan
+	now := time.Now()
+	plan.Status = models.PlanRejected
+	plan.Feedback = strings.TrimSpace(feedback)
+	plan.DecidedAt = &now
+
+	if err := b.VersionService.DecidePlan(ctx, version.ID, plan, "cancelled"); err != nil {
+		return err
+	}
+
+	log.Printf("[Plan] Plan of version %s rejected\n", version.ID)
+	b.updateAppStatusAfterCancel(ctx, version.AppID)
+	return nil
+}
+
+// editedPlan is the user's edit of a version's plan, still waiting for approval
+func editedPlan(version *models.Version, edited models.ChangePlan) *models.ChangePlan {
+	edited.Status = models.PlanProposed
+	edited.Edited = true
+	edited.Feedback = ""
+	edited.DecidedAt = nil
+	edited.CreatedAt = time.Now()
+	if version.ChangePlan != nil {
+		edited.CreatedAt = version.ChangePlan.CreatedAt
+	}
+	return &edited
+}
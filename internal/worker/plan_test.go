@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+func TestParseChangePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string // summary of the parsed plan
+		wantErr bool
+	}{
+		{
+			name:    "json block",
+			message: "I explored the workspace.\n\n```json\n{\"summary\": \"Add a todo list\", \"files\": [{\"path\": \"src/Todo.tsx\", \"action\": \"create\"}]}\n```",
+			want:    "Add a todo list",
+		},
+		{
+			name:    "unlabelled block",
+			message: "```\n{\"summary\": \"Dark mode\"}\n```",
+			want:    "Dark mode",
+		},
+		{
+			name:    "last block wins",
+			message: "First idea:\n```json\n{\"summary\": \"Draft\"}\n```\nFinal plan:\n```json\n{\"summary\": \"Final\"}\n```",
+			want:    "Final",
+		},
+		{
+			name:    "invalid last block falls back to an earlier one",
+			message: "```json\n{\"summary\": \"Valid\"}\n```\n```json\n{\"summary\": \n```",
+			want:    "Valid",
+		},
+		{
+			name:    "bare json",
+			message: "Here is the plan: {\"summary\": \"Bare\", \"files\": []} Let me know.",
+			want:    "Bare",
+		},
+		{
+			name:    "files without a summary",
+			message: "```json\n{\"files\": [{\"path\": \"src/App.tsx\"}]}\n```",
+			want:    "",
+		},
+		{name: "no json", message: "I could not come up with a plan.", wantErr: true},
+		{name: "empty plan", message: "```json\n{\"risks\": [\"none\"]}\n```", wantErr: true},
+		{name: "invalid json", message: "```json\n{summary: x}\n```", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := parseChangePlan(tt.message)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Summary != tt.want {
+				t.Errorf("summary = %q, want %q", plan.Summary, tt.want)
+			}
+			if plan.Status != models.PlanProposed || plan.CreatedAt.IsZero() {
+				t.Errorf("plan not marked proposed: %+v", plan)
+			}
+		})
+	}
+}
+
+func TestNormalizeChangePlan(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []models.PlannedFile
+		dependencies []models.PlannedDependency
+		wantFiles    []models.PlannedFile
+		wantDeps     []models.PlannedDependency
+	}{
+		{
+			name:      "nil lists become empty",
+			wantFiles: []models.PlannedFile{},
+			wantDeps:  []models.PlannedDependency{},
+		},
+		{
+			name: "actions normalized",
+			files: []models.PlannedFile{
+				{Path: " src/New.tsx ", Action: "CREATE"},
+				{Path: "src/Old.tsx", Action: " delete"},
+				{Path: "src/App.tsx", Action: "update"},
+				{Path: "src/main.tsx"},
+			},
+			wantFiles: []models.PlannedFile{
+				{Path: "src/New.tsx", Action: "create"},
+				{Path: "src/Old.tsx", Action: "delete"},
+				{Path: "src/App.tsx", Action: "modify"},
+				{Path: "src/main.tsx", Action: "modify"},
+			},
+			wantDeps: []models.PlannedDependency{},
+		},
+		{
+			name:         "entries without a path or name dropped",
+			files:        []models.PlannedFile{{Path: "  ", Action: "create"}, {Path: "src/a.ts", Action: "modify", Description: "kept"}},
+			dependencies: []models.PlannedDependency{{Name: ""}, {Name: " zod ", Version: "^3.0.0"}},
+			wantFiles:    []models.PlannedFile{{Path: "src/a.ts", Action: "modify", Description: "kept"}},
+			wantDeps:     []models.PlannedDependency{{Name: "zod", Version: "^3.0.0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &models.ChangePlan{Files: tt.files, Dependencies: tt.dependencies}
+			normalizeChangePlan(plan)
+			if !reflect.DeepEqual(plan.Files, tt.wantFiles) {
+				t.Errorf("files = %+v, want %+v", plan.Files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(plan.Dependencies, tt.wantDeps) {
+				t.Errorf("dependencies = %+v, want %+v", plan.Dependencies, tt.wantDeps)
+			}
+		})
+	}
+}
+
+func TestApprovedPlanPrompt(t *testing.T) {
+	plan := &models.ChangePlan{
+		Summary: "Add a todo list",
+		Files:   []models.PlannedFile{{Path: "src/Todo.tsx", Action: "create", Description: "The list"}},
+	}
+	prompt := approvedPlanPrompt(plan)
+	for _, want := range []string{"Summary: Add a todo list", "- create src/Todo.tsx: The list", "Do not add new dependencies."} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt has no %q:\n%s", want, prompt)
+		}
+	}
+
+	plan.Dependencies = []models.PlannedDependency{{Name: "zod", Version: "^3.0.0", Reason: "validation"}}
+	prompt = approvedPlanPrompt(plan)
+	if !strings.Contains(prompt, "- zod@^3.0.0: validation") || strings.Contains(prompt, "Do not add new dependencies.") {
+		t.Errorf("dependencies not listed:\n%s", prompt)
+	}
+}
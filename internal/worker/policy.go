@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// buildPolicy returns the limits the app's builds run under. If the policy
+// cannot be loaded the build still runs, with the defaults of the default plan.
+func (b *Builder) buildPolicy(ctx context.Context, appID string) models.BuildPolicy {
+	if b.BuildPolicyService != nil {
+		policy, err := b.BuildPolicyService.GetBuildPolicy(ctx, appID)
+		if err == nil {
+			return policy.Policy
+		}
+		log.Printf("[BuildApp] Warning: Failed to load build policy for app %s, using %s plan defaults: %v\n", appID, services.DefaultPlan, err)
+	}
+
+	defaults, _ := services.PlanBuildPolicy(services.DefaultPlan)
+	return defaults
+}
+
+// withStageTimeout runs fn bounded by a policy timeout in minutes. Running out
+// of time is reported as a failure of the stage, not as a cancelled build.
+func withStageTimeout(ctx context.Context, stage string, minutes int, fn func(ctx context.Context) error) error {
+	timeout := time.Duration(minutes) * time.Minute
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(stageCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return &stageTimeoutError{stage: stage, timeout: timeout}
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// promptSettings are the prompt template and custom instructions a build uses
+type promptSettings struct {
+	template           *services.PromptTemplate
+	customInstructions string
+}
+
+// loadPromptSettings resolves the app's prompt template (or the default one) and
+// its custom instructions. If the app's settings cannot be loaded the build
+// runs with the default template and no custom instructions; a template that
+// does not exist fails the build.
+func (b *Builder) loadPromptSettings(ctx context.Context, appID string) (*promptSettings, error) {
+	settings, err := b.PromptService.GetPromptSettings(ctx, appID)
+	if err != nil {
+		log.Printf("[BuildApp] Warning: Failed to load prompt settings for app %s, using the default template: %v\n", appID, err)
+		settings = nil
+	}
+
+	tmpl, err := b.PromptService.GetTemplate(ctx, b.PromptService.TemplateRef(settings))
+	if err != nil {
+		return nil, err
+	}
+
+	prompts := &promptSettings{template: tmpl}
+	if settings != nil {
+		prompts.customInstructions = settings.CustomInstructions
+	}
+	return prompts, nil
+}
@@ -0,0 +1,206 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/config"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// newWorkerID returns the configured worker ID, or one that is unique per worker process
+func newWorkerID(cfg *config.Config) string {
+	if cfg.WorkerID != "" {
+		return cfg.WorkerID
+	}
+	return fmt.Sprintf("%s-%d", workerHostname(), os.Getpid())
+}
+
+func workerHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
+
+// Run consumes the build queue until ctx is cancelled.
+// In-flight builds are not interrupted on shutdown; their leases expire and
+// the jobs are requeued for the next worker that starts.
+func (b *Builder) Run(ctx context.Context) {
+	concurrency := b.Config.WorkerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	log.Printf("[Worker] Starting worker %s (concurrency %d)\n", b.WorkerID, concurrency)
+
+	if err := b.WorkerService.RegisterWorker(ctx, b.WorkerID, workerHostname(), os.Getpid(), concurrency); err != nil {
+		log.Printf("[Worker] Warning: Failed to register worker: %v\n", err)
+	}
+	defer func() {
+		if err := b.WorkerService.DeregisterWorker(context.Background(), b.WorkerID); err != nil {
+			log.Printf("[Worker] Warning: Failed to deregister worker: %v\n", err)
+		}
+	}()
+
+	// Pick up builds orphaned by a previous deploy or crash before claiming new work
+	b.recoverOrphanedJobs(ctx)
+
+	go b.listenForCancellations(ctx)
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(b.Config.WorkerPollInterval)
+	defer ticker.Stop()
+
+	liveness := time.NewTicker(b.heartbeatInterval())
+	defer liveness.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[Worker] Stopping worker %s, waiting for %d in-flight build(s)\n", b.WorkerID, len(slots))
+			wg.Wait()
+			return
+		case <-liveness.C:
+			if err := b.WorkerService.Heartbeat(ctx, b.WorkerID, len(slots)); err != nil {
+				log.Printf("[Worker] Warning: Worker heartbeat failed: %v\n", err)
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		b.recoverOrphanedJobs(ctx)
+
+		// Claim as many jobs as there are free slots
+		for len(slots) < cap(slots) {
+			job, err := b.JobService.ClaimJob(ctx, b.WorkerID)
+			if err != nil {
+				log.Printf("[Worker] Failed to claim job: %v\n", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(job *models.BuildJob) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				b.processJob(job)
+			}(job)
+		}
+	}
+}
+
+// processJob runs a claimed job and keeps its lease alive while the build runs
+func (b *Builder) processJob(job *models.BuildJob) {
+	log.Printf("[Worker] Claimed job %s for version %s (attempt %d/%d)\n", job.ID, job.VersionID, job.Attempts, job.MaxAttempts)
+
+	// Build context is detached from the worker loop so shutdown does not fail running builds;
+	// it is only cancelled when the user cancels the build or the worker loses the job's lease
+	buildCtx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	b.trackBuild(job.VersionID, func() { cancel(nil) })
+	defer b.untrackBuild(job.VersionID)
+
+	stopHeartbeat := make(chan struct{})
+	go b.heartbeat(job, cancel, stopHeartbeat)
+
+	err := b.BuildApp(buildCtx, job.VersionID, job.AppID, job.Payload)
+	close(stopHeartbeat)
+
+	// The job was requeued or finished elsewhere; its version and job now
+	// belong to whoever holds it
+	if errors.Is(context.Cause(buildCtx), services.ErrLeaseLost) {
+		log.Printf("[Worker] Stopped job %s for version %s after losing its lease\n", job.ID, job.VersionID)
+		return
+	}
+
+	ctx := context.Background()
+	switch {
+	case errors.Is(err, errBuildCancelled):
+		if cancelErr := b.JobService.CancelJob(ctx, job.ID); cancelErr != nil {
+			log.Printf("[Worker] Warning: Failed to mark job %s cancelled: %v\n", job.ID, cancelErr)
+		}
+	case err != nil:
+		if failErr := b.JobService.FailJob(ctx, job.ID, err.Error()); failErr != nil {
+			log.Printf("[Worker] Warning: Failed to mark job %s failed: %v\n", job.ID, failErr)
+		}
+	default:
+		if err := b.JobService.CompleteJob(ctx, job.ID); err != nil {
+			log.Printf("[Worker] Warning: Failed to mark job %s completed: %v\n", job.ID, err)
+		}
+	}
+}
+
+// heartbeatInterval refreshes leases well before they expire
+func (b *Builder) heartbeatInterval() time.Duration {
+	interval := b.Config.JobLeaseTimeout / 4
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return interval
+}
+
+// heartbeat keeps a job's lease alive. It cancels the build when the API
+// flagged it, or with ErrLeaseLost as the cause when the job is no longer held
+// by this worker, so two workers never build the same version.
+func (b *Builder) heartbeat(job *models.BuildJob, cancel context.CancelCauseFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(b.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cancelRequested, err := b.JobService.Heartbeat(context.Background(), job.ID, b.WorkerID)
+			if errors.Is(err, services.ErrLeaseLost) {
+				log.Printf("[Worker] Lost the lease on job %s, stopping its build\n", job.ID)
+				cancel(err)
+				return
+			}
+			if err != nil {
+				log.Printf("[Worker] Warning: Heartbeat failed for job %s: %v\n", job.ID, err)
+				continue
+			}
+			if cancelRequested {
+				log.Printf("[Worker] Cancellation requested for job %s\n", job.ID)
+				cancel(nil)
+			}
+		}
+	}
+}
+
+// recoverOrphanedJobs requeues jobs whose worker stopped heartbeating and
+// fails the versions of jobs that ran out of attempts
+func (b *Builder) recoverOrphanedJobs(ctx context.Context) {
+	exhausted, err := b.JobService.RequeueOrphanedJobs(ctx, b.Config.JobLeaseTimeout)
+	if err != nil {
+		log.Printf("[Worker] Failed to recover orphaned jobs: %v\n", err)
+		return
+	}
+
+	for _, job := range exhausted {
+		if b.BuildStepService != nil {
+			b.BuildStepService.AbortRunningSteps(ctx, job.VersionID, job.Status)
+		}
+		if job.Status == "cancelled" {
+			b.markCancelled(job.VersionID)
+			continue
+		}
+		log.Printf("[Worker] Job %s for version %s exhausted its attempts\n", job.ID, job.VersionID)
+		b.handleError(context.Background(), job.VersionID, "worker", "Build interrupted", withFailureCategory(failureWorkerLost, fmt.Errorf("worker stopped responding after %d attempts", job.Attempts)))
+	}
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+)
+
+// requirementsDir is the workspace folder uploaded requirement files are downloaded to
+const requirementsDir = "requirements"
+
+// Limits for requirement files. Larger files are skipped; text beyond the
+// inline limits stays available to the agent in the workspace.
+const (
+	maxRequirementFileBytes = 20 * 1024 * 1024
+	maxInlineFileBytes      = 16 * 1024
+	maxInlineTotalBytes     = 64 * 1024
+)
+
+// maxRetryChain bounds how far a retry looks back for the files of the version it retries
+const maxRetryChain = 10
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// downloadRequirementFiles downloads the files uploaded for a version (or, for
+// retries, for the version it retries) into the workspace's requirements
+// folder and returns them for the prompt. Files that cannot be downloaded are
+// skipped; the build goes on without them.
+func (b *Builder) downloadRequirementFiles(ctx context.Context, workspaceDir, appID, versionID string) []services.PromptFile {
+	if b.UploadService == nil {
+		return nil
+	}
+
+	uploads, err := b.requirementUploads(ctx, versionID)
+	if err != nil {
+		log.Printf("[Requirements] Warning: Failed to list requirement files for version %s: %v\n", versionID, err)
+		return nil
+	}
+	if len(uploads) == 0 {
+		return nil
+	}
+
+	step := b.startStep(ctx, appID, versionID, stepRequirementFiles, 1)
+	dir := filepath.Join(workspaceDir, requirementsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		step.finish(ctx, err)
+		log.Printf("[Requirements] Warning: Failed to create %s: %v\n", dir, err)
+		return nil
+	}
+
+	var files []services.PromptFile
+	inlineBudget := maxInlineTotalBytes
+	for i, upload := range uploads {
+		name := fmt.Sprintf("%02d-%s", i+1, safeFileName(upload.FileName))
+		path := filepath.Join(dir, name)
+		if err := b.downloadRequirementFile(ctx, upload.S3Path, path); err != nil {
+			fmt.Fprintf(step, "Skipping %s: %v\n", upload.FileName, err)
+			log.Printf("[Requirements] Warning: Failed to download %s for version %s: %v\n", upload.S3Path, versionID, err)
+			continue
+		}
+
+		file := services.PromptFile{
+			Name:  upload.FileName,
+			Path:  requirementsDir + "/" + name,
+			Image: upload.FileType == "image",
+		}
+		if !file.Image {
+			var complete bool
+			file.Text, complete = readInlineText(path, min(maxInlineFileBytes, inlineBudget))
+			file.Truncated = file.Text != "" && !complete
+			inlineBudget -= len(file.Text)
+		}
+		fmt.Fprintf(step, "Downloaded %s to %s\n", upload.FileName, file.Path)
+		files = append(files, file)
+	}
+	step.finish(ctx, nil)
+
+	return files
+}
+
+// requirementUploads returns the files uploaded for a version. Retries reuse
+// the files of the version they retry.
+func (b *Builder) requirementUploads(ctx context.Context, versionID string) ([]models.RequirementFile, error) {
+	for range maxRetryChain {
+		uploads, err := b.UploadService.ListRequirementFiles(ctx, versionID)
+		if err != nil || len(uploads) > 0 {
+			return uploads, err
+		}
+
+		version, err := b.VersionService.GetVersion(ctx, versionID)
+		if err != nil {
+			return nil, err
+		}
+		if version.RetryOfVersionID == nil {
+			return nil, nil
+		}
+		versionID = *version.RetryOfVersionID
+	}
+	return nil, nil
+}
+
+func (b *Builder) downloadRequirementFile(ctx context.Context, s3Path, path string) error {
+	body, err := b.UploadService.DownloadFile(ctx, s3Path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, io.LimitReader(body, maxRequirementFileBytes+1))
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	if n > maxRequirementFileBytes {
+		os.Remove(path)
+		return fmt.Errorf("file is larger than %d MB", maxRequirementFileBytes/(1024*1024))
+	}
+	return nil
+}
+
+// readInlineText returns up to limit bytes of a UTF-8 text file and whether
+// that is the whole file. Binary files (PDFs, office documents) are not inlined.
+func readInlineText(path string, limit int) (string, bool) {
+	if limit <= 0 {
+		return "", false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err != nil || bytes.IndexByte(data, 0) >= 0 {
+		return "", false
+	}
+
+	complete := len(data) <= limit
+	if !complete {
+		data = data[:limit]
+		// Do not cut a multi-byte character in half
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+	}
+	if !utf8.Valid(data) {
+		return "", false
+	}
+	return string(data), complete
+}
+
+// safeFileName keeps the base name of an upload with only portable characters
+func safeFileName(name string) string {
+	name = unsafeFileNameChars.ReplaceAllString(filepath.Base(name), "-")
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
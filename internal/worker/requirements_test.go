@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"spec.pdf", "spec.pdf"},
+		{"Product Brief (v2).docx", "Product-Brief-v2-.docx"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\notes.txt`, "C-Users-me-notes.txt"},
+		{".env", "env"},
+		{"..", "file"},
+		{"", "file"},
+		{"---", "file"},
+		{"données.csv", "donn-es.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeFileName(tt.name); got != tt.want {
+				t.Errorf("safeFileName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInlineText(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		limit        int
+		want         string
+		wantComplete bool
+	}{
+		{"whole file", write("notes.md", []byte("# Notes")), 100, "# Notes", true},
+		{"truncated", write("long.txt", []byte(strings.Repeat("a", 10))), 4, "aaaa", false},
+		{"multi-byte character not cut", write("accents.txt", []byte("éé")), 3, "é", false},
+		{"binary", write("doc.pdf", []byte("%PDF\x00\x01")), 100, "", false},
+		{"invalid utf-8", write("latin1.txt", []byte{0xe9, 0x61}), 100, "", false},
+		{"no budget left", write("small.txt", []byte("x")), 0, "", false},
+		{"missing file", filepath.Join(dir, "missing.txt"), 100, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, complete := readInlineText(tt.path, tt.limit)
+			if got != tt.want || complete != tt.wantComplete {
+				t.Errorf("got %q, %v; want %q, %v", got, complete, tt.want, tt.wantComplete)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// Security finding severities, from most to least severe
+const (
+	severityCritical = "critical"
+	severityHigh     = "high"
+	severityMedium   = "medium"
+	severityLow      = "low"
+)
+
+var severityRank = map[string]int{
+	severityCritical: 4,
+	severityHigh:     3,
+	severityMedium:   2,
+	severityLow:      1,
+}
+
+// Security finding categories
+const (
+	findingSecret           = "secret"            // Hardcoded API keys, tokens, private keys
+	findingDangerousCode    = "dangerous_code"    // eval, unsanitized HTML injection
+	findingClientCredential = "client_credential" // Secrets that end up in the browser
+	findingBadFile          = "bad_file"          // Files that must not be shipped (.env, keys)
+)
+
+// Limits of the security scan. Files are scanned line by line, so only
+// files over maxScanFileBytes are skipped, with an unscanned-file finding.
+const (
+	maxScanFileBytes    = 64 * 1024 * 1024
+	maxSecurityFindings = 200
+	maxSnippetChars     = 120
+	binarySniffBytes    = 8000
+)
+
+// unscannedFileRule reports a file too large to scan; its severity can be
+// overridden like the other rules
+const unscannedFileRule = "unscanned-file"
+
+// securityRule matches one kind of issue in the lines of workspace files
+type securityRule struct {
+	id       string
+	category string
+	severity string
+	message  string
+	pattern  *regexp.Regexp
+	unless   *regexp.Regexp // Lines also matching this are fine (e.g. sanitized HTML)
+	code     bool           // Only source code, not bundles or config files
+	secret   bool           // The match is a credential and is redacted in snippets
+	public   bool           // Credentials commonly meant for browsers (restricted keys, anon tokens)
+}
+
+var securityRules = []securityRule{
+	// Hardcoded secrets
+	{id: "private-key", category: findingSecret, severity: severityCritical, secret: true,
+		message: "Private key in the code",
+		pattern: regexp.MustCompile(`-----BEGIN (RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY( BLOCK)?-----`)},
+	{id: "aws-access-key", category: findingSecret, severity: severityCritical, secret: true,
+		message: "AWS access key ID",
+		pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{id: "github-token", category: findingSecret, severity: severityCritical, secret: true,
+		message: "GitHub token",
+		pattern: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{id: "stripe-secret-key", category: findingSecret, severity: severityCritical, secret: true,
+		message: "Stripe live secret key",
+		pattern: regexp.MustCompile(`\b[sr]k_live_[0-9a-zA-Z]{20,}\b`)},
+	{id: "ai-api-key", category: findingSecret, severity: severityCritical, secret: true,
+		message: "AI provider API key (Anthropic, OpenAI)",
+		pattern: regexp.MustCompile(`\bsk-(ant-[A-Za-z0-9_-]{20,}|proj-[A-Za-z0-9_-]{20,}|[A-Za-z0-9]{40,})`)},
+	{id: "slack-token", category: findingSecret, severity: severityHigh, secret: true,
+		message: "Slack token",
+		pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{id: "google-api-key", category: findingSecret, severity: severityMedium, secret: true, public: true,
+		message: "Google API key",
+		pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{id: "npm-token", category: findingSecret, severity: severityHigh, secret: true,
+		message: "npm auth token",
+		pattern: regexp.MustCompile(`_authToken\s*=\s*[^\s$]{8,}|\bnpm_[A-Za-z0-9]{36}\b`)},
+	{id: "database-url", category: findingSecret, severity: severityHigh, secret: true,
+		message: "Database connection string with a password",
+		pattern: regexp.MustCompile(`\b(mongodb(\+srv)?|postgres(ql)?|mysql|redis|amqp)://[^:/\s"'@]+:[^@/\s"']+@`)},
+	{id: "jwt", category: findingSecret, severity: severityMedium, secret: true, public: true,
+		message: "Hardcoded JSON Web Token",
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{id: "generic-secret", category: findingSecret, severity: severityMedium, secret: true, code: true,
+		message: "Hardcoded password, secret or token",
+		pattern: regexp.MustCompile(`(?i)\b(api[_-]?key|secret[_-]?key|client[_-]?secret|secret|password|passwd|access[_-]?token|auth[_-]?token)["']?\s*[:=]\s*["'][^"'\s]{12,}["']`)},
+
+	// Secrets exposed to the browser through the bundler's public env prefixes
+	{id: "public-env-secret", category: findingClientCredential, severity: severityHigh,
+		message: "Secret exposed to the browser through a public environment variable",
+		pattern: regexp.MustCompile(`\b(VITE|NEXT_PUBLIC|REACT_APP|PUBLIC)_[A-Z0-9_]*(SECRET|PRIVATE|PASSWORD|SERVICE_ROLE)[A-Z0-9_]*\b`)},
+
+	// Dangerous code
+	{id: "eval", category: findingDangerousCode, severity: severityHigh, code: true,
+		message: "eval() runs arbitrary code",
+		pattern: regexp.MustCompile(`(^|[^\w.$])eval\s*\(`)},
+	{id: "new-function", category: findingDangerousCode, severity: severityHigh, code: true,
+		message: "new Function() runs arbitrary code",
+		pattern: regexp.MustCompile(`\bnew\s+Function\s*\(`)},
+	{id: "string-timer", category: findingDangerousCode, severity: severityMedium, code: true,
+		message: "setTimeout/setInterval with a string runs it as code",
+		pattern: regexp.MustCompile("\\bset(Timeout|Interval)\\s*\\(\\s*[\"'`]")},
+	{id: "dangerously-set-inner-html", category: findingDangerousCode, severity: severityMedium, code: true,
+		message: "dangerouslySetInnerHTML without sanitizing the HTML (e.g. DOMPurify.sanitize)",
+		pattern: regexp.MustCompile(`dangerouslySetInnerHTML\s*=\s*\{`),
+		unless:  regexp.MustCompile(`(?i)sanitize|purify`)},
+	{id: "inner-html", category: findingDangerousCode, severity: severityMedium, code: true,
+		message: "Assigning innerHTML/outerHTML without sanitizing the HTML",
+		pattern: regexp.MustCompile(`\.(innerHTML|outerHTML)\s*\+?=[^=]`),
+		unless:  regexp.MustCompile(`(?i)sanitize|purify|=\s*["'\x60]{2}\s*;?\s*$`)},
+	{id: "document-write", category: findingDangerousCode, severity: severityLow, code: true,
+		message: "document.write() can inject markup",
+		pattern: regexp.MustCompile(`\bdocument\.write(ln)?\s*\(`)},
+}
+
+// badFileRule flags files that must not be shipped, by name
+type badFileRule struct {
+	id       string
+	severity string
+	message  string
+	match    func(name string) bool
+}
+
+var badFileRules = []badFileRule{
+	{id: "env-file", severity: severityMedium, message: "Environment file in the code; keep secrets out of the code and the deployment",
+		match: func(name string) bool {
+			return (name == ".env" || strings.HasPrefix(name, ".env.")) && !strings.Contains(name, "example") && !strings.Contains(name, "sample") && !strings.Contains(name, "template")
+		}},
+	{id: "private-key-file", severity: severityCritical, message: "Private key or certificate store file",
+		match: func(name string) bool {
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".pem", ".key", ".p12", ".pfx", ".jks", ".keystore":
+				return true
+			}
+			return name == "id_rsa" || name == "id_dsa" || name == "id_ecdsa" || name == "id_ed25519"
+		}},
+	{id: "htpasswd", severity: severityHigh, message: "Password file",
+		match: func(name string) bool { return name == ".htpasswd" || name == ".netrc" || name == ".pgpass" }},
+}
+
+// vercelStaticDir is the built output of `vercel build`; the rest of .vercel is deployer state
+var vercelStaticDir = filepath.Join(".vercel", "output", "static")
+
+// bundleDirs hold built output that is served to browsers
+var bundleDirs = []string{"dist", "build", "out", vercelStaticDir}
+
+// Directories the scan skips: dependencies and platform state. Uploaded
+// requirement files (requirementsDir) are not part of the app either.
+var securityScanSkipDirs = map[string]bool{
+	"node_modules":   true,
+	".git":           true,
+	".agent-history": true,
+	".rapidbuild":    true,
+	".next":          true,
+}
+
+// File extensions dangerous_code rules apply to
+var codeExtensions = map[string]bool{
+	".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true,
+	".vue": true, ".svelte": true, ".html": true, ".htm": true,
+}
+
+// securityScanner checks a workspace against the security rules with the
+// configured severities
+type securityScanner struct {
+	rules             []securityRule
+	badFiles          []badFileRule
+	unscannedSeverity string // "off" to not report unscanned files
+	blockSeverity     string
+}
+
+// securityScanResult holds the most severe findings of a scan, up to
+// maxSecurityFindings, and the counts over every finding
+type securityScanResult struct {
+	Findings []models.SecurityFinding
+	Total    int
+	Blocking int
+}
+
+// newSecurityScanner applies severity overrides ("rule:severity" or "rule:off")
+func newSecurityScanner(blockSeverity string, overrides []string) (*securityScanner, error) {
+	severities := make(map[string]string)
+	for _, override := range overrides {
+		rule, severity, ok := strings.Cut(override, ":")
+		rule, severity = strings.TrimSpace(rule), strings.ToLower(strings.TrimSpace(severity))
+		if _, known := severityRank[severity]; !ok || (!known && severity != "off") {
+			return nil, fmt.Errorf("invalid security rule severity %q (want rule:critical|high|medium|low|off)", override)
+		}
+		severities[rule] = severity
+	}
+
+	blockSeverity = strings.ToLower(blockSeverity)
+	if _, ok := severityRank[blockSeverity]; !ok && blockSeverity != "none" {
+		return nil, fmt.Errorf("invalid security block severity %q", blockSeverity)
+	}
+
+	scanner := &securityScanner{blockSeverity: blockSeverity, unscannedSeverity: severityMedium}
+	known := map[string]bool{unscannedFileRule: true}
+	if severity, ok := severities[unscannedFileRule]; ok {
+		scanner.unscannedSeverity = severity
+	}
+	for _, rule := range securityRules {
+		known[rule.id] = true
+		if severity, ok := severities[rule.id]; ok {
+			if severity == "off" {
+				continue
+			}
+			rule.severity = severity
+		}
+		scanner.rules = append(scanner.rules, rule)
+	}
+	for _, rule := range badFileRules {
+		known[rule.id] = true
+		if severity, ok := severities[rule.id]; ok {
+			if severity == "off" {
+				continue
+			}
+			rule.severity = severity
+		}
+		scanner.badFiles = append(scanner.badFiles, rule)
+	}
+	for rule := range severities {
+		if !known[rule] {
+			return nil, fmt.Errorf("unknown security rule %q", rule)
+		}
+	}
+
+	return scanner, nil
+}
+
+// blocks reports whether findings of a severity block the deploy
+func (s *securityScanner) blocks(severity string) bool {
+	return s.blockSeverity != "none" && severityRank[severity] >= severityRank[s.blockSeverity]
+}
+
+// scan walks the workspace and returns the most severe findings, most severe
+// first. Counts and the blocking decision cover every finding, including the
+// ones beyond maxSecurityFindings that are not kept.
+func (s *securityScanner) scan(workspaceDir string) (*securityScanResult, error) {
+	result := &securityScanResult{}
+
+	// The first maxSecurityFindings findings of each severity, in walk order,
+	// are enough to keep the most severe ones overall
+	bySeverity := make(map[string][]models.SecurityFinding)
+	add := func(f models.SecurityFinding) {
+		f.Blocking = s.blocks(f.Severity)
+		result.Total++
+		if f.Blocking {
+			result.Blocking++
+		}
+		if len(bySeverity[f.Severity]) < maxSecurityFindings {
+			bySeverity[f.Severity] = append(bySeverity[f.Severity], f)
+		}
+	}
+
+	err := filepath.Walk(workspaceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(workspaceDir, path)
+		if err != nil {
+			return err
+		}
+		bundle := inBundleDir(relPath)
+
+		// Deployer state, apart from the built output
+		deployerState := (relPath == ".vercel" || isParentOf(".vercel", relPath)) && !bundle && !isParentOf(relPath, vercelStaticDir)
+
+		if info.IsDir() {
+			if securityScanSkipDirs[info.Name()] || relPath == requirementsDir || deployerState {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || deployerState {
+			return nil
+		}
+
+		for _, rule := range s.badFiles {
+			if rule.match(info.Name()) {
+				severity := rule.severity
+				if bundle {
+					// Served to anyone who asks for it
+					severity = severityCritical
+				}
+				add(models.SecurityFinding{Rule: rule.id, Category: findingBadFile, Severity: severity, File: filepath.ToSlash(relPath), Message: rule.message})
+			}
+		}
+
+		if info.Size() > maxScanFileBytes {
+			if s.unscannedSeverity != "off" {
+				add(models.SecurityFinding{
+					Rule:     unscannedFileRule,
+					Category: findingBadFile,
+					Severity: s.unscannedSeverity,
+					File:     filepath.ToSlash(relPath),
+					Message:  fmt.Sprintf("File is larger than %d MB and was not scanned for secrets", maxScanFileBytes/(1024*1024)),
+				})
+			}
+			return nil
+		}
+		return s.scanFile(path, filepath.ToSlash(relPath), bundle, add)
+	})
+
+	for _, severity := range []string{severityCritical, severityHigh, severityMedium, severityLow} {
+		for _, f := range bySeverity[severity] {
+			if len(result.Findings) == maxSecurityFindings {
+				break
+			}
+			result.Findings = append(result.Findings, f)
+		}
+	}
+	if result.Findings == nil {
+		result.Findings = []models.SecurityFinding{}
+	}
+	return result, err
+}
+
+// scanFile matches the rules against each line of a file, reading it as a
+// stream so large bundles are scanned too
+func (s *securityScanner) scanFile(path, relPath string, bundle bool, add func(models.SecurityFinding)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if head, _ := reader.Peek(binarySniffBytes); bytes.IndexByte(head, 0) >= 0 {
+		return nil // Binary
+	}
+	code := !bundle && codeExtensions[strings.ToLower(filepath.Ext(path))]
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			for _, rule := range s.rules {
+				if rule.code && !code {
+					continue
+				}
+				loc := rule.pattern.FindStringIndex(line)
+				if loc == nil || (rule.unless != nil && rule.unless.MatchString(line)) {
+					continue
+				}
+
+				finding := models.SecurityFinding{
+					Rule:     rule.id,
+					Category: rule.category,
+					Severity: rule.severity,
+					File:     relPath,
+					Line:     lineNumber,
+					Message:  rule.message,
+					Snippet:  findingSnippet(line, loc, rule.secret),
+				}
+				if rule.secret && !rule.public && bundle {
+					// Shipped to every visitor of the app
+					finding.Category = findingClientCredential
+					finding.Severity = severityCritical
+					finding.Message += " in the built client bundle"
+				}
+				add(finding)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// findingSnippet cuts the matched part of a line (minified bundles are one
+// long line) and redacts secrets down to their first characters
+func findingSnippet(line string, loc []int, secret bool) string {
+	start, end := loc[0], loc[1]
+	match := line[start:end]
+	if secret {
+		keep := min(6, len(match)/4)
+		match = match[:keep] + "****"
+	}
+
+	before := strings.TrimLeft(line[max(0, start-40):start], " \t")
+	after := strings.TrimRight(line[end:min(len(line), end+40)], " \t\r\n")
+	if secret {
+		// The rest of the secret may continue past the match
+		after = ""
+	}
+	snippet := before + match + after
+	if len(snippet) > maxSnippetChars {
+		snippet = snippet[:maxSnippetChars]
+	}
+	return strings.ToValidUTF8(strings.TrimSpace(snippet), "")
+}
+
+func inBundleDir(relPath string) bool {
+	for _, dir := range bundleDirs {
+		if relPath == dir || strings.HasPrefix(relPath, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isParentOf reports whether dir is an ancestor of path
+func isParentOf(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// securityScanError lists the findings that blocked the deploy
+type securityScanError struct {
+	findings []models.SecurityFinding
+}
+
+func (e *securityScanError) Error() string {
+	var lines []string
+	for _, f := range e.findings {
+		if !f.Blocking {
+			continue
+		}
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s (%s)", f.Severity, location, f.Message, f.Rule))
+	}
+	return "Security scan blocked the deploy:\n" + strings.Join(lines, "\n")
+}
+
+// scanSecurity runs the security scan on a built workspace before it is
+// deployed and stores the findings on the version. Blocking findings fail the
+// build; the others are kept as warnings.
+func (b *Builder) scanSecurity(ctx context.Context, workspaceDir, appID, versionID string) error {
+	if !b.Config.SecurityScan {
+		return nil
+	}
+
+	step := b.startStep(ctx, appID, versionID, stepSecurityScan, 1)
+	result, err := b.securityScanner.scan(workspaceDir)
+	if err != nil {
+		step.finish(ctx, err)
+		return withFailureCategory(failureInternal, fmt.Errorf("security scan failed: %w", err))
+	}
+	findings := result.Findings
+
+	for _, f := range findings {
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		label := "warning"
+		if f.Blocking {
+			label = "blocking"
+		}
+		fmt.Fprintf(step, "[%s/%s] %s: %s (%s)\n", f.Severity, label, location, f.Message, f.Rule)
+	}
+	if result.Total > len(findings) {
+		fmt.Fprintf(step, "%d findings (the %d most severe are kept), %d blocking\n", result.Total, len(findings), result.Blocking)
+	} else {
+		fmt.Fprintf(step, "%d findings, %d blocking\n", result.Total, result.Blocking)
+	}
+
+	var scanErr error
+	if result.Blocking > 0 {
+		scanErr = withFailureCategory(failureSecurity, &securityScanError{findings: findings})
+	}
+	step.finish(ctx, scanErr)
+
+	_, err = b.VersionService.UpdateVersion(context.WithoutCancel(ctx), versionID, map[string]interface{}{
+		"security_findings": findings,
+	})
+	if err != nil {
+		log.Printf("[Security] Warning: Failed to store security findings for version %s: %v\n", versionID, err)
+	}
+
+	if result.Blocking == 0 && result.Total > 0 {
+		b.sendProgress(versionID, "building", fmt.Sprintf("Security scan found %d warnings", result.Total))
+	}
+	return scanErr
+}
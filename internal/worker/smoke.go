@@ -0,0 +1,381 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// smokeOutputDirs are checked in order for the built static output to serve
+var smokeOutputDirs = []string{vercelStaticDir, "dist", "build", "out"}
+
+// Limits of the smoke test
+const (
+	maxSmokeRoutes       = 50
+	maxSmokeAssets       = 50
+	maxSmokeResponseSize = 20 * 1024 * 1024
+	smokeRequestTimeout  = 10 * time.Second
+)
+
+var (
+	// Route paths in react-router style routers: <Route path="/x">, { path: "/x" }
+	routePathPattern = regexp.MustCompile("\\bpath\\s*[=:]\\s*\\{?\\s*[\"'`](/[^\"'`]*)[\"'`]")
+	// Local scripts, stylesheets and module preloads of index.html
+	htmlTagPattern   = regexp.MustCompile(`(?is)<(script|link)\b[^>]*>`)
+	htmlAttrPattern  = regexp.MustCompile(`(?is)\b(src|href|rel|integrity)\s*=\s*["']([^"']*)["']`)
+	mountPointMarkup = regexp.MustCompile(`(?i)<div[^>]+id\s*=\s*["'](root|app|__next|__nuxt|svelte)["']`)
+	bodyMarkup       = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+	htmlTagStrip     = regexp.MustCompile(`(?s)<script\b.*?</script>|<[^>]+>`)
+)
+
+// runSmokeCheck serves the built output the way the static host does (files,
+// then index.html for client-side routes) and requests /, every route of the
+// generated router and the assets index.html references. It reports problems
+// like a failed check so they go to the fix loop.
+func (b *Builder) runSmokeCheck(ctx context.Context, workspaceDir string, attempt, timeoutMinutes int, output io.Writer) (models.VerificationResult, error) {
+	result := models.VerificationResult{Check: checkSmoke, Attempt: attempt}
+	start := time.Now()
+
+	var problems []string
+	err := withStageTimeout(ctx, checkSmoke, timeoutMinutes, func(ctx context.Context) error {
+		outputDir, err := smokeOutputDir(workspaceDir)
+		if err != nil {
+			return err
+		}
+		relDir, _ := filepath.Rel(workspaceDir, outputDir)
+		result.Command = "serve " + filepath.ToSlash(relDir)
+		fmt.Fprintf(output, "$ %s\n", result.Command)
+
+		problems, err = smokeTest(ctx, outputDir, discoverRoutes(workspaceDir), output)
+		return err
+	})
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	if err == nil && len(problems) > 0 {
+		err = fmt.Errorf("%d smoke test problems", len(problems))
+	}
+	result.Status = "passed"
+	if err != nil {
+		result.Status = "failed"
+		if len(problems) > 0 {
+			result.Output = strings.Join(problems, "\n")
+		} else {
+			result.Output = err.Error()
+		}
+		if len(result.Output) > maxCheckOutputBytes {
+			result.Output = result.Output[:maxCheckOutputBytes] + "\n... (more problems truncated)"
+		}
+	}
+	return result, err
+}
+
+// smokeOutputDir finds the built static output in the workspace
+func smokeOutputDir(workspaceDir string) (string, error) {
+	for _, dir := range smokeOutputDirs {
+		candidate := filepath.Join(workspaceDir, dir)
+		if _, err := os.Stat(filepath.Join(candidate, "index.html")); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no build output with index.html found (looked in %s)", strings.Join(smokeOutputDirs, ", "))
+}
+
+// smokeTest serves outputDir on a local port and returns the problems found
+func smokeTest(ctx context.Context, outputDir string, routes []string, output io.Writer) ([]string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve build output: %w", err)
+	}
+	server := &http.Server{Handler: staticSiteHandler(outputDir), ReadHeaderTimeout: smokeRequestTimeout}
+	go server.Serve(listener)
+	defer server.Close()
+
+	baseURL := "http://" + listener.Addr().String()
+	client := &http.Client{Timeout: smokeRequestTimeout}
+
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problem := fmt.Sprintf(format, args...)
+		problems = append(problems, problem)
+		fmt.Fprintln(output, "✗ "+problem)
+	}
+
+	// The root page must render into a mount point and load its scripts
+	status, contentType, body, err := smokeGet(ctx, client, baseURL+"/")
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		report("GET / returned %d", status)
+		return problems, nil
+	}
+	fmt.Fprintf(output, "✓ GET / %d (%d bytes)\n", status, len(body))
+	if !strings.HasPrefix(contentType, "text/html") {
+		report("GET / returned %s instead of HTML", contentType)
+	}
+	if !hasRenderMarkup(body) {
+		report("GET / has no mount point (e.g. <div id=\"root\">) and no content in <body>")
+	}
+
+	assets := htmlAssets(body)
+	if len(assets) == 0 {
+		report("index.html references no scripts or stylesheets")
+	}
+	for _, asset := range assets {
+		if ctx.Err() != nil {
+			return problems, ctx.Err()
+		}
+		status, contentType, data, err := smokeGet(ctx, client, baseURL+asset.path)
+		switch {
+		case err != nil:
+			report("GET %s failed: %v", asset.path, err)
+		case status != http.StatusOK:
+			report("GET %s (referenced by index.html) returned %d", asset.path, status)
+		case len(data) == 0:
+			report("GET %s (referenced by index.html) is empty", asset.path)
+		case strings.HasPrefix(contentType, "text/html"):
+			report("GET %s (referenced by index.html) returned HTML instead of a %s; the file is missing from the build output", asset.path, asset.kind)
+		case asset.integrity != "" && !checkIntegrity(asset.integrity, data):
+			report("GET %s does not match its integrity attribute %q", asset.path, asset.integrity)
+		default:
+			fmt.Fprintf(output, "✓ GET %s %d (%d bytes)\n", asset.path, status, len(data))
+		}
+	}
+
+	// Client-side routes must be served by the app too
+	for _, route := range routes {
+		if ctx.Err() != nil {
+			return problems, ctx.Err()
+		}
+		status, contentType, data, err := smokeGet(ctx, client, baseURL+route)
+		switch {
+		case err != nil:
+			report("GET %s failed: %v", route, err)
+		case status != http.StatusOK:
+			report("GET %s (route of the app's router) returned %d", route, status)
+		case !strings.HasPrefix(contentType, "text/html") || len(bytes.TrimSpace(data)) == 0:
+			report("GET %s (route of the app's router) returned no HTML", route)
+		default:
+			fmt.Fprintf(output, "✓ GET %s %d\n", route, status)
+		}
+	}
+
+	return problems, nil
+}
+
+func smokeGet(ctx context.Context, client *http.Client, rawURL string) (int, string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSmokeResponseSize))
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), data, nil
+}
+
+// staticSiteHandler serves files of dir like a static host with a single page
+// app fallback: existing files, then {path}.html and {path}/index.html, then
+// index.html for paths without an extension (client-side routes)
+func staticSiteHandler(dir string) http.Handler {
+	site := os.DirFS(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		candidates := []string{name, name + ".html", path.Join(name, "index.html")}
+		if path.Ext(name) == "" {
+			candidates = append(candidates, "index.html")
+		}
+		if name == "" {
+			candidates = []string{"index.html"}
+		}
+
+		for _, candidate := range candidates {
+			data, err := fs.ReadFile(site, candidate)
+			if err != nil {
+				continue
+			}
+			contentType := mime.TypeByExtension(path.Ext(candidate))
+			if contentType == "" {
+				contentType = http.DetectContentType(data)
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.Write(data)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// hasRenderMarkup reports whether a page has a mount point for the app or
+// renders content of its own
+func hasRenderMarkup(page []byte) bool {
+	if mountPointMarkup.Match(page) {
+		return true
+	}
+	body := bodyMarkup.FindSubmatch(page)
+	return body != nil && len(bytes.TrimSpace(htmlTagStrip.ReplaceAll(body[1], nil))) > 0
+}
+
+// smokeAsset is a local script or stylesheet referenced by index.html
+type smokeAsset struct {
+	path      string
+	kind      string // script, stylesheet
+	integrity string
+}
+
+// htmlAssets returns the local scripts, stylesheets and module preloads of a page
+func htmlAssets(page []byte) []smokeAsset {
+	seen := make(map[string]bool)
+	var assets []smokeAsset
+	for _, tag := range htmlTagPattern.FindAll(page, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range htmlAttrPattern.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(attr[1]))] = string(attr[2])
+		}
+
+		var ref, kind string
+		if bytes.HasPrefix(bytes.ToLower(tag), []byte("<script")) {
+			ref, kind = attrs["src"], "script"
+		} else {
+			switch strings.ToLower(attrs["rel"]) {
+			case "stylesheet":
+				ref, kind = attrs["href"], "stylesheet"
+			case "modulepreload", "preload":
+				ref, kind = attrs["href"], "script"
+			}
+		}
+
+		assetPath, ok := localAssetPath(ref)
+		if !ok || seen[assetPath] || len(assets) >= maxSmokeAssets {
+			continue
+		}
+		seen[assetPath] = true
+		assets = append(assets, smokeAsset{path: assetPath, kind: kind, integrity: attrs["integrity"]})
+	}
+	return assets
+}
+
+// localAssetPath returns the site path of a reference served by the app itself
+func localAssetPath(ref string) (string, bool) {
+	if ref == "" || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+	return path.Clean("/" + u.Path), true
+}
+
+// checkIntegrity verifies subresource integrity metadata ("sha384-..."; any
+// listed hash may match)
+func checkIntegrity(integrity string, data []byte) bool {
+	checked := false
+	for _, entry := range strings.Fields(integrity) {
+		algorithm, expected, ok := strings.Cut(entry, "-")
+		if !ok {
+			continue
+		}
+		expected, _, _ = strings.Cut(expected, "?")
+
+		var h hash.Hash
+		switch algorithm {
+		case "sha256":
+			h = sha256.New()
+		case "sha384":
+			h = sha512.New384()
+		case "sha512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		checked = true
+		h.Write(data)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) == expected {
+			return true
+		}
+	}
+	// Unknown algorithms are ignored, like browsers do
+	return !checked
+}
+
+// discoverRoutes returns the static paths of the generated app's router.
+// Dynamic segments get a placeholder value; catch-all routes are skipped.
+func discoverRoutes(workspaceDir string) []string {
+	seen := map[string]bool{"/": true}
+	var routes []string
+
+	filepath.Walk(filepath.Join(workspaceDir, "src"), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".tsx", ".jsx", ".ts", ".js":
+		default:
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil || !bytes.Contains(data, []byte("react-router")) {
+			return nil
+		}
+		for _, match := range routePathPattern.FindAllSubmatch(data, -1) {
+			route, ok := smokeRoute(string(match[1]))
+			if ok && !seen[route] && len(routes) < maxSmokeRoutes {
+				seen[route] = true
+				routes = append(routes, route)
+			}
+		}
+		return nil
+	})
+
+	sort.Strings(routes)
+	return routes
+}
+
+// smokeRoute turns a router path into one that can be requested
+func smokeRoute(route string) (string, bool) {
+	if strings.Contains(route, "*") || strings.ContainsAny(route, "?#") {
+		return "", false
+	}
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "1"
+		}
+	}
+	route = path.Clean(strings.Join(segments, "/"))
+	return route, route != "/"
+}
@@ -0,0 +1,225 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSmokeRoute(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+		ok    bool
+	}{
+		{"/about", "/about", true},
+		{"/users/:id", "/users/1", true},
+		{"/users/:id/posts/:postId", "/users/1/posts/1", true},
+		{"/settings/", "/settings", true},
+		{"/", "", false},
+		{"/docs/*", "", false},
+		{"*", "", false},
+		{"/search?q=x", "", false},
+		{"/page#top", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			got, ok := smokeRoute(tt.route)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("smokeRoute(%q) = %q, %v; want %q, %v", tt.route, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHTMLAssets(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want []smokeAsset
+	}{
+		{
+			name: "vite output",
+			page: `<script type="module" crossorigin src="/assets/index-abc.js"></script>
+				<link rel="stylesheet" crossorigin href="/assets/index-abc.css">`,
+			want: []smokeAsset{{"/assets/index-abc.js", "script", ""}, {"/assets/index-abc.css", "stylesheet", ""}},
+		},
+		{
+			name: "preloads and integrity",
+			page: `<link rel="modulepreload" href="./assets/vendor.js" integrity="sha384-abc"><LINK REL="preload" HREF="/assets/font.js">`,
+			want: []smokeAsset{{"/assets/vendor.js", "script", "sha384-abc"}, {"/assets/font.js", "script", ""}},
+		},
+		{
+			name: "external and inline references skipped",
+			page: `<script src="https://cdn.example.com/x.js"></script><script src="//cdn.example.com/y.js"></script>
+				<link rel="stylesheet" href="data:text/css,body{}"><script>console.log(1)</script><link rel="icon" href="/favicon.ico">`,
+			want: nil,
+		},
+		{
+			name: "duplicates and query strings",
+			page: `<script src="/main.js?v=1"></script><script src="/main.js"></script>`,
+			want: []smokeAsset{{"/main.js", "script", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlAssets([]byte(tt.page)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("htmlAssets = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	data := []byte("console.log('app')")
+	digest := func(sum []byte) string { return base64.StdEncoding.EncodeToString(sum) }
+	sum256 := sha256.Sum256(data)
+	sum384 := sha512.Sum384(data)
+	sum512 := sha512.Sum512(data)
+
+	tests := []struct {
+		name      string
+		integrity string
+		want      bool
+	}{
+		{"sha256", "sha256-" + digest(sum256[:]), true},
+		{"sha384", "sha384-" + digest(sum384[:]), true},
+		{"sha512 with options", "sha512-" + digest(sum512[:]) + "?ct=application/javascript", true},
+		{"one of several matches", "sha384-bm90IGl0 sha256-" + digest(sum256[:]), true},
+		{"mismatch", "sha384-bm90IGl0", false},
+		{"unknown algorithm only", "md5-bm90IGl0", true},
+		{"unknown algorithm and mismatch", "md5-bm90IGl0 sha256-bm90IGl0", false},
+		{"malformed", "garbage", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkIntegrity(tt.integrity, data); got != tt.want {
+				t.Errorf("checkIntegrity(%q) = %v, want %v", tt.integrity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticSiteHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":       "<html>index</html>",
+		"about.html":       "<html>about</html>",
+		"docs/index.html":  "<html>docs</html>",
+		"assets/app.js":    "console.log(1)",
+		"assets/style.css": "body{}",
+	})
+	server := httptest.NewServer(staticSiteHandler(dir))
+	defer server.Close()
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/", http.StatusOK, "text/html", "index"},
+		{"/assets/app.js", http.StatusOK, "javascript", "console.log(1)"},
+		{"/assets/style.css", http.StatusOK, "text/css", "body{}"},
+		{"/about", http.StatusOK, "text/html", "about"},
+		{"/docs", http.StatusOK, "text/html", "docs"},
+		{"/users/1", http.StatusOK, "text/html", "index"},
+		{"/assets/missing.js", http.StatusNotFound, "", ""},
+		{"/../../etc/passwd", http.StatusOK, "text/html", "index"},
+		{"/../../etc/hosts.txt", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+				t.Errorf("content type = %q, want %q", ct, tt.contentType)
+			}
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestSmokeTest(t *testing.T) {
+	script := "console.log('app')"
+	sum := sha256.Sum256([]byte(script))
+	integrity := "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		routes   []string
+		problems []string
+	}{
+		{
+			name: "working app",
+			files: map[string]string{
+				"index.html":    `<html><body><div id="root"></div><script src="/assets/app.js" integrity="` + integrity + `"></script></body></html>`,
+				"assets/app.js": script,
+			},
+			routes: []string{"/about"},
+		},
+		{
+			name:     "missing index.html",
+			files:    map[string]string{"assets/app.js": script},
+			problems: []string{"GET / returned 404"},
+		},
+		{
+			name: "missing asset and blank page",
+			files: map[string]string{
+				"index.html": `<html><body><script src="/assets/app.js"></script></body></html>`,
+			},
+			problems: []string{"no mount point", "GET /assets/app.js (referenced by index.html) returned 404"},
+		},
+		{
+			name: "integrity mismatch",
+			files: map[string]string{
+				"index.html": `<div id="app"></div><script src="/app.js" integrity="sha256-bm90IGl0"></script>`,
+				"app.js":     script,
+			},
+			problems: []string{"does not match its integrity attribute"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			problems, err := smokeTest(context.Background(), dir, tt.routes, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("problems = %q, want %d matching %q", problems, len(tt.problems), tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want it to contain %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
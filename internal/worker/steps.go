@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/services"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// Build stages recorded in build_steps
+const (
+	stepWorkspaceSetup    = "workspace_setup"
+	stepDependencyRestore = "dependency_restore"
+	stepRequirementFiles  = "requirement_files"
+	stepLink              = "link"
+	stepPlan              = "plan"
+	stepCodeGeneration    = "code_generation"
+	stepBuild             = "build"
+	stepVerify            = "verify"
+	stepFix               = "fix"
+	stepSecurityScan      = "security_scan"
+	stepSchemaSetup       = "schema_setup"
+	stepDeploy            = "deploy"
+	stepPackage           = "package"
+	stepDependencySave    = "dependency_save"
+)
+
+// maxStepLogBytes bounds the log kept per step; the oldest output is dropped first
+const maxStepLogBytes = 256 * 1024
+
+// logChunkBytes is the size at which buffered output is uploaded as a build log chunk
+const logChunkBytes = 256 * 1024
+
+// buildStep records one stage of a build, captures the output written to it,
+// streams that output live to SSE clients and appends it to the version's
+// build log in S3
+type buildStep struct {
+	service *services.BuildStepService
+	logs    *services.BuildLogService
+	step    *models.BuildStep // nil when the step could not be recorded
+	stream  *logStream
+
+	ctx       context.Context
+	appID     string
+	versionID string
+	name      string
+	attempt   int
+	startedAt time.Time
+
+	mu        sync.Mutex
+	log       []byte
+	truncated bool
+	chunk     []byte
+}
+
+// startStep records the start of a stage. Failing to record a step never fails the build.
+func (b *Builder) startStep(ctx context.Context, appID, versionID, name string, attempt int) *buildStep {
+	s := &buildStep{
+		service:   b.BuildStepService,
+		logs:      b.BuildLogService,
+		stream:    b.newLogStream(versionID, name),
+		ctx:       context.WithoutCancel(ctx),
+		appID:     appID,
+		versionID: versionID,
+		name:      name,
+		attempt:   attempt,
+		startedAt: time.Now(),
+	}
+	s.chunk = fmt.Appendf(nil, "=== %s (attempt %d) started %s ===\n", name, attempt, s.startedAt.UTC().Format(time.RFC3339))
+
+	if b.BuildStepService == nil {
+		return s
+	}
+
+	step, err := b.BuildStepService.StartStep(ctx, versionID, name, attempt)
+	if err != nil {
+		log.Printf("[Steps] Warning: Failed to record %s step for version %s: %v\n", name, versionID, err)
+		return s
+	}
+	s.step = step
+	return s
+}
+
+// Write captures command output for the step log, streams it and uploads it
+// to the build log in chunks
+func (s *buildStep) Write(p []byte) (int, error) {
+	s.stream.Write(p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log = append(s.log, p...)
+	if len(s.log) > maxStepLogBytes {
+		s.log = s.log[len(s.log)-maxStepLogBytes:]
+		s.truncated = true
+	}
+
+	s.chunk = append(s.chunk, p...)
+	if len(s.chunk) >= logChunkBytes {
+		s.flushChunk()
+	}
+	return len(p), nil
+}
+
+// flushChunk uploads the buffered output; must be called with mu held so
+// chunks are written in order
+func (s *buildStep) flushChunk() {
+	if s.logs == nil || len(s.chunk) == 0 {
+		s.chunk = nil
+		return
+	}
+
+	name := fmt.Sprintf("%s-%d", s.name, s.attempt)
+	if err := s.logs.AppendChunk(s.ctx, s.appID, s.versionID, name, s.chunk); err != nil {
+		log.Printf("[Steps] Warning: Failed to append build log for version %s: %v\n", s.versionID, err)
+	}
+	s.chunk = nil
+}
+
+// finish records the outcome of the stage: succeeded, cancelled or failed with
+// the exit code of the command behind err
+func (s *buildStep) finish(ctx context.Context, err error) {
+	s.stream.Close()
+
+	status := "succeeded"
+	if errors.Is(err, context.Canceled) {
+		status = "cancelled"
+	} else if err != nil {
+		status = "failed"
+	}
+	exitCode := utils.ExitCode(err)
+
+	// Command errors repeat the captured output; only add other errors to the log
+	var errLine string
+	var cmdErr *utils.CommandError
+	if err != nil && !errors.As(err, &cmdErr) {
+		errLine = "Error: " + err.Error()
+	}
+
+	s.mu.Lock()
+	stepLog := string(s.log)
+	if s.truncated {
+		stepLog = "... (earlier output truncated)\n" + stepLog
+	}
+	if errLine != "" {
+		if stepLog != "" {
+			stepLog += "\n"
+		}
+		stepLog += errLine
+		s.chunk = append(s.chunk, "\n"+errLine+"\n"...)
+	}
+	footer := fmt.Sprintf("=== %s (attempt %d) %s after %s", s.name, s.attempt, status, time.Since(s.startedAt).Round(time.Millisecond))
+	if exitCode != nil {
+		footer += fmt.Sprintf(", exit code %d", *exitCode)
+	}
+	s.chunk = append(s.chunk, "\n"+footer+" ===\n"...)
+	s.flushChunk()
+	s.mu.Unlock()
+
+	if s.step == nil {
+		return
+	}
+
+	if err := s.service.FinishStep(context.WithoutCancel(ctx), s.step.ID, status, exitCode, stepLog); err != nil {
+		log.Printf("[Steps] Warning: Failed to finish %s step: %v\n", s.step.Name, err)
+	}
+}
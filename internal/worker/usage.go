@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+)
+
+// recordUsage stores what a code generator run of a build consumed. Runs that
+// failed or were cancelled are recorded too; they were paid for all the same.
+func (b *Builder) recordUsage(ctx context.Context, generator CodeGenerator, appID, versionID, operation string, attempt int, result *GenerationResult) {
+	if b.UsageService == nil || result == nil {
+		return
+	}
+
+	event := models.UsageEvent{
+		AppID:        appID,
+		VersionID:    &versionID,
+		Provider:     generator.Name(),
+		Operation:    operation,
+		Attempt:      attempt,
+		InputTokens:  result.Usage.InputTokens,
+		OutputTokens: result.Usage.OutputTokens,
+		CostUSD:      result.Usage.CostUSD,
+		Turns:        result.Usage.Turns,
+		DurationMs:   result.Usage.Duration.Milliseconds(),
+	}
+	if result.Usage.Model != "" {
+		event.Model = &result.Usage.Model
+	}
+
+	if err := b.UsageService.RecordUsage(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("[Usage] Warning: Failed to record %s usage of version %s: %v\n", operation, versionID, err)
+	}
+}
@@ -0,0 +1,238 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapidbuildapp/rapidbuild/internal/executor"
+	"github.com/rapidbuildapp/rapidbuild/internal/models"
+	"github.com/rapidbuildapp/rapidbuild/internal/utils"
+)
+
+// Post-build checks, in the order they run
+const (
+	checkTest      = "test"
+	checkLint      = "lint"
+	checkTypecheck = "typecheck"
+	checkSmoke     = "smoke"
+)
+
+var verifyCheckOrder = []string{checkTest, checkLint, checkTypecheck, checkSmoke}
+
+// maxCheckOutputBytes bounds the output kept per check on the version and in the fix prompt
+const maxCheckOutputBytes = 8 * 1024
+
+// verifyCommand is how a check runs in a workspace
+type verifyCommand struct {
+	name string
+	args []string
+}
+
+func (c verifyCommand) String() string {
+	return strings.Join(append([]string{c.name}, c.args...), " ")
+}
+
+// packageManifest is the part of package.json used to detect checks
+type packageManifest struct {
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+func (m *packageManifest) hasDependency(name string) bool {
+	_, dep := m.Dependencies[name]
+	_, devDep := m.DevDependencies[name]
+	return dep || devDep
+}
+
+// detectVerifyCommand returns the command for a check, or false when the
+// generated app has nothing to run for it
+func detectVerifyCommand(workspaceDir string, manifest *packageManifest, check string) (verifyCommand, bool) {
+	switch check {
+	case checkTest:
+		// npm init's placeholder test script always fails
+		if script, ok := manifest.Scripts["test"]; ok && !strings.Contains(script, "no test specified") {
+			return verifyCommand{"npm", []string{"test"}}, true
+		}
+	case checkLint:
+		if _, ok := manifest.Scripts["lint"]; ok {
+			return verifyCommand{"npm", []string{"run", "lint"}}, true
+		}
+		if manifest.hasDependency("eslint") && hasAnyFile(workspaceDir, "eslint.config.js", "eslint.config.mjs", "eslint.config.cjs", "eslint.config.ts", ".eslintrc", ".eslintrc.js", ".eslintrc.cjs", ".eslintrc.json") {
+			return verifyCommand{"npx", []string{"--no-install", "eslint", "."}}, true
+		}
+	case checkTypecheck:
+		for _, script := range []string{"typecheck", "type-check"} {
+			if _, ok := manifest.Scripts[script]; ok {
+				return verifyCommand{"npm", []string{"run", script}}, true
+			}
+		}
+		if manifest.hasDependency("typescript") && hasAnyFile(workspaceDir, "tsconfig.json") {
+			return verifyCommand{"npx", []string{"--no-install", "tsc", "--noEmit"}}, true
+		}
+	}
+	return verifyCommand{}, false
+}
+
+func hasAnyFile(dir string, names ...string) bool {
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyBuild runs the configured checks against a successfully built
+// workspace, stores their results on the version and returns an error
+// describing every failed check so it can be sent to the fix loop
+func (b *Builder) verifyBuild(ctx context.Context, workspaceDir, appID, versionID string, attempt int, policy models.BuildPolicy) error {
+	if len(b.Config.VerifyChecks) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspaceDir, "package.json"))
+	if err != nil {
+		log.Printf("[Verify] Skipping verification for version %s: %v\n", versionID, err)
+		return nil
+	}
+	var manifest packageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		// A broken package.json fails the build itself, so this is not reached in practice
+		return fmt.Errorf("failed to parse package.json: %w", err)
+	}
+
+	enabled := make(map[string]bool)
+	for _, check := range b.Config.VerifyChecks {
+		enabled[check] = true
+	}
+
+	step := b.startStep(ctx, appID, versionID, stepVerify, attempt)
+
+	var results []models.VerificationResult
+	var failures []string
+	var firstErr error
+	for _, check := range verifyCheckOrder {
+		if !enabled[check] {
+			continue
+		}
+
+		var result models.VerificationResult
+		var err error
+		if check == checkSmoke {
+			// Served from the build output rather than run from package.json
+			result, err = b.runSmokeCheck(ctx, workspaceDir, attempt, policy.VerifyTimeoutMinutes, step)
+		} else {
+			command, ok := detectVerifyCommand(workspaceDir, &manifest, check)
+			if !ok {
+				fmt.Fprintf(step, "Skipping %s: not configured in package.json\n", check)
+				results = append(results, models.VerificationResult{Check: check, Status: "skipped", Attempt: attempt})
+				continue
+			}
+			result, err = b.runCheck(ctx, workspaceDir, check, command, attempt, policy.VerifyTimeoutMinutes, step)
+		}
+		results = append(results, result)
+		if ctx.Err() != nil {
+			step.finish(ctx, ctx.Err())
+			return ctx.Err()
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s (%s) failed:\n%s", check, result.Command, result.Output))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	var verifyErr error
+	if len(failures) > 0 {
+		verifyErr = &utils.CommandError{
+			Message: "Verification failed after a successful build:\n\n" + strings.Join(failures, "\n\n"),
+			Err:     firstErr,
+		}
+	}
+	step.finish(ctx, verifyErr)
+
+	_, err = b.VersionService.UpdateVersion(context.WithoutCancel(ctx), versionID, map[string]interface{}{
+		"verification_results": results,
+	})
+	if err != nil {
+		log.Printf("[Verify] Warning: Failed to store verification results for version %s: %v\n", versionID, err)
+	}
+
+	return verifyErr
+}
+
+// runCheck runs one check with CI=true so test runners do not start in watch
+// mode, bounded by timeoutMinutes
+func (b *Builder) runCheck(ctx context.Context, workspaceDir, check string, command verifyCommand, attempt, timeoutMinutes int, output io.Writer) (models.VerificationResult, error) {
+	result := models.VerificationResult{Check: check, Command: command.String(), Attempt: attempt}
+
+	fmt.Fprintf(output, "$ %s\n", command)
+	tail := &tailBuffer{max: maxCheckOutputBytes}
+	start := time.Now()
+	err := withStageTimeout(ctx, check, timeoutMinutes, func(ctx context.Context) error {
+		return b.Executor.Run(ctx, executor.Command{
+			Name:   command.name,
+			Args:   command.args,
+			Dir:    workspaceDir,
+			Env:    []string{"CI=true"},
+			Stdout: io.MultiWriter(tail, output),
+			Stderr: io.MultiWriter(tail, output),
+		})
+	})
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.ExitCode = utils.ExitCode(err)
+	result.Output = tail.String()
+
+	if utils.ExitCode(err) == nil && err != nil && ctx.Err() == nil {
+		// Timed out or failed to start; keep the reason next to the output
+		result.Output += "\n" + err.Error()
+	}
+
+	result.Status = "passed"
+	if err != nil {
+		result.Status = "failed"
+		log.Printf("[Verify] %s failed: %v\n", command, err)
+	}
+	return result, err
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := strings.TrimSpace(string(t.buf))
+	if t.truncated {
+		out = "... (earlier output truncated)\n" + out
+	}
+	return out
+}